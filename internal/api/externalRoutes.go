@@ -11,10 +11,12 @@ import (
 	core "gitlab.eclipse.org/eclipse/xfsc/libraries/microservice/core/pkg/server"
 	"gitlab.eclipse.org/eclipse/xfsc/libraries/ssi/oid4vip/model/presentation"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/httpclient"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/middleware"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/services"
 	svcCommon "github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/services/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/pkg/messaging"
 )
 
 const (
@@ -34,23 +36,27 @@ func AddExternalRoutes(server *core.Server, authHandler *services.AuthorizationH
 		config := common.GetEnvironment().GetConfig()
 		g := rg.Group(services.CredentialApiGroup)
 		mWGroup := g.Group(services.DirectGroup)
-		mWGroup.Use(middleware.VerifyId(common.GetEnvironment()))
-		mWGroup.GET("/:id/request-object/request.jwt", func(ctx *gin.Context) {
+		mWGroup.Use(middleware.Actor(svcCommon.ActorWallet))
+		mWGroup.GET("/:id/request-object/request.jwt", middleware.VerifyId(common.GetEnvironment(), services.PurposeRequestObject), func(ctx *gin.Context) {
 			ResponseRequestObject(ctx, requestor, config)
 		})
 
 		//Receiving the proof from a direct post call
-		mWGroup.POST("/:id", func(ctx *gin.Context) {
+		mWGroup.POST("/:id", middleware.VerifyId(common.GetEnvironment(), services.PurposeResponse), func(ctx *gin.Context) {
 			services.HandleProof(ctx, requestor, config)
 		})
 
+		//Publishes the JSON schemas of the status events
+		g.GET("/events/schemas", HandleListEventSchemas)
+		g.GET("/events/schemas/:type", HandleGetEventSchema)
+
 		//allowing redirects from externals
 		if config.ExternalPresentation.Enabled {
-			g.GET("/authorize", func(ctx *gin.Context) {
+			g.GET("/authorize", middleware.Actor(svcCommon.ActorHttp), func(ctx *gin.Context) {
 				authHandler.HandleAuthorizationRequest(ctx, config)
 			})
 
-			g.GET("/request", HandleRequestPresentation(requestor, config))
+			g.GET("/request", middleware.Actor(svcCommon.ActorHttp), HandleRequestPresentation(requestor, config))
 		}
 	})
 }
@@ -64,9 +70,13 @@ func AddExternalRoutes(server *core.Server, authHandler *services.AuthorizationH
 // @Param requestId query string true "Request ID"
 // @Param x-groupId header string true "Group ID"
 // @Param x-ttl header int 200 "TTL"
-// @Param x-did header int false "DID"
+// @Param x-did header string true "DID of the verifier, client id of the request"
 // @Param x-key header int false "KEY"
-// @Param presentationDefinition query string true "Presentation Definition base64 url encoded"
+// @Param x-webhookUrl header string false "Webhook URL, if the tenant allows urls of requests"
+// @Param presentationDefinition query string false "Presentation Definition base64 url encoded, required without template"
+// @Param template query string false "Template ID"
+// @Param templateVersion query int false "Template version, latest if empty"
+// @Param templateParameters query string false "Template parameters as json object base64 url encoded"
 // @Success 200 {string} jwt
 // @Failure 400 {object} services.ServerErrorResponse
 // @Failure 500 {object} services.ServerErrorResponse
@@ -79,37 +89,75 @@ func HandleRequestPresentation(requestor *services.PresentationRequestor, config
 			ttl = DefaultPresentationRequestTTL
 		}
 		var options = svcCommon.PresentationRequestOptions{
-			TenantId:  ctx.Request.Header.Get("x-tenantId"),
-			RequestId: queryParams.Get("requestId"),
-			GroupId:   ctx.Request.Header.Get("x-groupId"),
-			Ttl:       ttl,
+			TenantId:   ctx.Request.Header.Get("x-tenantId"),
+			RequestId:  queryParams.Get("requestId"),
+			GroupId:    ctx.Request.Header.Get("x-groupId"),
+			Ttl:        ttl,
+			WebhookUrl: ctx.Request.Header.Get("x-webhookUrl"),
+			ClientId:   ctx.Request.Header.Get("x-did"),
 		}
-		id, err := services.SignId(options.TenantId, config.SigningKey)
-		if err != nil {
-			services.ErrorResponse(ctx, "Error signing id", err)
+		if options.ClientId == "" {
+			services.ErrorResponse(ctx, "Invalid did", services.ErrMissingClientDid)
 			return
 		}
-		options.Id = id
-		var definition presentation.PresentationDefinition
-		definitionReader := base64.NewDecoder(base64.URLEncoding, strings.NewReader(queryParams.Get("presentationDefinition")))
-		if err != nil {
-			services.ErrorResponse(ctx, "Error decoding presentation definition", err)
+		if err := services.CheckWebhookUrl(config, options.TenantId, options.WebhookUrl); err != nil {
+			services.ErrorResponse(ctx, "Invalid webhook url", err)
 			return
 		}
-		err = json.NewDecoder(definitionReader).Decode(&definition)
-		if err != nil {
-			services.ErrorResponse(ctx, "Error decoding presentation definition json", err)
-			return
+		id := services.NewPresentationId()
+		options.Id = id
+		var definition presentation.PresentationDefinition
+		if templateId := queryParams.Get("template"); templateId != "" {
+			ref, err := templateReference(templateId, queryParams.Get("templateVersion"), queryParams.Get("templateParameters"))
+			if err != nil {
+				services.ErrorResponse(ctx, "Error decoding template reference", err)
+				return
+			}
+			materialized, err := services.MaterializeTemplate(ctx.Request.Context(), options.TenantId, ref)
+			if err != nil {
+				services.ErrorResponse(ctx, "Error materializing template", err)
+				return
+			}
+			definition = *materialized
+		} else {
+			definitionReader := base64.NewDecoder(base64.URLEncoding, strings.NewReader(queryParams.Get("presentationDefinition")))
+			err = json.NewDecoder(definitionReader).Decode(&definition)
+			if err != nil {
+				services.ErrorResponse(ctx, "Error decoding presentation definition json", err)
+				return
+			}
 		}
 		err = requestor.CreatePresentationRequest(definition, options, ctx.Request.Context())
 		if err != nil {
 			services.ErrorResponse(ctx, "Error creating presentation request", err)
 			return
 		}
-		JwtResponse(ctx, requestor, config.PublicBasePath, id, options.TenantId, options.GroupId, ctx.Request.Header.Get("x-did"), ctx.Request.Header.Get("x-key"), config.ExternalPresentation.ClientUrlSchema)
+		JwtResponse(ctx, requestor, config.PublicBasePath, id, options.TenantId, options.GroupId, options.ClientId, ctx.Request.Header.Get("x-key"), config.ExternalPresentation.ClientUrlSchema)
 	}
 }
 
+// templateReference reads the template query parameters, the parameters are a base64 url encoded json object.
+func templateReference(id string, version string, parameters string) (messaging.TemplateReference, error) {
+	ref := messaging.TemplateReference{Id: id}
+
+	if version != "" {
+		v, err := strconv.Atoi(version)
+		if err != nil {
+			return ref, err
+		}
+		ref.Version = v
+	}
+
+	if parameters != "" {
+		reader := base64.NewDecoder(base64.URLEncoding, strings.NewReader(parameters))
+		if err := json.NewDecoder(reader).Decode(&ref.Parameters); err != nil {
+			return ref, err
+		}
+	}
+
+	return ref, nil
+}
+
 // ResponseRequestObject godoc
 // @Summary Responds with a request object
 // @Description Responds with a request object by fetching the request object and setting it as fetched
@@ -127,7 +175,9 @@ func ResponseRequestObject(c *gin.Context, requestor *services.PresentationReque
 	id, b := c.Params.Get("id")
 	tenantId, b2 := c.Params.Get("tenantId")
 
-	path := strings.Replace(c.Request.RequestURI, "/"+id+"/request-object/request.jwt", "", -1)
+	// the id param holds the presentation id, the path still contains the id token
+	path := strings.TrimSuffix(c.Request.URL.Path, "/request-object/request.jwt")
+	path = path[:strings.LastIndex(path, "/")]
 	if b && b2 {
 		JwtResponse(c, requestor, path, id, tenantId, c.Request.Header.Get("x-group"), c.Request.Header.Get("x-did"), c.Request.Header.Get("x-key"), config.ExternalPresentation.ClientUrlSchema)
 
@@ -142,6 +192,7 @@ func JwtResponse(c *gin.Context, requestor *services.PresentationRequestor, path
 
 	if err != nil {
 		services.ErrorResponse(c, "Request object fetching failed.", err)
+		return
 	}
 	c.Header("Content-Type", "application/jwt")
 	c.JSON(200, string(str))
@@ -149,15 +200,14 @@ func JwtResponse(c *gin.Context, requestor *services.PresentationRequestor, path
 
 func RespondToken(c *gin.Context, authRequest presentation.RequestObject, tenantId string) {
 
-	r, err := http.NewRequest("GET", authRequest.PresentationDefinitionUri, nil)
+	r, err := http.NewRequestWithContext(httpclient.WithTenant(c.Request.Context(), tenantId), "GET", authRequest.PresentationDefinitionUri, nil)
 	r.Header.Add("Content-Type", "application/json")
 	if err != nil {
 		services.InternalErrorResponse(c, err.Error(), err)
 		return
 	}
 
-	client := &http.Client{}
-	res, err := client.Do(r)
+	res, err := services.GetHttpClient(httpclient.RequestObject).Do(r)
 	if err != nil {
 		services.InternalErrorResponse(c, "Presentation Definition URI not reachable.", err)
 		return
@@ -173,3 +223,33 @@ func RespondToken(c *gin.Context, authRequest presentation.RequestObject, tenant
 		return
 	}
 }
+
+// HandleListEventSchemas godoc
+// @Summary Lists the status event types
+// @Description Lists the versioned types of the status events which have a JSON schema
+// @Tags external
+// @Produce json
+// @Success 200 {array} string
+// @Router /presentation/events/schemas [get]
+func HandleListEventSchemas(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, messaging.EventTypes())
+}
+
+// HandleGetEventSchema godoc
+// @Summary Retrieves the JSON schema of a status event type
+// @Tags external
+// @Produce application/schema+json
+// @Param type path string true "Event type"
+// @Success 200 {object} object
+// @Failure 404 {object} services.ServerErrorResponse
+// @Router /presentation/events/schemas/{type} [get]
+func HandleGetEventSchema(ctx *gin.Context) {
+	schema, err := messaging.EventSchema(ctx.Param("type"))
+
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, services.ServerErrorResponse{Message: err.Error()})
+		return
+	}
+
+	ctx.Data(http.StatusOK, "application/schema+json", schema)
+}
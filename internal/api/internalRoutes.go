@@ -2,43 +2,55 @@ package api
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/auth"
 	core "gitlab.eclipse.org/eclipse/xfsc/libraries/microservice/core/pkg/server"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/middleware"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/services"
+	svcCommon "github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/services/common"
 )
 
 // TODO Better Nats?
-func AddInternalRoutes(server *core.Server, requestor *services.PresentationRequestor) {
+func AddInternalRoutes(server *core.Server, requestor *services.PresentationRequestor, authenticator auth.Authenticator) {
 	server.Add(func(rg *gin.RouterGroup) {
 		config := common.GetEnvironment().GetConfig()
 		g := rg.Group(services.InternalApiGroup)
+		if authenticator != nil {
+			g.Use(middleware.Authenticate(common.GetEnvironment(), authenticator))
+		} else if !config.InternalAuth.Insecure {
+			g.Use(middleware.RejectAll())
+		}
+		g.Use(middleware.Actor(svcCommon.ActorHttp))
 
-		pR := g.Group("proofs")
-		pR.Use(middleware.VerifyId(common.GetEnvironment()))
+		addProofRoutes(g.Group("proofs"), config)
 
-		//Requests an incoming ID from the Database
-		pR.GET("/proof/:id", func(ctx *gin.Context) {
-			services.HandleGetProofRequestById(ctx, config)
+		tR := g.Group("templates")
+
+		//Manages the presentation definition templates of the tenant
+		tR.GET("", func(ctx *gin.Context) {
+			services.HandleListTemplates(ctx, config)
+		})
+
+		tR.POST("", func(ctx *gin.Context) {
+			services.HandleCreateTemplate(ctx, config)
 		})
 
-		pR.GET("/proof/request/:id", func(ctx *gin.Context) {
-			services.HandleGetProofRequestByRequestId(ctx, config)
+		tR.GET("/:templateId", func(ctx *gin.Context) {
+			services.HandleGetTemplate(ctx, config)
 		})
 
-		//Completes and proof request by signing and posting it
-		pR.POST("/proof/:id", func(ctx *gin.Context) {
-			services.HandleCreateProofById(ctx, config)
+		tR.GET("/:templateId/versions", func(ctx *gin.Context) {
+			services.HandleListTemplateVersions(ctx, config)
 		})
 
-		//Completes and proof request by signing and posting it
-		pR.POST("/proof/request/:id", func(ctx *gin.Context) {
-			services.HandleCreateProofByRequestId(ctx, config)
+		//Stores a new version of the template
+		tR.PUT("/:templateId", func(ctx *gin.Context) {
+			services.HandleUpdateTemplate(ctx, config)
 		})
 
-		//Assigns record to account
-		pR.PUT("/proof/:id/assign/:groupId", func(ctx *gin.Context) {
-			services.HandleAssignProof(ctx, config)
+		tR.DELETE("/:templateId", func(ctx *gin.Context) {
+			services.HandleDeleteTemplate(ctx, config)
 		})
 
 		pL := g.Group("list")
@@ -50,3 +62,55 @@ func AddInternalRoutes(server *core.Server, requestor *services.PresentationRequ
 
 	})
 }
+
+// addProofRoutes adds the routes of single records. They are addressed by an id token of the presentation id,
+// the request routes by an id token of the request id.
+func addProofRoutes(pR *gin.RouterGroup, config *model.Config) {
+	rR := pR.Group("/proof/request", middleware.VerifyId(common.GetEnvironment(), services.PurposeRequestId))
+
+	rR.GET("/:id", func(ctx *gin.Context) {
+		services.HandleGetProofRequestByRequestId(ctx, config)
+	})
+
+	//Completes and proof request by signing and posting it
+	rR.POST("/:id", func(ctx *gin.Context) {
+		services.HandleCreateProofByRequestId(ctx, config)
+	})
+
+	iR := pR.Group("/proof", middleware.VerifyId(common.GetEnvironment(), services.PurposeInternal))
+
+	//Requests an incoming ID from the Database
+	iR.GET("/:id", func(ctx *gin.Context) {
+		services.HandleGetProofRequestById(ctx, config)
+	})
+
+	//Lists the audit trail of a record
+	iR.GET("/:id/audit", func(ctx *gin.Context) {
+		services.HandleGetProofAudit(ctx, config)
+	})
+
+	//Lists the webhook delivery log of a record
+	iR.GET("/:id/webhooks", func(ctx *gin.Context) {
+		services.HandleListWebhookDeliveries(ctx, config)
+	})
+
+	//Sends a logged webhook callback again
+	iR.POST("/:id/webhooks/:deliveryId/replay", func(ctx *gin.Context) {
+		services.HandleReplayWebhook(ctx, config)
+	})
+
+	//Completes and proof request by signing and posting it
+	iR.POST("/:id", func(ctx *gin.Context) {
+		services.HandleCreateProofById(ctx, config)
+	})
+
+	//Assigns record to account
+	iR.PUT("/:id/assign/:groupId", func(ctx *gin.Context) {
+		services.HandleAssignProof(ctx, config)
+	})
+
+	//Cancels a record which is not finished yet
+	iR.PUT("/:id/cancel", func(ctx *gin.Context) {
+		services.HandleCancelProof(ctx, config)
+	})
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrUnauthorized = errors.New("unauthorized")
+
+// clock skew tolerated for exp and nbf
+const leeway = 60 * time.Second
+
+// Authenticator validates an OAuth2 bearer token and returns its claims.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Claims, error)
+}
+
+type Claims struct {
+	Subject   string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	Scopes    []string
+}
+
+func (claims *Claims) HasScope(scope string) bool {
+	for _, s := range claims.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (claims *Claims) validate(issuer string, audience string) error {
+	now := time.Now()
+
+	if claims.ExpiresAt.IsZero() || now.After(claims.ExpiresAt.Add(leeway)) {
+		return fmt.Errorf("%w: token expired", ErrUnauthorized)
+	}
+
+	if !claims.NotBefore.IsZero() && now.Add(leeway).Before(claims.NotBefore) {
+		return fmt.Errorf("%w: token not yet valid", ErrUnauthorized)
+	}
+
+	if issuer != "" && claims.Issuer != issuer {
+		return fmt.Errorf("%w: unexpected issuer %s", ErrUnauthorized, claims.Issuer)
+	}
+
+	if audience != "" {
+		for _, aud := range claims.Audience {
+			if aud == audience {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: audience %s missing", ErrUnauthorized, audience)
+	}
+
+	return nil
+}
+
+// claimsFromMap reads the registered claims and the scopes. Scopes are taken from "scope" (space separated)
+// or "scp" (array), as issued by the common authorization servers.
+func claimsFromMap(m map[string]interface{}) *Claims {
+	claims := &Claims{
+		Subject:   stringClaim(m["sub"]),
+		Issuer:    stringClaim(m["iss"]),
+		Audience:  listClaim(m["aud"]),
+		ExpiresAt: timeClaim(m["exp"]),
+		NotBefore: timeClaim(m["nbf"]),
+		Scopes:    strings.Fields(stringClaim(m["scope"])),
+	}
+
+	claims.Scopes = append(claims.Scopes, listClaim(m["scp"])...)
+	return claims
+}
+
+func stringClaim(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func listClaim(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		res := make([]string, 0, len(t))
+		for _, e := range t {
+			if s, ok := e.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+func timeClaim(v interface{}) time.Time {
+	if f, ok := v.(float64); ok {
+		return time.Unix(int64(f), 0)
+	}
+	return time.Time{}
+}
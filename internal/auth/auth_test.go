@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func segment(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func claims(exp time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   "https://issuer",
+		"aud":   []string{"verifier"},
+		"sub":   "backend",
+		"exp":   exp.Unix(),
+		"scope": "tenant:t1 group:g1",
+	}
+}
+
+func signRS256(key *rsa.PrivateKey, kid string, payload map[string]interface{}) string {
+	input := segment(map[string]string{"alg": "RS256", "kid": kid}) + "." + segment(payload)
+	digest := sha256.Sum256([]byte(input))
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func signES256(key *ecdsa.PrivateKey, kid string, payload map[string]interface{}) string {
+	input := segment(map[string]string{"alg": "ES256", "kid": kid}) + "." + segment(payload)
+	digest := sha256.Sum256([]byte(input))
+	r, s, _ := ecdsa.Sign(rand.Reader, key, digest[:])
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func Test_Jwks(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "n": base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()), "e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": base64.RawURLEncoding.EncodeToString(ecKey.X.Bytes()), "y": base64.RawURLEncoding.EncodeToString(ecKey.Y.Bytes())},
+		}})
+	}))
+	defer server.Close()
+
+	authenticator, err := NewJwksAuthenticator(server.URL, "https://issuer", "verifier", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := authenticator.Authenticate(context.Background(), signRS256(rsaKey, "rsa", claims(time.Now().Add(time.Hour))))
+
+	if err != nil || c.Subject != "backend" || !c.HasScope("tenant:t1") || c.HasScope("tenant:t2") {
+		t.Error(err)
+	}
+
+	_, err = authenticator.Authenticate(context.Background(), signES256(ecKey, "ec", claims(time.Now().Add(time.Hour))))
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = authenticator.Authenticate(context.Background(), signRS256(rsaKey, "rsa", claims(time.Now().Add(-time.Hour))))
+
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Error("expired token must be rejected")
+	}
+
+	wrongAudience := claims(time.Now().Add(time.Hour))
+	wrongAudience["aud"] = "other"
+
+	_, err = authenticator.Authenticate(context.Background(), signRS256(rsaKey, "rsa", wrongAudience))
+
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Error("audience must be checked")
+	}
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	_, err = authenticator.Authenticate(context.Background(), signRS256(otherKey, "rsa", claims(time.Now().Add(time.Hour))))
+
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Error("foreign signature must be rejected")
+	}
+
+	unsigned := segment(map[string]string{"alg": "none", "kid": "rsa"}) + "." + segment(claims(time.Now().Add(time.Hour))) + "."
+
+	_, err = authenticator.Authenticate(context.Background(), unsigned)
+
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Error("alg none must be rejected")
+	}
+}
+
+func Test_Introspection(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "verifier" || password != "secret" {
+			w.WriteHeader(401)
+			return
+		}
+
+		res := claims(time.Now().Add(time.Hour))
+		res["active"] = r.FormValue("token") == "valid"
+		json.NewEncoder(w).Encode(res)
+	}))
+	defer server.Close()
+
+	authenticator, err := NewIntrospectionAuthenticator(server.URL, "verifier", "secret", "https://issuer", "", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := authenticator.Authenticate(context.Background(), "valid")
+
+	if err != nil || !c.HasScope("group:g1") {
+		t.Error(err)
+	}
+
+	_, err = authenticator.Authenticate(context.Background(), "revoked")
+
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Error("inactive token must be rejected")
+	}
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// IntrospectionAuthenticator validates opaque or JWT access tokens at the introspection endpoint (RFC 7662)
+// of the authorization server.
+type IntrospectionAuthenticator struct {
+	url          string
+	clientId     string
+	clientSecret string
+	issuer       string
+	audience     string
+	client       *http.Client
+}
+
+func NewIntrospectionAuthenticator(url string, clientId string, clientSecret string, issuer string, audience string, client *http.Client) (*IntrospectionAuthenticator, error) {
+	if url == "" {
+		return nil, fmt.Errorf("introspection url missing")
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &IntrospectionAuthenticator{
+		url:          url,
+		clientId:     clientId,
+		clientSecret: clientSecret,
+		issuer:       issuer,
+		audience:     audience,
+		client:       client,
+	}, nil
+}
+
+func (authenticator *IntrospectionAuthenticator) Authenticate(ctx context.Context, token string) (*Claims, error) {
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("token_type_hint", "access_token")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, authenticator.url, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(authenticator.clientId), url.QueryEscape(authenticator.clientSecret))
+
+	res, err := authenticator.client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection endpoint responded %d", res.StatusCode)
+	}
+
+	var m map[string]interface{}
+
+	if err := json.NewDecoder(res.Body).Decode(&m); err != nil {
+		return nil, err
+	}
+
+	if active, _ := m["active"].(bool); !active {
+		return nil, fmt.Errorf("%w: token not active", ErrUnauthorized)
+	}
+
+	claims := claimsFromMap(m)
+
+	if err := claims.validate(authenticator.issuer, authenticator.audience); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
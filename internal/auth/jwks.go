@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	jwksMaxAge     = time.Hour
+	jwksMinRefresh = time.Minute
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// JwksAuthenticator validates signed JWT access tokens with the keys published by the authorization server.
+// The key set is cached and fetched again for unknown key ids, at most once a minute.
+type JwksAuthenticator struct {
+	url      string
+	issuer   string
+	audience string
+	client   *http.Client
+
+	mutex   sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+func NewJwksAuthenticator(url string, issuer string, audience string, client *http.Client) (*JwksAuthenticator, error) {
+	if url == "" {
+		return nil, errors.New("jwks url missing")
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &JwksAuthenticator{
+		url:      url,
+		issuer:   issuer,
+		audience: audience,
+		client:   client,
+	}, nil
+}
+
+func (authenticator *JwksAuthenticator) Authenticate(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrUnauthorized)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errors.Join(fmt.Errorf("%w: malformed header", ErrUnauthorized), err)
+	}
+
+	key, err := authenticator.key(ctx, header.Kid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("%w: malformed signature", ErrUnauthorized), err)
+	}
+
+	err = verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	if err := decodeSegment(parts[1], &m); err != nil {
+		return nil, errors.Join(fmt.Errorf("%w: malformed payload", ErrUnauthorized), err)
+	}
+
+	claims := claimsFromMap(m)
+
+	if err := claims.validate(authenticator.issuer, authenticator.audience); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (authenticator *JwksAuthenticator) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	authenticator.mutex.Lock()
+	defer authenticator.mutex.Unlock()
+
+	key, ok := authenticator.keys[kid]
+	age := time.Since(authenticator.fetched)
+
+	if ok && age < jwksMaxAge {
+		return key, nil
+	}
+
+	if !ok && age < jwksMinRefresh {
+		return nil, fmt.Errorf("%w: unknown key id %s", ErrUnauthorized, kid)
+	}
+
+	keys, err := authenticator.fetch(ctx)
+
+	if err != nil {
+		if ok {
+			// authorization server not reachable, the cached key is still trusted
+			return key, nil
+		}
+		return nil, err
+	}
+
+	authenticator.keys = keys
+	authenticator.fetched = time.Now()
+
+	key, ok = keys[kid]
+
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key id %s", ErrUnauthorized, kid)
+	}
+
+	return key, nil
+}
+
+func (authenticator *JwksAuthenticator) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, authenticator.url, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := authenticator.client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks endpoint responded %d", res.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+
+		if err != nil {
+			// unsupported key types are skipped, they can not be used for verification anyway
+			continue
+		}
+
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signingInput []byte, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("%w: unsupported algorithm %s", ErrUnauthorized, alg)
+	}
+
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %s", ErrUnauthorized, alg)
+	}
+
+	h := hash.New()
+	h.Write(signingInput)
+	digest := h.Sum(nil)
+
+	valid := false
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			valid = rsa.VerifyPKCS1v15(k, hash, digest, signature) == nil
+		case "PS":
+			valid = rsa.VerifyPSS(k, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if alg[:2] == "ES" && len(signature) == 2*size {
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			valid = ecdsa.Verify(k, digest, r, s)
+		}
+	}
+
+	if !valid {
+		return fmt.Errorf("%w: invalid signature", ErrUnauthorized)
+	}
+
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
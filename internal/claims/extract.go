@@ -0,0 +1,173 @@
+package claims
+
+import (
+	"fmt"
+	"strings"
+
+	"gitlab.eclipse.org/eclipse/xfsc/libraries/ssi/oid4vip/model/presentation"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/credential"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/pkg/messaging"
+)
+
+// Extract returns per input descriptor the claims which its fields address, taken from the credential which the
+// submission maps to it. The vp token is the presentation, or the array of presentations.
+func Extract(definition presentation.PresentationDefinition, vpToken interface{}, descriptors []presentation.Descriptor) (map[string]messaging.DescriptorClaims, error) {
+	inputDescriptors := make(map[string]presentation.InputDescriptor, len(definition.InputDescriptors))
+	for _, d := range definition.InputDescriptors {
+		inputDescriptors[d.Id] = d
+	}
+
+	ret := make(map[string]messaging.DescriptorClaims)
+
+	for _, d := range descriptors {
+		input, ok := inputDescriptors[d.Id]
+
+		if !ok {
+			continue
+		}
+
+		target, format, err := resolve(vpToken, d)
+
+		if err != nil {
+			return nil, fmt.Errorf("descriptor %s: %w", d.Id, err)
+		}
+
+		c, claims := match(target, input.Constraints.Fields)
+		result := messaging.DescriptorClaims{Format: format, Claims: claims}
+
+		if payload, err := credential.Payload(c); err == nil {
+			result.Issuer = issuer(payload)
+		}
+
+		if document, err := credential.Document(c); err == nil {
+			result.Types = credential.Types(document)
+		}
+
+		ret[d.Id] = result
+	}
+
+	return ret, nil
+}
+
+// resolve follows the path and the nested paths of a descriptor. Nested paths are relative to the value of
+// their parent, jwt values are decoded for them.
+func resolve(root interface{}, d presentation.Descriptor) (interface{}, string, error) {
+	values, err := Query(root, d.Path)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(values) == 0 {
+		return nil, "", fmt.Errorf("path %s not found", d.Path)
+	}
+
+	if d.PathNested == nil {
+		return values[0], d.Format, nil
+	}
+
+	value := values[0]
+
+	if _, ok := value.(string); ok {
+		if value, err = credential.Payload(value); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return resolve(value, *d.PathNested)
+}
+
+// match returns the credential and its claims. A presentation is searched for the first credential which
+// contains one of the fields, otherwise the value itself is the credential.
+func match(target interface{}, fields []presentation.Field) (interface{}, map[string]interface{}) {
+	candidates := []interface{}{target}
+
+	if document, ok := target.(map[string]interface{}); ok && document["verifiableCredential"] != nil {
+		candidates = append(credential.Credentials(document), target)
+	}
+
+	for _, c := range candidates {
+		if claims := fieldValues(c, fields); len(claims) > 0 || len(fields) == 0 {
+			return c, claims
+		}
+	}
+
+	return target, map[string]interface{}{}
+}
+
+// fieldValues evaluates the paths of each field in order, the first path with a value wins. Jwt credentials are
+// evaluated on their claims and on their vc claim.
+func fieldValues(c interface{}, fields []presentation.Field) map[string]interface{} {
+	var documents []interface{}
+
+	if payload, err := credential.Payload(c); err == nil {
+		documents = append(documents, payload)
+	}
+
+	if _, ok := c.(string); ok {
+		if document, err := credential.Document(c); err == nil {
+			documents = append(documents, document)
+		}
+	}
+
+	claims := make(map[string]interface{})
+
+	for _, field := range fields {
+		if value, found := fieldValue(documents, field.Path); found {
+			claims[claimName(field)] = value
+		}
+	}
+
+	return claims
+}
+
+// fieldValue returns the value of the first path which matches. Paths outside of the supported subset, for
+// example filter expressions, are skipped, they are valid in presentation definitions.
+func fieldValue(documents []interface{}, paths []string) (interface{}, bool) {
+	for _, path := range paths {
+		for _, document := range documents {
+			values, err := Query(document, path)
+
+			if err != nil {
+				break
+			}
+
+			switch len(values) {
+			case 0:
+				continue
+			case 1:
+				return values[0], true
+			}
+
+			return values, true
+		}
+	}
+
+	return nil, false
+}
+
+// claimName is the id of the field, its name, or its first path without the leading $.
+func claimName(field presentation.Field) string {
+	switch {
+	case field.Id != "":
+		return field.Id
+	case field.Name != "":
+		return field.Name
+	case len(field.Path) > 0:
+		return strings.TrimPrefix(strings.TrimPrefix(field.Path[0], "$"), ".")
+	}
+	return ""
+}
+
+func issuer(payload map[string]interface{}) string {
+	switch i := payload["issuer"].(type) {
+	case string:
+		return i
+	case map[string]interface{}:
+		id, _ := i["id"].(string)
+		return id
+	}
+
+	iss, _ := payload["iss"].(string)
+	return iss
+}
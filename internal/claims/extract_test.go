@@ -0,0 +1,72 @@
+package claims
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"gitlab.eclipse.org/eclipse/xfsc/libraries/ssi/oid4vip/model/presentation"
+)
+
+const definition = `{
+	"id": "pd",
+	"input_descriptors": [{
+		"id": "license",
+		"constraints": {"fields": [
+			{"id": "class", "path": ["$.credentialSubject.license[0].class"]},
+			{"path": ["$.credentialSubject.city", "$.credentialSubject.address.city"]},
+			{"id": "filtered", "path": ["$.credentialSubject.license[?(@.class == 'B')]"]}
+		]}
+	}, {
+		"id": "email",
+		"constraints": {"fields": [{"name": "mail", "path": ["$.credentialSubject.email"]}]}
+	}]
+}`
+
+func Test_Extract(t *testing.T) {
+	var pd presentation.PresentationDefinition
+	if err := json.Unmarshal([]byte(definition), &pd); err != nil {
+		t.Fatal(err)
+	}
+
+	var license map[string]interface{}
+	json.Unmarshal([]byte(document), &license)
+	license["issuer"] = map[string]interface{}{"id": "did:example:issuer"}
+
+	b, _ := json.Marshal(map[string]interface{}{
+		"iss": "did:example:mail",
+		"vc":  map[string]interface{}{"type": []interface{}{"VerifiableCredential", "Email"}, "credentialSubject": map[string]interface{}{"email": "alice@example.com"}},
+	})
+	email := "eyJhbGciOiJFUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(b) + ".c2ln"
+
+	vp := map[string]interface{}{"verifiableCredential": []interface{}{email, license}}
+
+	claims, err := Extract(pd, vp, []presentation.Descriptor{
+		{Id: "license", Format: "ldp_vp", Path: "$", PathNested: &presentation.Descriptor{Id: "license", Format: "ldp_vc", Path: "$.verifiableCredential[1]"}},
+		{Id: "email", Format: "ldp_vp", Path: "$"},
+		{Id: "unknown", Format: "ldp_vp", Path: "$"},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the filter expression is not supported and skipped
+	l := claims["license"]
+	if l.Format != "ldp_vc" || l.Issuer != "did:example:issuer" || len(l.Types) != 2 || l.Claims["class"] != "B" || l.Claims["credentialSubject.city"] != "Berlin" || len(l.Claims) != 2 {
+		t.Error("unexpected license claims", l)
+	}
+
+	e := claims["email"]
+	if e.Issuer != "did:example:mail" || e.Claims["mail"] != "alice@example.com" || len(e.Claims) != 1 {
+		t.Error("credential of the presentation must be matched", e)
+	}
+
+	if _, ok := claims["unknown"]; ok || len(claims) != 2 {
+		t.Error("descriptors which are not part of the definition must be skipped", claims)
+	}
+
+	if _, err = Extract(pd, vp, []presentation.Descriptor{{Id: "email", Path: "$.verifiableCredential[7]"}}); err == nil {
+		t.Error("unresolved descriptor paths must fail")
+	}
+}
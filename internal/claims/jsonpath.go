@@ -0,0 +1,169 @@
+package claims
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidPath = errors.New("invalid json path")
+
+// segment of a json path. Wildcards match all members or items, recursive segments match at any depth.
+type segment struct {
+	name      string
+	index     int
+	isIndex   bool
+	wildcard  bool
+	recursive bool
+}
+
+// parsePath parses the subset of JSONPath used by presentation definitions: $, .name, ['name'], [n], [*], .*
+// and ..name.
+func parsePath(path string) ([]segment, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("%w: %s does not start with $", ErrInvalidPath, path)
+	}
+
+	var segments []segment
+	rest := path[1:]
+
+	for rest != "" {
+		var s segment
+
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			s.recursive = true
+			rest = rest[2:]
+			if strings.HasPrefix(rest, "[") {
+				break
+			}
+			fallthrough
+		case strings.HasPrefix(rest, "."):
+			rest = strings.TrimPrefix(rest, ".")
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("%w: empty name in %s", ErrInvalidPath, path)
+			}
+			s.name, s.wildcard = rest[:end], rest[:end] == "*"
+			rest = rest[end:]
+			segments = append(segments, s)
+			continue
+		}
+
+		if !strings.HasPrefix(rest, "[") {
+			return nil, fmt.Errorf("%w: unexpected %q in %s", ErrInvalidPath, rest, path)
+		}
+
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return nil, fmt.Errorf("%w: unterminated bracket in %s", ErrInvalidPath, path)
+		}
+
+		selector := rest[1:end]
+		rest = rest[end+1:]
+
+		switch {
+		case selector == "*":
+			s.wildcard = true
+		case len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0]:
+			s.name = selector[1 : len(selector)-1]
+		default:
+			index, err := strconv.Atoi(selector)
+			if err != nil {
+				return nil, fmt.Errorf("%w: unsupported selector [%s] in %s", ErrInvalidPath, selector, path)
+			}
+			s.index, s.isIndex = index, true
+		}
+
+		segments = append(segments, s)
+	}
+
+	return segments, nil
+}
+
+// Query returns the values of the document which are matched by the path.
+func Query(document interface{}, path string) ([]interface{}, error) {
+	segments, err := parsePath(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	values := []interface{}{document}
+
+	for _, s := range segments {
+		var next []interface{}
+
+		for _, v := range values {
+			if s.recursive {
+				next = append(next, descendants(v, s)...)
+			} else {
+				next = append(next, s.apply(v)...)
+			}
+		}
+
+		values = next
+	}
+
+	return values, nil
+}
+
+func (s segment) apply(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if s.wildcard {
+			ret := make([]interface{}, 0, len(v))
+			for _, key := range sortedKeys(v) {
+				ret = append(ret, v[key])
+			}
+			return ret
+		}
+		if e, ok := v[s.name]; ok && !s.isIndex {
+			return []interface{}{e}
+		}
+	case []interface{}:
+		if s.wildcard {
+			return v
+		}
+		index := s.index
+		if index < 0 {
+			index += len(v)
+		}
+		if s.isIndex && index >= 0 && index < len(v) {
+			return []interface{}{v[index]}
+		}
+	}
+	return nil
+}
+
+// descendants applies the segment to the value and to all values nested in it.
+func descendants(value interface{}, s segment) []interface{} {
+	ret := s.apply(value)
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			ret = append(ret, descendants(v[key], s)...)
+		}
+	case []interface{}:
+		for _, e := range v {
+			ret = append(ret, descendants(e, s)...)
+		}
+	}
+
+	return ret
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,53 @@
+package claims
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+const document = `{
+	"type": ["VerifiableCredential", "DriverLicense"],
+	"credentialSubject": {
+		"name": "Alice",
+		"address": {"city": "Berlin", "zip": "10115"},
+		"license": [{"class": "B"}, {"class": "A1"}]
+	}
+}`
+
+func Test_Query(t *testing.T) {
+	var d interface{}
+	json.Unmarshal([]byte(document), &d)
+
+	cases := map[string]int{
+		"$.credentialSubject.name":             1,
+		"$['credentialSubject']['name']":       1,
+		"$.type[1]":                            1,
+		"$.type[-1]":                           1,
+		"$.type[5]":                            0,
+		"$.credentialSubject.license[*].class": 2,
+		"$.credentialSubject.address.*":        2,
+		"$..class":                             2,
+		"$..city":                              1,
+		"$.credentialSubject.unknown":          0,
+	}
+
+	for path, n := range cases {
+		values, err := Query(d, path)
+
+		if err != nil || len(values) != n {
+			t.Error(path, values, err)
+		}
+	}
+
+	values, _ := Query(d, "$.credentialSubject.address.*")
+	if len(values) != 2 || values[0] != "Berlin" || values[1] != "10115" {
+		t.Error("wildcards must be ordered by key", values)
+	}
+
+	for _, path := range []string{"credentialSubject", "$.", "$[1", "$[a]", "$x"} {
+		if _, err := Query(d, path); !errors.Is(err, ErrInvalidPath) {
+			t.Error(path, err)
+		}
+	}
+}
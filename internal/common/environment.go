@@ -5,6 +5,16 @@ import (
 	ginSwagger "github.com/swaggo/gin-swagger"
 	logr "gitlab.eclipse.org/eclipse/xfsc/libraries/microservice/core/pkg/logr"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/docs"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/did"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/encryption"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/httpclient"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/keyring"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/kms"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/policy"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/proof"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/requestobject"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/schema"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/signer"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
 )
 
@@ -14,6 +24,16 @@ type Environment struct {
 	cryptoNamespace string
 	logger          logr.Logger
 	config          *model.Config
+	envelope        *encryption.Envelope
+	keyring         *keyring.Keyring
+	httpClients     *httpclient.Factory
+	policyEngine    policy.Engine
+	signer          signer.Signer
+	proofVerifier   *proof.Verifier
+	didResolver     *did.Resolver
+	signingBackends *kms.Backends
+	requestObjects  *requestobject.Verifier
+	schemas         *schema.Validator
 }
 
 var env *Environment
@@ -57,6 +77,91 @@ func (e *Environment) GetSession() *gocql.Session {
 	return e.session
 }
 
+// SetEnvelope sets the envelope used for encrypting stored presentations. Nil disables the encryption.
+func (e *Environment) SetEnvelope(envelope *encryption.Envelope) {
+	e.envelope = envelope
+}
+
+func (e *Environment) GetEnvelope() *encryption.Envelope {
+	return e.envelope
+}
+
+// SetKeyring sets the keyring for signing and verifying presentation ids.
+func (e *Environment) SetKeyring(keyring *keyring.Keyring) {
+	e.keyring = keyring
+}
+
+func (e *Environment) GetKeyring() *keyring.Keyring {
+	return e.keyring
+}
+
+func (e *Environment) SetHttpClients(factory *httpclient.Factory) {
+	e.httpClients = factory
+}
+
+func (e *Environment) GetHttpClients() *httpclient.Factory {
+	return e.httpClients
+}
+
+func (e *Environment) SetPolicyEngine(engine policy.Engine) {
+	e.policyEngine = engine
+}
+
+func (e *Environment) GetPolicyEngine() policy.Engine {
+	return e.policyEngine
+}
+
+func (e *Environment) SetSigner(signer signer.Signer) {
+	e.signer = signer
+}
+
+func (e *Environment) GetSigner() signer.Signer {
+	return e.signer
+}
+
+// SetProofVerifier sets the in process verifier of presentation proofs. Nil verifies only with the signer.
+func (e *Environment) SetProofVerifier(verifier *proof.Verifier) {
+	e.proofVerifier = verifier
+}
+
+func (e *Environment) GetProofVerifier() *proof.Verifier {
+	return e.proofVerifier
+}
+
+func (e *Environment) SetDidResolver(resolver *did.Resolver) {
+	e.didResolver = resolver
+}
+
+func (e *Environment) GetDidResolver() *did.Resolver {
+	return e.didResolver
+}
+
+// SetSigningBackends sets the backends which sign request objects. Nil signs with the signer service.
+func (e *Environment) SetSigningBackends(backends *kms.Backends) {
+	e.signingBackends = backends
+}
+
+func (e *Environment) GetSigningBackends() *kms.Backends {
+	return e.signingBackends
+}
+
+func (e *Environment) SetRequestObjectVerifier(verifier *requestobject.Verifier) {
+	e.requestObjects = verifier
+}
+
+func (e *Environment) GetRequestObjectVerifier() *requestobject.Verifier {
+	return e.requestObjects
+}
+
+// SetSchemaValidator sets the json schema validation of received credentials. Nil disables it.
+func (e *Environment) SetSchemaValidator(validator *schema.Validator) {
+	e.schemas = validator
+}
+
+func (e *Environment) GetSchemaValidator() *schema.Validator {
+	return e.schemas
+}
+
 func (e *Environment) GetRegion() string {
 	return e.config.Region
 }
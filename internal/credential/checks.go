@@ -0,0 +1,377 @@
+package credential
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	CheckValidity      = "validity"
+	CheckHolderBinding = "holderBinding"
+)
+
+// Failure is a failed semantic check of a credential.
+type Failure struct {
+	Credential int    `json:"credential"`
+	Check      string `json:"check"`
+	Reason     string `json:"reason"`
+}
+
+func (f Failure) String() string {
+	return fmt.Sprintf("credential %d %s: %s", f.Credential, f.Check, f.Reason)
+}
+
+// Options select the checks. The clock skew widens all validity periods.
+type Options struct {
+	Validity      bool
+	HolderBinding bool
+	// AllowBearer accepts credentials without subject id or cnf, which can not be bound to a holder.
+	AllowBearer bool
+	ClockSkew   time.Duration
+	Now         time.Time
+}
+
+// credential is the semantic content of a json-ld or jwt credential.
+type credential struct {
+	validFrom  *time.Time
+	validUntil *time.Time
+	subjects   []string
+	// cnf of jwt credentials, the kid or the json web key which the holder must prove
+	cnfKid string
+	cnfJwk map[string]interface{}
+}
+
+// CheckPresentation checks the validity periods of the credentials of a json-ld presentation and whether
+// the holder of the presentation is their subject. Credentials can be json-ld objects or jwt strings.
+func CheckPresentation(presentation map[string]interface{}, options Options) []Failure {
+	var failures []Failure
+
+	if !options.Validity && !options.HolderBinding {
+		return nil
+	}
+
+	holder := Holder(presentation)
+
+	for i, c := range Credentials(presentation) {
+		cred, err := parse(c)
+
+		// unparseable credentials fail every enabled check
+		if err != nil {
+			if options.Validity {
+				failures = append(failures, Failure{Credential: i, Check: CheckValidity, Reason: err.Error()})
+			}
+			if options.HolderBinding {
+				failures = append(failures, Failure{Credential: i, Check: CheckHolderBinding, Reason: err.Error()})
+			}
+			continue
+		}
+
+		if options.Validity {
+			if reason := cred.checkValidity(options.Now, options.ClockSkew); reason != "" {
+				failures = append(failures, Failure{Credential: i, Check: CheckValidity, Reason: reason})
+			}
+		}
+
+		if options.HolderBinding {
+			if reason := cred.checkHolder(holder, options.AllowBearer); reason != "" {
+				failures = append(failures, Failure{Credential: i, Check: CheckHolderBinding, Reason: reason})
+			}
+		}
+	}
+
+	return failures
+}
+
+// Credentials returns the credentials of a json-ld presentation.
+func Credentials(presentation map[string]interface{}) []interface{} {
+	credentials, ok := presentation["verifiableCredential"].([]interface{})
+
+	if !ok && presentation["verifiableCredential"] != nil {
+		credentials = []interface{}{presentation["verifiableCredential"]}
+	}
+
+	return credentials
+}
+
+// Document returns the json-ld document of a credential, which is the vc claim or the payload of jwt credentials.
+func Document(c interface{}) (map[string]interface{}, error) {
+	switch v := c.(type) {
+	case map[string]interface{}:
+		return v, nil
+	case string:
+		claims, err := jwtClaims(v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if vc, ok := claims["vc"].(map[string]interface{}); ok {
+			return vc, nil
+		}
+
+		return claims, nil
+	}
+	return nil, fmt.Errorf("unsupported credential of type %T", c)
+}
+
+// Payload returns the document of a json-ld credential or the claims of a jwt credential.
+func Payload(c interface{}) (map[string]interface{}, error) {
+	if token, ok := c.(string); ok {
+		return jwtClaims(token)
+	}
+	return Document(c)
+}
+
+// Types returns the type of a json-ld document as list.
+func Types(document map[string]interface{}) []string {
+	switch t := document["type"].(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		ret := make([]string, 0, len(t))
+		for _, e := range t {
+			if s, ok := e.(string); ok {
+				ret = append(ret, s)
+			}
+		}
+		return ret
+	}
+	return nil
+}
+
+// Holder returns the holder of a presentation, or the controller of its proof's verification method.
+func Holder(presentation map[string]interface{}) string {
+	switch h := presentation["holder"].(type) {
+	case string:
+		return h
+	case map[string]interface{}:
+		if id, ok := h["id"].(string); ok {
+			return id
+		}
+	}
+
+	proof, ok := presentation["proof"].(map[string]interface{})
+
+	if !ok {
+		if proofs, _ := presentation["proof"].([]interface{}); len(proofs) > 0 {
+			proof, _ = proofs[0].(map[string]interface{})
+		}
+	}
+
+	method, _ := proof["verificationMethod"].(string)
+	controller, _, _ := strings.Cut(method, "#")
+	return controller
+}
+
+func parse(c interface{}) (*credential, error) {
+	switch v := c.(type) {
+	case map[string]interface{}:
+		return parseLdp(v)
+	case string:
+		return parseJwt(v)
+	}
+	return nil, fmt.Errorf("unsupported credential of type %T", c)
+}
+
+// dateTimeLayouts are the forms of xsd:dateTime, with and without timezone offset.
+var dateTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"}
+
+// parseTime reads the first of the names as xsd:dateTime. Times without offset are taken as UTC.
+func parseTime(document map[string]interface{}, names ...string) (*time.Time, error) {
+	for _, name := range names {
+		if s, ok := document[name].(string); ok {
+			for _, layout := range dateTimeLayouts {
+				if t, err := time.Parse(layout, s); err == nil {
+					return &t, nil
+				}
+			}
+
+			return nil, fmt.Errorf("invalid %s %q", name, s)
+		}
+	}
+	return nil, nil
+}
+
+func subjectIds(subject interface{}) []string {
+	var ids []string
+
+	switch s := subject.(type) {
+	case map[string]interface{}:
+		if id, ok := s["id"].(string); ok {
+			ids = append(ids, id)
+		}
+	case []interface{}:
+		for _, e := range s {
+			ids = append(ids, subjectIds(e)...)
+		}
+	}
+
+	return ids
+}
+
+// parseLdp reads validFrom/validUntil of VCDM 2.0, or issuanceDate/expirationDate of VCDM 1.1.
+func parseLdp(document map[string]interface{}) (*credential, error) {
+	var err error
+	cred := &credential{subjects: subjectIds(document["credentialSubject"])}
+
+	if cred.validFrom, err = parseTime(document, "validFrom", "issuanceDate"); err != nil {
+		return nil, err
+	}
+
+	if cred.validUntil, err = parseTime(document, "validUntil", "expirationDate"); err != nil {
+		return nil, err
+	}
+
+	return cred, nil
+}
+
+func numericDate(claims map[string]interface{}, name string) *time.Time {
+	if n, ok := claims[name].(float64); ok {
+		t := time.Unix(int64(n), 0)
+		return &t
+	}
+	return nil
+}
+
+// jwtClaims decodes the payload of a jwt without verifying it, the signature is verified together with the presentation.
+func jwtClaims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("credential is no jwt")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwt payload: %w", err)
+	}
+
+	var claims map[string]interface{}
+
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("invalid jwt payload: %w", err)
+	}
+
+	return claims, nil
+}
+
+// parseJwt reads nbf/exp, sub and cnf of a jwt credential. Periods of the vc claim apply as well, the
+// narrower one wins.
+func parseJwt(token string) (*credential, error) {
+	claims, err := jwtClaims(token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cred := &credential{validFrom: numericDate(claims, "nbf"), validUntil: numericDate(claims, "exp")}
+
+	if vc, ok := claims["vc"].(map[string]interface{}); ok {
+		inner, err := parseLdp(vc)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if inner.validFrom != nil && (cred.validFrom == nil || inner.validFrom.After(*cred.validFrom)) {
+			cred.validFrom = inner.validFrom
+		}
+
+		if inner.validUntil != nil && (cred.validUntil == nil || inner.validUntil.Before(*cred.validUntil)) {
+			cred.validUntil = inner.validUntil
+		}
+
+		cred.subjects = inner.subjects
+	}
+
+	if sub, ok := claims["sub"].(string); ok {
+		cred.subjects = append(cred.subjects, sub)
+	}
+
+	if cnf, ok := claims["cnf"].(map[string]interface{}); ok {
+		cred.cnfKid, _ = cnf["kid"].(string)
+		cred.cnfJwk, _ = cnf["jwk"].(map[string]interface{})
+	}
+
+	return cred, nil
+}
+
+func (c *credential) checkValidity(now time.Time, skew time.Duration) string {
+	if c.validFrom != nil && now.Add(skew).Before(*c.validFrom) {
+		return "not valid before " + c.validFrom.Format(time.RFC3339)
+	}
+
+	if c.validUntil != nil && now.Add(-skew).After(*c.validUntil) {
+		return "expired at " + c.validUntil.Format(time.RFC3339)
+	}
+
+	return ""
+}
+
+// checkHolder binds by cnf if present, otherwise by subject id.
+func (c *credential) checkHolder(holder string, allowBearer bool) string {
+	if holder == "" {
+		return "presentation has no holder"
+	}
+
+	switch {
+	case c.cnfKid != "":
+		controller, _, _ := strings.Cut(c.cnfKid, "#")
+
+		if controller != holder {
+			return fmt.Sprintf("cnf kid %s is not a key of holder %s", c.cnfKid, holder)
+		}
+		return ""
+	case c.cnfJwk != nil:
+		if !holderHasJwk(holder, c.cnfJwk) {
+			return fmt.Sprintf("cnf jwk is not the key of holder %s", holder)
+		}
+		return ""
+	}
+
+	if len(c.subjects) == 0 {
+		if allowBearer {
+			return ""
+		}
+		return "credential is not bound to a subject"
+	}
+
+	for _, subject := range c.subjects {
+		if subject == holder {
+			return ""
+		}
+	}
+
+	return fmt.Sprintf("holder %s is not the subject %s", holder, strings.Join(c.subjects, ", "))
+}
+
+// holderHasJwk compares the key members of the jwk with the key of a did:jwk holder.
+func holderHasJwk(holder string, jwk map[string]interface{}) bool {
+	if !strings.HasPrefix(holder, "did:jwk:") {
+		return false
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(holder, "did:jwk:"))
+
+	if err != nil {
+		return false
+	}
+
+	var key map[string]interface{}
+
+	if json.Unmarshal(b, &key) != nil {
+		return false
+	}
+
+	for _, member := range []string{"kty", "crv", "x", "y", "n", "e"} {
+		if key[member] != jwk[member] {
+			return false
+		}
+	}
+
+	return true
+}
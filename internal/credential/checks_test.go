@@ -0,0 +1,123 @@
+package credential
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func jwt(claims map[string]interface{}) string {
+	b, _ := json.Marshal(claims)
+	return "eyJhbGciOiJFUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(b) + ".c2ln"
+}
+
+func options() Options {
+	return Options{Validity: true, HolderBinding: true, ClockSkew: time.Minute, Now: time.Now()}
+}
+
+func Test_CheckValidity(t *testing.T) {
+	now := time.Now()
+	presentation := map[string]interface{}{
+		"holder": "did:example:holder",
+		"verifiableCredential": []interface{}{
+			map[string]interface{}{
+				"validFrom":         now.Add(-time.Hour).Format(time.RFC3339),
+				"validUntil":        now.Add(30 * time.Second).Format(time.RFC3339),
+				"credentialSubject": map[string]interface{}{"id": "did:example:holder"},
+			},
+			map[string]interface{}{
+				"issuanceDate":      now.Add(-time.Hour).Format(time.RFC3339),
+				"expirationDate":    now.Add(-time.Hour).Format(time.RFC3339),
+				"credentialSubject": map[string]interface{}{"id": "did:example:holder"},
+			},
+			map[string]interface{}{
+				"validFrom":         now.Add(time.Hour).Format(time.RFC3339),
+				"credentialSubject": map[string]interface{}{"id": "did:example:holder"},
+			},
+			jwt(map[string]interface{}{"sub": "did:example:holder", "nbf": now.Add(-time.Hour).Unix(), "exp": now.Add(-30 * time.Second).Unix()}),
+			jwt(map[string]interface{}{"sub": "did:example:holder", "exp": now.Add(time.Hour).Unix(), "vc": map[string]interface{}{"validUntil": now.Add(-time.Hour).Format(time.RFC3339)}}),
+			// xsd:dateTime without timezone offset
+			map[string]interface{}{
+				"issuanceDate":      now.Add(-time.Hour).UTC().Format("2006-01-02T15:04:05"),
+				"expirationDate":    now.Add(time.Hour).UTC().Format("2006-01-02T15:04:05.000"),
+				"credentialSubject": map[string]interface{}{"id": "did:example:holder"},
+			},
+		},
+	}
+
+	failures := CheckPresentation(presentation, options())
+
+	// 0 and 3 are valid within the clock skew, the validUntil of the vc claim of 4 narrows its exp
+	if len(failures) != 3 || failures[0].Credential != 1 || failures[1].Credential != 2 || failures[2].Credential != 4 {
+		t.Error("expected failures of credential 1, 2 and 4", failures)
+	}
+
+	o := options()
+	o.Validity = false
+
+	if failures = CheckPresentation(presentation, o); len(failures) != 0 {
+		t.Error("disabled checks must not fail", failures)
+	}
+
+	presentation["verifiableCredential"] = append(presentation["verifiableCredential"].([]interface{}), map[string]interface{}{
+		"issuanceDate":      "yesterday",
+		"credentialSubject": map[string]interface{}{"id": "did:example:holder"},
+	})
+	o.HolderBinding = false
+
+	if failures = CheckPresentation(presentation, o); len(failures) != 0 {
+		t.Error("credentials must not be parsed without enabled check", failures)
+	}
+
+	o.HolderBinding = true
+
+	if failures = CheckPresentation(presentation, o); len(failures) != 1 || failures[0].Credential != 6 || failures[0].Check != CheckHolderBinding {
+		t.Error("invalid dates must fail only the enabled checks", failures)
+	}
+}
+
+func Test_CheckHolderBinding(t *testing.T) {
+	holderJwk := map[string]interface{}{"kty": "OKP", "crv": "Ed25519", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}
+	b, _ := json.Marshal(holderJwk)
+	didJwk := "did:jwk:" + base64.RawURLEncoding.EncodeToString(b)
+
+	tests := []struct {
+		name       string
+		holder     interface{}
+		credential interface{}
+		valid      bool
+	}{
+		{"subject", "did:example:a", map[string]interface{}{"credentialSubject": []interface{}{map[string]interface{}{"id": "did:example:a"}}}, true},
+		{"other subject", "did:example:a", map[string]interface{}{"credentialSubject": map[string]interface{}{"id": "did:example:b"}}, false},
+		{"holder object", map[string]interface{}{"id": "did:example:a"}, map[string]interface{}{"credentialSubject": map[string]interface{}{"id": "did:example:a"}}, true},
+		{"bearer", "did:example:a", map[string]interface{}{"credentialSubject": map[string]interface{}{"name": "a"}}, false},
+		{"cnf kid", "did:example:a", jwt(map[string]interface{}{"sub": "did:example:b", "cnf": map[string]interface{}{"kid": "did:example:a#key-1"}}), true},
+		{"other cnf kid", "did:example:a", jwt(map[string]interface{}{"sub": "did:example:a", "cnf": map[string]interface{}{"kid": "did:example:b#key-1"}}), false},
+		{"cnf jwk", didJwk, jwt(map[string]interface{}{"cnf": map[string]interface{}{"jwk": holderJwk}}), true},
+		{"other cnf jwk", "did:example:a", jwt(map[string]interface{}{"cnf": map[string]interface{}{"jwk": holderJwk}}), false},
+	}
+
+	for _, test := range tests {
+		presentation := map[string]interface{}{"holder": test.holder, "verifiableCredential": test.credential}
+
+		if failures := CheckPresentation(presentation, options()); (len(failures) == 0) != test.valid {
+			t.Error(test.name, failures)
+		}
+	}
+
+	o := options()
+	o.AllowBearer = true
+	presentation := map[string]interface{}{
+		"proof":                map[string]interface{}{"verificationMethod": "did:example:a#key-1"},
+		"verifiableCredential": map[string]interface{}{"credentialSubject": map[string]interface{}{"name": "a"}},
+	}
+
+	if failures := CheckPresentation(presentation, o); len(failures) != 0 {
+		t.Error("bearer credentials must be allowed", failures)
+	}
+
+	if Holder(presentation) != "did:example:a" {
+		t.Error("holder must fall back to the proof controller", Holder(presentation))
+	}
+}
@@ -0,0 +1,174 @@
+package did
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Verification relationships of a DID document.
+const (
+	Authentication       = "authentication"
+	AssertionMethod      = "assertionMethod"
+	KeyAgreement         = "keyAgreement"
+	CapabilityInvocation = "capabilityInvocation"
+	CapabilityDelegation = "capabilityDelegation"
+)
+
+var ErrNoVerificationMethod = errors.New("no matching verification method")
+
+type VerificationMethod struct {
+	Id                 string `json:"id"`
+	Type               string `json:"type"`
+	Controller         string `json:"controller"`
+	PublicKeyMultibase string `json:"publicKeyMultibase,omitempty"`
+	PublicKeyBase58    string `json:"publicKeyBase58,omitempty"`
+	PublicKeyJwk       *Jwk   `json:"publicKeyJwk,omitempty"`
+}
+
+// Document is a DID document. Verification relationships contain references or embedded methods.
+type Document struct {
+	Context              interface{}          `json:"@context,omitempty"`
+	Id                   string               `json:"id"`
+	Controller           interface{}          `json:"controller,omitempty"`
+	VerificationMethod   []VerificationMethod `json:"verificationMethod,omitempty"`
+	Authentication       []json.RawMessage    `json:"authentication,omitempty"`
+	AssertionMethod      []json.RawMessage    `json:"assertionMethod,omitempty"`
+	KeyAgreement         []json.RawMessage    `json:"keyAgreement,omitempty"`
+	CapabilityInvocation []json.RawMessage    `json:"capabilityInvocation,omitempty"`
+	CapabilityDelegation []json.RawMessage    `json:"capabilityDelegation,omitempty"`
+	Service              []interface{}        `json:"service,omitempty"`
+}
+
+// PublicKey returns the key of publicKeyMultibase, publicKeyJwk or publicKeyBase58 (raw ed25519 keys).
+func (m *VerificationMethod) PublicKey() (crypto.PublicKey, error) {
+	switch {
+	case m.PublicKeyJwk != nil:
+		return m.PublicKeyJwk.PublicKey()
+	case m.PublicKeyMultibase != "":
+		return DecodeMultikey(m.PublicKeyMultibase)
+	case m.PublicKeyBase58 != "" && strings.HasPrefix(m.Type, "Ed25519"):
+		b, err := decodeBase58(m.PublicKeyBase58)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(b) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key length")
+		}
+
+		return ed25519.PublicKey(b), nil
+	}
+
+	return nil, fmt.Errorf("%w: key of verification method %s", ErrUnsupported, m.Id)
+}
+
+func (d *Document) relationship(purpose string) []json.RawMessage {
+	switch purpose {
+	case Authentication:
+		return d.Authentication
+	case AssertionMethod:
+		return d.AssertionMethod
+	case KeyAgreement:
+		return d.KeyAgreement
+	case CapabilityInvocation:
+		return d.CapabilityInvocation
+	case CapabilityDelegation:
+		return d.CapabilityDelegation
+	}
+	return nil
+}
+
+// absolute resolves relative method ids ("#key-1" or "key-1") against the document id.
+func (d *Document) absolute(id string) string {
+	if strings.HasPrefix(id, "did:") {
+		return id
+	}
+	return d.Id + "#" + strings.TrimPrefix(id, "#")
+}
+
+func (d *Document) method(id string) *VerificationMethod {
+	for i := range d.VerificationMethod {
+		if d.absolute(d.VerificationMethod[i].Id) == id {
+			return &d.VerificationMethod[i]
+		}
+	}
+	return nil
+}
+
+// SelectVerificationMethod returns the method with the kid, which can be absolute or a fragment. If purpose
+// is given, the method must be part of that verification relationship, and without kid its first method
+// is returned.
+func (d *Document) SelectVerificationMethod(kid string, purpose string) (*VerificationMethod, error) {
+	if kid != "" {
+		kid = d.absolute(kid)
+	}
+
+	if purpose == "" {
+		if kid == "" && len(d.VerificationMethod) > 0 {
+			return &d.VerificationMethod[0], nil
+		}
+		if m := d.method(kid); m != nil {
+			return m, nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNoVerificationMethod, kid)
+	}
+
+	for _, entry := range d.relationship(purpose) {
+		var m *VerificationMethod
+		var ref string
+
+		if json.Unmarshal(entry, &ref) == nil {
+			m = d.method(d.absolute(ref))
+		} else {
+			m = new(VerificationMethod)
+
+			if err := json.Unmarshal(entry, m); err != nil {
+				return nil, err
+			}
+		}
+
+		if m != nil && (kid == "" || d.absolute(m.Id) == kid) {
+			return m, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s for %s", ErrNoVerificationMethod, kid, purpose)
+}
+
+func reference(id string) json.RawMessage {
+	b, _ := json.Marshal(id)
+	return b
+}
+
+// singleKeyDocument creates the document of did methods with one key, like did:key and did:jwk.
+func singleKeyDocument(id string, method VerificationMethod, purposes ...string) *Document {
+	document := &Document{
+		Context:            []interface{}{"https://www.w3.org/ns/did/v1"},
+		Id:                 id,
+		VerificationMethod: []VerificationMethod{method},
+	}
+
+	for _, purpose := range purposes {
+		r := []json.RawMessage{reference(method.Id)}
+
+		switch purpose {
+		case Authentication:
+			document.Authentication = r
+		case AssertionMethod:
+			document.AssertionMethod = r
+		case KeyAgreement:
+			document.KeyAgreement = r
+		case CapabilityInvocation:
+			document.CapabilityInvocation = r
+		case CapabilityDelegation:
+			document.CapabilityDelegation = r
+		}
+	}
+
+	return document
+}
@@ -0,0 +1,132 @@
+package did
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Jwk is a public json web key.
+type Jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+var jwkCurves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+func decodeJwkInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+// PublicKey supports RSA, EC keys of the NIST curves and Ed25519 OKP keys.
+func (k *Jwk) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("%w: curve %s", ErrUnsupported, k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key")
+		}
+
+		return ed25519.PublicKey(x), nil
+	case "EC":
+		curve, ok := jwkCurves[k.Crv]
+
+		if !ok {
+			return nil, fmt.Errorf("%w: curve %s", ErrUnsupported, k.Crv)
+		}
+
+		x, err := decodeJwkInt(k.X)
+
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeJwkInt(k.Y)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("ec key is not on curve " + k.Crv)
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "RSA":
+		n, err := decodeJwkInt(k.N)
+
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeJwkInt(k.E)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	}
+
+	return nil, fmt.Errorf("%w: key type %s", ErrUnsupported, k.Kty)
+}
+
+// resolveJwk creates the document of a did:jwk, whose method specific id is the base64url encoded key.
+func resolveJwk(id string) (*Document, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(id, "did:jwk:"))
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid did:jwk: %w", err)
+	}
+
+	key := new(Jwk)
+
+	if err = json.Unmarshal(b, key); err != nil {
+		return nil, fmt.Errorf("invalid did:jwk: %w", err)
+	}
+
+	if _, err = key.PublicKey(); err != nil {
+		return nil, err
+	}
+
+	method := VerificationMethod{Id: id + "#0", Type: "JsonWebKey2020", Controller: id, PublicKeyJwk: key}
+
+	switch key.Use {
+	case "sig":
+		return singleKeyDocument(id, method, Authentication, AssertionMethod, CapabilityInvocation, CapabilityDelegation), nil
+	case "enc":
+		return singleKeyDocument(id, method, KeyAgreement), nil
+	}
+
+	return singleKeyDocument(id, method, Authentication, AssertionMethod, CapabilityInvocation, CapabilityDelegation, KeyAgreement), nil
+}
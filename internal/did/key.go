@@ -0,0 +1,111 @@
+package did
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnsupported is returned for did methods and key types which can not be resolved.
+var ErrUnsupported = errors.New("unsupported did")
+
+const (
+	codecEd25519 = 0xed
+	codecP256    = 0x1200
+	codecP384    = 0x1201
+)
+
+// DecodeMultikey decodes a multibase encoded public key with multicodec prefix, as used by did:key and
+// Multikey verification methods. EC keys are compressed points.
+func DecodeMultikey(s string) (crypto.PublicKey, error) {
+	b, err := DecodeMultibase(s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	codec, n := binary.Uvarint(b)
+
+	if n <= 0 {
+		return nil, errors.New("invalid multicodec prefix")
+	}
+
+	key := b[n:]
+
+	switch codec {
+	case codecEd25519:
+		if len(key) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key length")
+		}
+		return ed25519.PublicKey(key), nil
+	case codecP256:
+		return decompress(elliptic.P256(), key)
+	case codecP384:
+		return decompress(elliptic.P384(), key)
+	}
+
+	return nil, fmt.Errorf("%w: multicodec 0x%x", ErrUnsupported, codec)
+}
+
+func decompress(curve elliptic.Curve, b []byte) (crypto.PublicKey, error) {
+	x, y := elliptic.UnmarshalCompressed(curve, b)
+
+	if x == nil {
+		return nil, errors.New("invalid compressed " + curve.Params().Name + " key")
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// EncodeMultikey is the inverse of DecodeMultikey.
+func EncodeMultikey(key crypto.PublicKey) (string, error) {
+	var codec uint64
+	var raw []byte
+
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		codec, raw = codecEd25519, k
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			codec = codecP256
+		case elliptic.P384():
+			codec = codecP384
+		default:
+			return "", fmt.Errorf("%w: curve %s", ErrUnsupported, k.Curve.Params().Name)
+		}
+		raw = elliptic.MarshalCompressed(k.Curve, k.X, k.Y)
+	default:
+		return "", fmt.Errorf("%w: key type %T", ErrUnsupported, key)
+	}
+
+	return EncodeMultibase(append(binary.AppendUvarint(nil, codec), raw...)), nil
+}
+
+// KeyFromDidKey returns the public key of a did:key. A fragment, like in verification method ids, is ignored.
+func KeyFromDidKey(id string) (crypto.PublicKey, error) {
+	id, _, _ = strings.Cut(id, "#")
+
+	if !strings.HasPrefix(id, "did:key:") {
+		return nil, fmt.Errorf("%w: %s is no did:key", ErrUnsupported, id)
+	}
+
+	return DecodeMultikey(strings.TrimPrefix(id, "did:key:"))
+}
+
+// resolveKey creates the document of a did:key.
+func resolveKey(id string) (*Document, error) {
+	multikey := strings.TrimPrefix(id, "did:key:")
+
+	if _, err := DecodeMultikey(multikey); err != nil {
+		return nil, err
+	}
+
+	method := VerificationMethod{Id: id + "#" + multikey, Type: "Multikey", Controller: id, PublicKeyMultibase: multikey}
+	return singleKeyDocument(id, method, Authentication, AssertionMethod, CapabilityInvocation, CapabilityDelegation), nil
+}
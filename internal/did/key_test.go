@@ -0,0 +1,65 @@
+package did
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func Test_Base58(t *testing.T) {
+	if s := encodeBase58([]byte("Hello World!")); s != "2NEpo7TZRRrLZSi2U" {
+		t.Error(s)
+	}
+
+	b, err := DecodeMultibase("z112NEpo7TZRRrLZSi2U")
+
+	if err != nil || !bytes.Equal(b, append([]byte{0, 0}, "Hello World!"...)) {
+		t.Error("leading zeros must be kept", b, err)
+	}
+
+	if _, err = DecodeMultibase("z0OIl"); err == nil {
+		t.Error("invalid base58 must fail")
+	}
+}
+
+func Test_Multikey(t *testing.T) {
+	edKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	p256Key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384Key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+
+	multikey, _ := EncodeMultikey(edKey)
+	key, err := KeyFromDidKey("did:key:" + multikey + "#" + multikey)
+
+	if err != nil || !edKey.Equal(key) {
+		t.Error("ed25519 key must roundtrip", err)
+	}
+
+	for _, k := range []*ecdsa.PrivateKey{p256Key, p384Key} {
+		multikey, _ = EncodeMultikey(&k.PublicKey)
+		key, err = KeyFromDidKey("did:key:" + multikey)
+
+		if err != nil || !k.PublicKey.Equal(key) {
+			t.Error(k.Curve.Params().Name, "key must roundtrip", err)
+		}
+	}
+
+	if _, err = KeyFromDidKey("did:web:example.com"); !errors.Is(err, ErrUnsupported) {
+		t.Error("other methods must be unsupported", err)
+	}
+}
+
+func Test_DidKeyVector(t *testing.T) {
+	key, err := KeyFromDidKey("did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := key.(ed25519.PublicKey); !ok {
+		t.Errorf("expected ed25519 key, got %T", key)
+	}
+}
@@ -0,0 +1,85 @@
+package did
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var base58Index = func() [256]int {
+	var index [256]int
+	for i := range index {
+		index[i] = -1
+	}
+	for i, c := range base58Alphabet {
+		index[c] = i
+	}
+	return index
+}()
+
+func decodeBase58(s string) ([]byte, error) {
+	value := new(big.Int)
+	radix := big.NewInt(58)
+
+	for _, c := range []byte(s) {
+		digit := base58Index[c]
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", c)
+		}
+		value.Mul(value, radix)
+		value.Add(value, big.NewInt(int64(digit)))
+	}
+
+	zeros := 0
+	for zeros < len(s) && s[zeros] == '1' {
+		zeros++
+	}
+
+	return append(make([]byte, zeros), value.Bytes()...), nil
+}
+
+func encodeBase58(b []byte) string {
+	value := new(big.Int).SetBytes(b)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+	res := make([]byte, 0, len(b)*138/100+1)
+
+	for value.Sign() > 0 {
+		value.DivMod(value, radix, mod)
+		res = append(res, base58Alphabet[mod.Int64()])
+	}
+
+	for i := 0; i < len(b) && b[i] == 0; i++ {
+		res = append(res, '1')
+	}
+
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+
+	return string(res)
+}
+
+// DecodeMultibase decodes base58btc ("z") and base64url ("u") multibase values.
+func DecodeMultibase(s string) ([]byte, error) {
+	if s == "" {
+		return nil, errors.New("empty multibase value")
+	}
+
+	switch s[0] {
+	case 'z':
+		return decodeBase58(s[1:])
+	case 'u':
+		return base64.RawURLEncoding.DecodeString(s[1:])
+	}
+
+	return nil, fmt.Errorf("unsupported multibase prefix %q", s[0])
+}
+
+// EncodeMultibase encodes base58btc with the prefix "z".
+func EncodeMultibase(b []byte) string {
+	return "z" + encodeBase58(b)
+}
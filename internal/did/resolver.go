@@ -0,0 +1,216 @@
+package did
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxDocumentBytes = 1 << 20
+
+var ErrNotFound = errors.New("did not found")
+
+type cachedDocument struct {
+	document *Document
+	expires  time.Time
+}
+
+// Resolver resolves did:key and did:jwk in process, did:web over https and all other methods with the
+// universal resolver, if configured. Resolved documents are cached for the ttl.
+type Resolver struct {
+	client          *http.Client
+	universalClient *http.Client
+	universalUrl    string
+	ttl             time.Duration
+
+	mutex sync.Mutex
+	cache map[string]cachedDocument
+}
+
+// NewResolver creates a resolver. did:web documents are fetched with the client, the universal resolver of
+// the operator is called with the universal client. Without universal resolver url only the native methods
+// are resolved.
+func NewResolver(client *http.Client, universalClient *http.Client, universalUrl string, ttl time.Duration) *Resolver {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	if universalClient == nil {
+		universalClient = http.DefaultClient
+	}
+
+	return &Resolver{
+		client:          client,
+		universalClient: universalClient,
+		universalUrl:    strings.TrimSuffix(universalUrl, "/"),
+		ttl:             ttl,
+		cache:           make(map[string]cachedDocument),
+	}
+}
+
+// Resolve returns the document of a did. Fragments, paths and queries of the did url are ignored.
+func (r *Resolver) Resolve(ctx context.Context, id string) (*Document, error) {
+	id, _, _ = strings.Cut(id, "#")
+	id, _, _ = strings.Cut(id, "?")
+
+	parts := strings.SplitN(id, ":", 3)
+
+	if len(parts) != 3 || parts[0] != "did" || parts[2] == "" {
+		return nil, fmt.Errorf("invalid did %s", id)
+	}
+
+	r.mutex.Lock()
+	cached, ok := r.cache[id]
+	r.mutex.Unlock()
+
+	if ok && cached.expires.After(time.Now()) {
+		return cached.document, nil
+	}
+
+	var document *Document
+	var err error
+
+	switch {
+	case parts[1] == "key":
+		return resolveKey(id)
+	case parts[1] == "jwk":
+		return resolveJwk(id)
+	case parts[1] == "web":
+		document, err = r.resolveWeb(ctx, id, parts[2])
+	case r.universalUrl != "":
+		document, err = r.resolveUniversal(ctx, id)
+	default:
+		return nil, fmt.Errorf("%w: method %s", ErrUnsupported, parts[1])
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if document.Id != id {
+		return nil, fmt.Errorf("document id %s does not match %s", document.Id, id)
+	}
+
+	r.mutex.Lock()
+	r.cache[id] = cachedDocument{document: document, expires: time.Now().Add(r.ttl)}
+	r.mutex.Unlock()
+
+	return document, nil
+}
+
+// ResolveVerificationMethod returns the verification method of a did url. The fragment is the kid, without
+// fragment the first method of the purpose is selected.
+func (r *Resolver) ResolveVerificationMethod(ctx context.Context, didUrl string, purpose string) (*VerificationMethod, error) {
+	document, err := r.Resolve(ctx, didUrl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, kid, _ := strings.Cut(didUrl, "#")
+
+	return document.SelectVerificationMethod(kid, purpose)
+}
+
+// ResolveKey returns the public key of a verification method, which must be part of the purpose if given.
+func (r *Resolver) ResolveKey(ctx context.Context, verificationMethod string, purpose string) (crypto.PublicKey, error) {
+	method, err := r.ResolveVerificationMethod(ctx, verificationMethod, purpose)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return method.PublicKey()
+}
+
+// webUrl returns the location of a did:web document, for example https://example.com/.well-known/did.json
+// for did:web:example.com and https://example.com/user/did.json for did:web:example.com:user.
+func webUrl(specificId string) (string, error) {
+	segments := strings.Split(specificId, ":")
+
+	for i, s := range segments {
+		segment, err := url.PathUnescape(s)
+
+		if err != nil || segment == "" || strings.Contains(segment, "/") {
+			return "", fmt.Errorf("invalid did:web segment %s", s)
+		}
+
+		segments[i] = segment
+	}
+
+	if len(segments) == 1 {
+		return "https://" + segments[0] + "/.well-known/did.json", nil
+	}
+
+	return "https://" + strings.Join(segments, "/") + "/did.json", nil
+}
+
+func (r *Resolver) resolveWeb(ctx context.Context, id string, specificId string) (*Document, error) {
+	location, err := webUrl(specificId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	document := new(Document)
+
+	if err = r.get(ctx, r.client, location, "application/did+json, application/json", document); err != nil {
+		return nil, fmt.Errorf("%s: %w", id, err)
+	}
+
+	return document, nil
+}
+
+// resolveUniversal calls the resolution endpoint of a universal resolver, which returns a resolution
+// result or, depending on the driver, the document itself.
+func (r *Resolver) resolveUniversal(ctx context.Context, id string) (*Document, error) {
+	var result struct {
+		Document
+		DidDocument *Document `json:"didDocument"`
+	}
+
+	if err := r.get(ctx, r.universalClient, r.universalUrl+"/1.0/identifiers/"+url.PathEscape(id), "application/ld+json, application/json", &result); err != nil {
+		return nil, fmt.Errorf("%s: %w", id, err)
+	}
+
+	if result.DidDocument != nil {
+		return result.DidDocument, nil
+	}
+
+	return &result.Document, nil
+}
+
+func (r *Resolver) get(ctx context.Context, client *http.Client, location string, accept string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", accept)
+
+	res, err := client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone:
+		return ErrNotFound
+	case res.StatusCode != http.StatusOK:
+		return fmt.Errorf("%s responded %d", location, res.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(res.Body, maxDocumentBytes)).Decode(v)
+}
@@ -0,0 +1,125 @@
+package did
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ResolveDidKey(t *testing.T) {
+	resolver := NewResolver(nil, nil, "", time.Minute)
+	publicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	multikey, _ := EncodeMultikey(publicKey)
+	id := "did:key:" + multikey
+
+	key, err := resolver.ResolveKey(context.Background(), id+"#"+multikey, Authentication)
+
+	if err != nil || !publicKey.Equal(key) {
+		t.Error(err)
+	}
+
+	if _, err = resolver.ResolveKey(context.Background(), id, KeyAgreement); !errors.Is(err, ErrNoVerificationMethod) {
+		t.Error("did:key must not have key agreement for ed25519", err)
+	}
+}
+
+func Test_ResolveDidJwk(t *testing.T) {
+	resolver := NewResolver(nil, nil, "", time.Minute)
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwk := `{"kty":"EC","crv":"P-256","use":"sig","x":"` + base64.RawURLEncoding.EncodeToString(privateKey.X.Bytes()) +
+		`","y":"` + base64.RawURLEncoding.EncodeToString(privateKey.Y.Bytes()) + `"}`
+	id := "did:jwk:" + base64.RawURLEncoding.EncodeToString([]byte(jwk))
+
+	key, err := resolver.ResolveKey(context.Background(), id+"#0", AssertionMethod)
+
+	if err != nil || !privateKey.PublicKey.Equal(key) {
+		t.Error(err)
+	}
+
+	if _, err = resolver.ResolveKey(context.Background(), id+"#0", KeyAgreement); !errors.Is(err, ErrNoVerificationMethod) {
+		t.Error("signature keys must not be used for key agreement", err)
+	}
+}
+
+func Test_ResolveDidWeb(t *testing.T) {
+	publicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	multikey, _ := EncodeMultikey(publicKey)
+
+	calls := 0
+	var id string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/user/alice/did.json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"id":"` + id + `","verificationMethod":[{"id":"#key-1","type":"Multikey","controller":"` + id + `","publicKeyMultibase":"` + multikey + `"},` +
+			`{"id":"#key-2","type":"Multikey","controller":"` + id + `","publicKeyMultibase":"` + multikey + `"}],"assertionMethod":["#key-2"]}`))
+	}))
+	defer server.Close()
+
+	host := strings.ReplaceAll(strings.TrimPrefix(server.URL, "https://"), ":", "%3A")
+	id = "did:web:" + host + ":user:alice"
+	resolver := NewResolver(server.Client(), nil, "", time.Minute)
+
+	if _, err := resolver.ResolveKey(context.Background(), id+"#key-2", AssertionMethod); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := resolver.ResolveKey(context.Background(), id+"#key-1", AssertionMethod); !errors.Is(err, ErrNoVerificationMethod) {
+		t.Error("methods must be selected by purpose", err)
+	}
+
+	if m, err := resolver.ResolveVerificationMethod(context.Background(), id, AssertionMethod); err != nil || m.Id != "#key-2" {
+		t.Error("first method of the purpose must be selected without kid", err)
+	}
+
+	if calls != 1 {
+		t.Error("document must be cached", calls)
+	}
+
+	if _, err := resolver.Resolve(context.Background(), "did:web:"+host); !errors.Is(err, ErrNotFound) {
+		t.Error(err)
+	}
+}
+
+func Test_ResolveUniversal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/1.0/identifiers/did:example:123" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"didDocument":{"id":"did:example:123"},"didResolutionMetadata":{}}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewResolver(nil, nil, "", time.Minute).Resolve(context.Background(), "did:example:123"); !errors.Is(err, ErrUnsupported) {
+		t.Error("other methods must be unsupported without universal resolver", err)
+	}
+
+	// the universal resolver is called with its own client, the did:web client is never used for it
+	web := &http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return nil, errors.New("denied")
+	})}
+
+	document, err := NewResolver(web, server.Client(), server.URL+"/", time.Minute).Resolve(context.Background(), "did:example:123#key-1")
+
+	if err != nil || document.Id != "did:example:123" {
+		t.Error(err)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,264 @@
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	keySize = 32
+	prefix  = "enc:v1:"
+)
+
+var ErrNotEncrypted = errors.New("value is not encrypted")
+
+// DataKey is a per tenant data key as persisted, wrapped by the key encryption key.
+type DataKey struct {
+	Id         string
+	KekId      string
+	WrappedKey string
+	Created    time.Time
+}
+
+// DataKeyStore persists the wrapped data keys of a tenant.
+type DataKeyStore interface {
+	LoadDataKeys(ctx context.Context, tenantId string) ([]DataKey, error)
+	SaveDataKey(ctx context.Context, tenantId string, key DataKey) error
+}
+
+type tenantKeys struct {
+	active  string
+	created time.Time
+	keys    map[string][]byte
+}
+
+// Envelope encrypts values with a per tenant data key. Data keys are wrapped by the key
+// encryption key and rotated after the rotation period. Values encrypted with an older data
+// key stay readable and are reported as stale, so that callers can re-encrypt them lazily.
+type Envelope struct {
+	kek      KeyEncryptionKey
+	store    DataKeyStore
+	rotation time.Duration
+	mutex    sync.Mutex
+	tenants  map[string]*tenantKeys
+	locks    map[string]*sync.Mutex
+}
+
+// New creates an envelope. A rotation of zero disables the data key rotation.
+func New(kek KeyEncryptionKey, store DataKeyStore, rotation time.Duration) *Envelope {
+	return &Envelope{
+		kek:      kek,
+		store:    store,
+		rotation: rotation,
+		tenants:  make(map[string]*tenantKeys),
+		locks:    make(map[string]*sync.Mutex),
+	}
+}
+
+// IsEncrypted reports whether a stored value was written by an envelope.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypt encrypts the plaintext with the active data key of the tenant. The associated data
+// binds the ciphertext to its location, e.g. record id and column.
+func (envelope *Envelope) Encrypt(ctx context.Context, tenantId string, plaintext []byte, associatedData string) (string, error) {
+	keys, err := envelope.getTenantKeys(ctx, tenantId)
+
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := newAead(keys.keys[keys.active])
+
+	if err != nil {
+		return "", err
+	}
+
+	ct, err := seal(aead, plaintext, []byte(tenantId+"|"+associatedData))
+
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + keys.active + ":" + ct, nil
+}
+
+// Decrypt decrypts a value created by Encrypt. The returned flag is true if the value was not
+// encrypted with the currently active data key of the tenant.
+func (envelope *Envelope) Decrypt(ctx context.Context, tenantId string, value string, associatedData string) ([]byte, bool, error) {
+	if !IsEncrypted(value) {
+		return nil, true, ErrNotEncrypted
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(value, prefix), ":", 2)
+
+	if len(parts) != 2 {
+		return nil, false, errors.New("invalid encrypted value")
+	}
+
+	keys, err := envelope.getTenantKeys(ctx, tenantId)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	key, ok := keys.keys[parts[0]]
+
+	if !ok {
+		// key might be created by another instance in the meantime
+		keys, err = envelope.reload(ctx, tenantId)
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		key, ok = keys.keys[parts[0]]
+
+		if !ok {
+			return nil, false, fmt.Errorf("data key %s not found", parts[0])
+		}
+	}
+
+	aead, err := newAead(key)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	plaintext, err := open(aead, parts[1], []byte(tenantId+"|"+associatedData))
+
+	if err != nil {
+		return nil, false, errors.Join(errors.New("decryption failed"), err)
+	}
+
+	return plaintext, parts[0] != keys.active, nil
+}
+
+func (envelope *Envelope) getTenantKeys(ctx context.Context, tenantId string) (*tenantKeys, error) {
+	envelope.mutex.Lock()
+	keys, ok := envelope.tenants[tenantId]
+	envelope.mutex.Unlock()
+
+	if ok && !envelope.expired(keys) {
+		return keys, nil
+	}
+
+	return envelope.reload(ctx, tenantId)
+}
+
+// tenantLock returns the lock which serializes the reloads of a tenant, so that the KEK calls of
+// one tenant do not block the others.
+func (envelope *Envelope) tenantLock(tenantId string) *sync.Mutex {
+	envelope.mutex.Lock()
+	defer envelope.mutex.Unlock()
+
+	lock, ok := envelope.locks[tenantId]
+
+	if !ok {
+		lock = &sync.Mutex{}
+		envelope.locks[tenantId] = lock
+	}
+
+	return lock
+}
+
+func (envelope *Envelope) reload(ctx context.Context, tenantId string) (*tenantKeys, error) {
+	lock := envelope.tenantLock(tenantId)
+	lock.Lock()
+	defer lock.Unlock()
+
+	stored, err := envelope.store.LoadDataKeys(ctx, tenantId)
+
+	if err != nil {
+		return nil, errors.Join(errors.New("could not load data keys"), err)
+	}
+
+	keys := &tenantKeys{keys: make(map[string][]byte)}
+
+	for _, dataKey := range stored {
+		plain, err := envelope.kek.Unwrap(ctx, dataKey.KekId, dataKey.WrappedKey)
+
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("could not unwrap data key %s", dataKey.Id), err)
+		}
+
+		if dataKey.KekId != envelope.kek.Id() {
+			// the KEK was rotated, rewrap the data key with the current one
+			dataKey.WrappedKey, err = envelope.kek.Wrap(ctx, plain)
+
+			if err != nil {
+				return nil, err
+			}
+
+			dataKey.KekId = envelope.kek.Id()
+
+			if err = envelope.store.SaveDataKey(ctx, tenantId, dataKey); err != nil {
+				return nil, err
+			}
+		}
+
+		keys.keys[dataKey.Id] = plain
+
+		if dataKey.Created.After(keys.created) || keys.active == "" {
+			keys.active = dataKey.Id
+			keys.created = dataKey.Created
+		}
+	}
+
+	if keys.active == "" || envelope.expired(keys) {
+		err = envelope.createDataKey(ctx, tenantId, keys)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	envelope.mutex.Lock()
+	envelope.tenants[tenantId] = keys
+	envelope.mutex.Unlock()
+	return keys, nil
+}
+
+func (envelope *Envelope) createDataKey(ctx context.Context, tenantId string, keys *tenantKeys) error {
+	plain := make([]byte, keySize)
+
+	if _, err := rand.Read(plain); err != nil {
+		return err
+	}
+
+	wrapped, err := envelope.kek.Wrap(ctx, plain)
+
+	if err != nil {
+		return errors.Join(errors.New("could not wrap data key"), err)
+	}
+
+	dataKey := DataKey{
+		Id:         uuid.NewString(),
+		KekId:      envelope.kek.Id(),
+		WrappedKey: wrapped,
+		Created:    time.Now().UTC(),
+	}
+
+	err = envelope.store.SaveDataKey(ctx, tenantId, dataKey)
+
+	if err != nil {
+		return errors.Join(errors.New("could not save data key"), err)
+	}
+
+	keys.keys[dataKey.Id] = plain
+	keys.active = dataKey.Id
+	keys.created = dataKey.Created
+	return nil
+}
+
+func (envelope *Envelope) expired(keys *tenantKeys) bool {
+	return envelope.rotation > 0 && time.Since(keys.created) > envelope.rotation
+}
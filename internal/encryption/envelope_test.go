@@ -0,0 +1,215 @@
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type memoryStore struct {
+	keys map[string]map[string]DataKey
+}
+
+func (store *memoryStore) LoadDataKeys(ctx context.Context, tenantId string) ([]DataKey, error) {
+	res := make([]DataKey, 0)
+	for _, k := range store.keys[tenantId] {
+		res = append(res, k)
+	}
+	return res, nil
+}
+
+func (store *memoryStore) SaveDataKey(ctx context.Context, tenantId string, key DataKey) error {
+	if store.keys[tenantId] == nil {
+		store.keys[tenantId] = make(map[string]DataKey)
+	}
+	store.keys[tenantId][key.Id] = key
+	return nil
+}
+
+func writeKeyFile(t *testing.T) string {
+	key := make([]byte, keySize)
+	rand.Read(key)
+	file := filepath.Join(t.TempDir(), "kek")
+	err := os.WriteFile(file, []byte(base64.StdEncoding.EncodeToString(key)), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func Test_EncryptDecrypt(t *testing.T) {
+	kek, err := NewLocalKeyEncryptionKey(writeKeyFile(t))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope := New(kek, &memoryStore{keys: map[string]map[string]DataKey{}}, 0)
+	ctx := context.Background()
+
+	value, err := envelope.Encrypt(ctx, "tenant", []byte("secret"), "id|presentation")
+
+	if err != nil || !IsEncrypted(value) {
+		t.Fatal(err)
+	}
+
+	plain, stale, err := envelope.Decrypt(ctx, "tenant", value, "id|presentation")
+
+	if err != nil || stale || string(plain) != "secret" {
+		t.Error()
+	}
+
+	_, _, err = envelope.Decrypt(ctx, "tenant", value, "other|presentation")
+
+	if err == nil {
+		t.Error()
+	}
+
+	_, _, err = envelope.Decrypt(ctx, "tenant2", value, "id|presentation")
+
+	if err == nil {
+		t.Error()
+	}
+
+	_, stale, err = envelope.Decrypt(ctx, "tenant", "cGxhaW4", "id|presentation")
+
+	if err != ErrNotEncrypted || !stale {
+		t.Error()
+	}
+}
+
+func Test_DataKeyRotation(t *testing.T) {
+	kek, err := NewLocalKeyEncryptionKey(writeKeyFile(t))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &memoryStore{keys: map[string]map[string]DataKey{}}
+	envelope := New(kek, store, time.Hour)
+	ctx := context.Background()
+
+	value, err := envelope.Encrypt(ctx, "tenant", []byte("secret"), "ad")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, k := range store.keys["tenant"] {
+		k.Created = k.Created.Add(-2 * time.Hour)
+		store.keys["tenant"][id] = k
+	}
+	envelope.tenants = make(map[string]*tenantKeys)
+
+	plain, stale, err := envelope.Decrypt(ctx, "tenant", value, "ad")
+
+	if err != nil || !stale || string(plain) != "secret" {
+		t.Error()
+	}
+
+	if len(store.keys["tenant"]) != 2 {
+		t.Error()
+	}
+}
+
+func Test_KekRotation(t *testing.T) {
+	oldFile := writeKeyFile(t)
+	oldKek, err := NewLocalKeyEncryptionKey(oldFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &memoryStore{keys: map[string]map[string]DataKey{}}
+	ctx := context.Background()
+
+	value, err := New(oldKek, store, 0).Encrypt(ctx, "tenant", []byte("secret"), "ad")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newKek, err := NewLocalKeyEncryptionKey(writeKeyFile(t), oldFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain, stale, err := New(newKek, store, 0).Decrypt(ctx, "tenant", value, "ad")
+
+	if err != nil || stale || string(plain) != "secret" {
+		t.Error()
+	}
+
+	for _, k := range store.keys["tenant"] {
+		if k.KekId != newKek.Id() {
+			t.Error()
+		}
+	}
+}
+
+type blockingKek struct {
+	KeyEncryptionKey
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (kek *blockingKek) Wrap(ctx context.Context, dataKey []byte) (string, error) {
+	if kek.release != nil {
+		kek.entered <- struct{}{}
+		<-kek.release
+	}
+	return kek.KeyEncryptionKey.Wrap(ctx, dataKey)
+}
+
+func Test_ReloadDoesNotBlockOtherTenants(t *testing.T) {
+	local, err := NewLocalKeyEncryptionKey(writeKeyFile(t))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kek := &blockingKek{KeyEncryptionKey: local}
+	envelope := New(kek, &memoryStore{keys: map[string]map[string]DataKey{}}, 0)
+	ctx := context.Background()
+
+	if _, err := envelope.Encrypt(ctx, "tenant", []byte("secret"), "ad"); err != nil {
+		t.Fatal(err)
+	}
+
+	kek.entered = make(chan struct{})
+	kek.release = make(chan struct{})
+	blocked := make(chan error)
+
+	go func() {
+		_, err := envelope.Encrypt(ctx, "tenant2", []byte("secret"), "ad")
+		blocked <- err
+	}()
+
+	<-kek.entered
+	done := make(chan error)
+
+	go func() {
+		_, err := envelope.Encrypt(ctx, "tenant", []byte("secret"), "ad")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("tenant must not wait for the kek call of another tenant")
+	}
+
+	close(kek.release)
+
+	if err := <-blocked; err != nil {
+		t.Error(err)
+	}
+}
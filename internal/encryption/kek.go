@@ -0,0 +1,258 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// KeyEncryptionKey wraps and unwraps the per tenant data keys. The id of the key which wrapped
+// a data key is stored next to it, so that data keys can be rewrapped after a KEK rotation.
+type KeyEncryptionKey interface {
+	Id() string
+	Wrap(ctx context.Context, dataKey []byte) (string, error)
+	Unwrap(ctx context.Context, kekId string, wrapped string) ([]byte, error)
+}
+
+// LocalKeyEncryptionKey is a KEK read from local key files. The first key is used for wrapping,
+// the others are only used to unwrap data keys which were wrapped before a rotation.
+type LocalKeyEncryptionKey struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+func NewLocalKeyEncryptionKey(keyFile string, previousKeyFiles ...string) (*LocalKeyEncryptionKey, error) {
+	kek := &LocalKeyEncryptionKey{keys: make(map[string]cipher.AEAD)}
+
+	for i, file := range append([]string{keyFile}, previousKeyFiles...) {
+		if file == "" {
+			continue
+		}
+
+		key, err := readKeyFile(file)
+
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("could not read key file %s", file), err)
+		}
+
+		aead, err := newAead(key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(key)
+		id := "local:" + hex.EncodeToString(sum[:8])
+		kek.keys[id] = aead
+
+		if i == 0 {
+			kek.current = id
+		}
+	}
+
+	if kek.current == "" {
+		return nil, errors.New("no key file configured")
+	}
+
+	return kek, nil
+}
+
+func (kek *LocalKeyEncryptionKey) Id() string {
+	return kek.current
+}
+
+func (kek *LocalKeyEncryptionKey) Wrap(ctx context.Context, dataKey []byte) (string, error) {
+	return seal(kek.keys[kek.current], dataKey, []byte(kek.current))
+}
+
+func (kek *LocalKeyEncryptionKey) Unwrap(ctx context.Context, kekId string, wrapped string) ([]byte, error) {
+	aead, ok := kek.keys[kekId]
+
+	if !ok {
+		return nil, fmt.Errorf("key encryption key %s is unknown", kekId)
+	}
+
+	return open(aead, wrapped, []byte(kekId))
+}
+
+func readKeyFile(file string) ([]byte, error) {
+	b, err := os.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) == keySize {
+		return b, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes long", keySize)
+	}
+
+	return key, nil
+}
+
+// VaultTransitKeyEncryptionKey wraps data keys with the transit secrets engine of HashiCorp Vault
+// or any other service offering the same API. Key versions are handled by the transit engine itself.
+type VaultTransitKeyEncryptionKey struct {
+	address string
+	token   string
+	path    string
+	keyName string
+	client  *http.Client
+}
+
+func NewVaultTransitKeyEncryptionKey(address, token, path, keyName string, client *http.Client) (*VaultTransitKeyEncryptionKey, error) {
+	if address == "" || keyName == "" {
+		return nil, errors.New("vault address and key name are required")
+	}
+
+	if path == "" {
+		path = "transit"
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &VaultTransitKeyEncryptionKey{
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+		path:    strings.Trim(path, "/"),
+		keyName: keyName,
+		client:  client,
+	}, nil
+}
+
+func (kek *VaultTransitKeyEncryptionKey) Id() string {
+	return "vault:" + kek.path + "/" + kek.keyName
+}
+
+func (kek *VaultTransitKeyEncryptionKey) Wrap(ctx context.Context, dataKey []byte) (string, error) {
+	var res struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+
+	err := kek.call(ctx, "encrypt", map[string]string{"plaintext": base64.StdEncoding.EncodeToString(dataKey)}, &res)
+
+	if err != nil {
+		return "", err
+	}
+
+	return res.Data.Ciphertext, nil
+}
+
+func (kek *VaultTransitKeyEncryptionKey) Unwrap(ctx context.Context, kekId string, wrapped string) ([]byte, error) {
+	if kekId != kek.Id() {
+		return nil, fmt.Errorf("key encryption key %s is unknown", kekId)
+	}
+
+	var res struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+
+	err := kek.call(ctx, "decrypt", map[string]string{"ciphertext": wrapped}, &res)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return base64.StdEncoding.DecodeString(res.Data.Plaintext)
+}
+
+func (kek *VaultTransitKeyEncryptionKey) call(ctx context.Context, operation string, body interface{}, result interface{}) error {
+	b, err := json.Marshal(body)
+
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/v1/%s/%s/%s", kek.address, kek.path, operation, kek.keyName)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", kek.token)
+
+	res, err := kek.client.Do(req)
+
+	if err != nil {
+		return errors.Join(errors.New("vault transit call failed"), err)
+	}
+
+	defer res.Body.Close()
+
+	respBody, err := io.ReadAll(res.Body)
+
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault transit %s returned status %s: %s", operation, res.Status, string(respBody))
+	}
+
+	return json.Unmarshal(respBody, result)
+}
+
+func newAead(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plaintext []byte, additionalData []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	ct := aead.Seal(nonce, nonce, plaintext, additionalData)
+	return base64.RawURLEncoding.EncodeToString(ct), nil
+}
+
+func open(aead cipher.AEAD, value string, additionalData []byte) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	return aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], additionalData)
+}
@@ -0,0 +1,215 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+var ErrEgressDenied = errors.New("egress denied")
+
+type tenantContextKey struct{}
+
+// WithTenant marks the outbound request as made on behalf of the tenant, so that its host lists apply.
+func WithTenant(ctx context.Context, tenantId string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenantId)
+}
+
+type Hosts struct {
+	Allow []string
+	Deny  []string
+}
+
+// EgressPolicy restricts the requests to destinations which are given by externals, like request and
+// response uris. Host entries match exactly or, starting with "*.", all subdomains.
+type EgressPolicy struct {
+	AllowHttp            bool
+	AllowPrivateNetworks bool
+	MaxResponseBytes     int64
+	Hosts
+	Tenants map[string]Hosts
+}
+
+var blockedNetworks = func() []*net.IPNet {
+	res := make([]*net.IPNet, 0)
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"100.64.0.0/10",
+		"192.0.0.0/24",
+		"198.18.0.0/15",
+		"240.0.0.0/4",
+		"64:ff9b::/96",
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		res = append(res, n)
+	}
+	return res
+}()
+
+func isPublic(ip net.IP) bool {
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range blockedNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchHost(patterns []string, host string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if pattern == host || (strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+func (policy *EgressPolicy) checkRequest(req *http.Request) error {
+	if req.URL.Scheme != "https" && !(policy.AllowHttp && req.URL.Scheme == "http") {
+		return fmt.Errorf("%w: scheme %s", ErrEgressDenied, req.URL.Scheme)
+	}
+
+	host := req.URL.Hostname()
+	hosts := []Hosts{policy.Hosts}
+
+	if tenantId, ok := req.Context().Value(tenantContextKey{}).(string); ok {
+		if tenant, ok := policy.Tenants[tenantId]; ok {
+			hosts = append(hosts, tenant)
+		}
+	}
+
+	for _, h := range hosts {
+		if matchHost(h.Deny, host) {
+			return fmt.Errorf("%w: host %s is denied", ErrEgressDenied, host)
+		}
+		if len(h.Allow) > 0 && !matchHost(h.Allow, host) {
+			return fmt.Errorf("%w: host %s is not allowed", ErrEgressDenied, host)
+		}
+	}
+
+	return nil
+}
+
+// control checks the address which is actually dialed. Because the check happens after the name
+// resolution, a host name can not be rebound to an internal address between check and connect.
+func (policy *EgressPolicy) control(network string, address string, _ syscall.RawConn) error {
+	if policy.AllowPrivateNetworks {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+
+	if ip == nil || !isPublic(ip) {
+		return fmt.Errorf("%w: address %s is not public", ErrEgressDenied, host)
+	}
+
+	return nil
+}
+
+// lookupIPAddr resolves the hosts of proxied requests, replaced by tests.
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+// checkHost checks the destination before the request is handed to a proxy, where the dialer can not see it.
+// IP literals and all addresses of a host name must be public. The proxy resolves the name again, so it should
+// be restricted to public networks as well.
+func (policy *EgressPolicy) checkHost(ctx context.Context, host string) error {
+	if policy.AllowPrivateNetworks {
+		return nil
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if !isPublic(ip) {
+			return fmt.Errorf("%w: address %s is not public", ErrEgressDenied, host)
+		}
+		return nil
+	}
+
+	addrs, err := lookupIPAddr(ctx, host)
+
+	if err != nil {
+		return errors.Join(fmt.Errorf("%w: host %s could not be resolved", ErrEgressDenied, host), err)
+	}
+
+	for _, addr := range addrs {
+		if !isPublic(addr.IP) {
+			return fmt.Errorf("%w: host %s resolves to %s, which is not public", ErrEgressDenied, host, addr.IP)
+		}
+	}
+
+	return nil
+}
+
+type egressTransport struct {
+	base   http.RoundTripper
+	policy *EgressPolicy
+	// proxied requests are checked before they are sent, the dialer only sees the proxy
+	proxied bool
+}
+
+func (transport *egressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := transport.policy.checkRequest(req); err != nil {
+		return nil, err
+	}
+
+	if transport.proxied {
+		if err := transport.policy.checkHost(req.Context(), req.URL.Hostname()); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := transport.base.RoundTrip(req)
+
+	if err != nil || transport.policy.MaxResponseBytes <= 0 {
+		return res, err
+	}
+
+	if res.ContentLength > transport.policy.MaxResponseBytes {
+		res.Body.Close()
+		return nil, fmt.Errorf("%w: response of %d bytes exceeds %d bytes", ErrEgressDenied, res.ContentLength, transport.policy.MaxResponseBytes)
+	}
+
+	res.Body = &limitedBody{ReadCloser: res.Body, remaining: transport.policy.MaxResponseBytes}
+	return res, nil
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (body *limitedBody) Read(p []byte) (int, error) {
+	if body.remaining < 0 {
+		return 0, fmt.Errorf("%w: response too large", ErrEgressDenied)
+	}
+
+	// read one byte more than allowed to detect an oversized body
+	if int64(len(p)) > body.remaining+1 {
+		p = p[:body.remaining+1]
+	}
+
+	n, err := body.ReadCloser.Read(p)
+	body.remaining -= int64(n)
+
+	if body.remaining < 0 {
+		return n + int(body.remaining), fmt.Errorf("%w: response too large", ErrEgressDenied)
+	}
+
+	return n, err
+}
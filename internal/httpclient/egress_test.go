@@ -0,0 +1,142 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_IsPublic(t *testing.T) {
+	for ip, public := range map[string]bool{
+		"8.8.8.8":         true,
+		"2001:4860::8888": true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"192.168.0.1":     false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"::1":             false,
+		"fe80::1":         false,
+		"::ffff:10.0.0.1": false,
+		"0.0.0.0":         false,
+	} {
+		if isPublic(net.ParseIP(ip)) != public {
+			t.Error(ip)
+		}
+	}
+}
+
+func Test_Egress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer server.Close()
+
+	get := func(policy *EgressPolicy, tenantId string) error {
+		client, err := newClient(Options{Egress: policy})
+
+		if err != nil {
+			return err
+		}
+
+		req, _ := http.NewRequestWithContext(WithTenant(context.Background(), tenantId), http.MethodGet, server.URL, nil)
+		res, err := client.Do(req)
+
+		if err != nil {
+			return err
+		}
+
+		defer res.Body.Close()
+		_, err = io.ReadAll(res.Body)
+		return err
+	}
+
+	if err := get(&EgressPolicy{AllowHttp: true}, ""); !errors.Is(err, ErrEgressDenied) {
+		t.Error("loopback must be blocked", err)
+	}
+
+	if err := get(&EgressPolicy{AllowPrivateNetworks: true}, ""); !errors.Is(err, ErrEgressDenied) {
+		t.Error("http must be blocked", err)
+	}
+
+	if err := get(&EgressPolicy{AllowHttp: true, AllowPrivateNetworks: true}, ""); err != nil {
+		t.Error(err)
+	}
+
+	if err := get(&EgressPolicy{AllowHttp: true, AllowPrivateNetworks: true, MaxResponseBytes: 50}, ""); !errors.Is(err, ErrEgressDenied) {
+		t.Error("size limit must apply", err)
+	}
+
+	tenants := &EgressPolicy{AllowHttp: true, AllowPrivateNetworks: true, Tenants: map[string]Hosts{
+		"restricted": {Allow: []string{"*.example.com"}},
+		"denied":     {Deny: []string{"127.0.0.1"}},
+	}}
+
+	if err := get(tenants, "restricted"); !errors.Is(err, ErrEgressDenied) {
+		t.Error("allow list must apply", err)
+	}
+
+	if err := get(tenants, "denied"); !errors.Is(err, ErrEgressDenied) {
+		t.Error("deny list must apply", err)
+	}
+
+	if err := get(tenants, "other"); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_EgressWithProxy(t *testing.T) {
+	proxied := false
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = true
+		w.Write([]byte("ok"))
+	}))
+	defer proxy.Close()
+
+	lookup := lookupIPAddr
+	defer func() { lookupIPAddr = lookup }()
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		switch host {
+		case "internal.example.com":
+			return []net.IPAddr{{IP: net.ParseIP("8.8.8.8")}, {IP: net.ParseIP("10.0.0.1")}}, nil
+		case "public.example.com":
+			return []net.IPAddr{{IP: net.ParseIP("8.8.8.8")}}, nil
+		}
+		return nil, errors.New("unknown host")
+	}
+
+	client, err := newClient(Options{Proxy: proxy.URL, Egress: &EgressPolicy{AllowHttp: true}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(url string) error {
+		res, err := client.Get(url)
+
+		if err != nil {
+			return err
+		}
+
+		return res.Body.Close()
+	}
+
+	for _, url := range []string{"http://127.0.0.1/", "http://169.254.169.254/latest/meta-data", "http://[::1]/", "http://internal.example.com/", "http://unknown.example.com/"} {
+		if err := get(url); !errors.Is(err, ErrEgressDenied) {
+			t.Error("destination must be blocked before the proxy", url, err)
+		}
+	}
+
+	if proxied {
+		t.Error("blocked requests must not reach the proxy")
+	}
+
+	if err := get("http://public.example.com/"); err != nil || !proxied {
+		t.Error("public destinations must be sent to the proxy", err)
+	}
+}
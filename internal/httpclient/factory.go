@@ -0,0 +1,195 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+type Destination string
+
+const (
+	RequestObject Destination = "requestObject"
+	ResponseUri   Destination = "responseUri"
+	Signer        Destination = "signer"
+	Policy        Destination = "policy"
+	Context       Destination = "context"
+	Did           Destination = "did"
+	Schema        Destination = "schema"
+	Vault         Destination = "vault"
+	Webhook       Destination = "webhook"
+	Auth          Destination = "auth"
+	Resolver      Destination = "resolver"
+)
+
+// Options configure the transport of a destination. Empty fields of a destination are taken from the defaults.
+type Options struct {
+	Timeout    time.Duration
+	CaBundle   string
+	ClientCert string
+	ClientKey  string
+	Proxy      string
+	// Insecure disables the verification of server certificates. Only for development with self signed certificates.
+	Insecure bool
+	Egress   *EgressPolicy
+}
+
+// Factory creates the outbound http clients. Clients are created once per destination and reused,
+// so that connections are pooled.
+type Factory struct {
+	defaults     Options
+	destinations map[Destination]Options
+
+	mutex   sync.Mutex
+	clients map[Destination]*http.Client
+}
+
+func NewFactory(defaults Options, destinations map[Destination]Options) (*Factory, error) {
+	factory := &Factory{
+		defaults:     defaults,
+		destinations: destinations,
+		clients:      make(map[Destination]*http.Client),
+	}
+
+	// fail on startup for broken certificate files instead of on the first request
+	for _, destination := range []Destination{RequestObject, ResponseUri, Signer, Policy, Context, Did, Schema, Vault, Webhook, Auth, Resolver} {
+		if _, err := factory.Client(destination); err != nil {
+			return nil, fmt.Errorf("http client %s: %w", destination, err)
+		}
+	}
+
+	return factory, nil
+}
+
+func (factory *Factory) Client(destination Destination) (*http.Client, error) {
+	factory.mutex.Lock()
+	defer factory.mutex.Unlock()
+
+	if client, ok := factory.clients[destination]; ok {
+		return client, nil
+	}
+
+	client, err := newClient(factory.options(destination))
+
+	if err != nil {
+		return nil, err
+	}
+
+	factory.clients[destination] = client
+	return client, nil
+}
+
+// Insecure reports whether any destination skips the certificate verification.
+func (factory *Factory) Insecure() bool {
+	if factory.defaults.Insecure {
+		return true
+	}
+	for _, options := range factory.destinations {
+		if options.Insecure {
+			return true
+		}
+	}
+	return false
+}
+
+func (factory *Factory) options(destination Destination) Options {
+	options := factory.defaults
+	override, ok := factory.destinations[destination]
+
+	if !ok {
+		return options
+	}
+
+	if override.Timeout > 0 {
+		options.Timeout = override.Timeout
+	}
+	if override.CaBundle != "" {
+		options.CaBundle = override.CaBundle
+	}
+	if override.ClientCert != "" {
+		options.ClientCert = override.ClientCert
+		options.ClientKey = override.ClientKey
+	}
+	if override.Proxy != "" {
+		options.Proxy = override.Proxy
+	}
+	options.Insecure = options.Insecure || override.Insecure
+	if override.Egress != nil {
+		options.Egress = override.Egress
+	}
+	return options
+}
+
+func newClient(options Options) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: options.Insecure,
+	}
+
+	if options.CaBundle != "" {
+		pool, err := x509.SystemCertPool()
+
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		pem, err := os.ReadFile(options.CaBundle)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in " + options.CaBundle)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if options.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(options.ClientCert, options.ClientKey)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	if options.Proxy != "" {
+		proxy, err := url.Parse(options.Proxy)
+
+		if err != nil {
+			return nil, err
+		}
+
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	var roundTripper http.RoundTripper = transport
+
+	if options.Egress != nil {
+		if options.Proxy == "" {
+			// proxies of the environment are not used, the dialed address must be the destination itself
+			transport.Proxy = nil
+			dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: options.Egress.control}
+			transport.DialContext = dialer.DialContext
+		}
+		roundTripper = &egressTransport{base: transport, policy: options.Egress, proxied: options.Proxy != ""}
+	}
+
+	return &http.Client{
+		Transport: roundTripper,
+		Timeout:   options.Timeout,
+	}, nil
+}
@@ -0,0 +1,53 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_CaBundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	factory, err := NewFactory(Options{Timeout: time.Second}, map[Destination]Options{
+		Signer: {CaBundle: bundle},
+		Policy: {Insecure: true},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for destination, trusted := range map[Destination]bool{RequestObject: false, Signer: true, Policy: true} {
+		client, _ := factory.Client(destination)
+		_, err = client.Get(server.URL)
+
+		if trusted != (err == nil) {
+			t.Error(destination, err)
+		}
+	}
+
+	if !factory.Insecure() {
+		t.Error()
+	}
+}
+
+func Test_InvalidBundle(t *testing.T) {
+	_, err := NewFactory(Options{CaBundle: filepath.Join(t.TempDir(), "missing.pem")}, nil)
+
+	if err == nil {
+		t.Error()
+	}
+}
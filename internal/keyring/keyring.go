@@ -0,0 +1,310 @@
+package keyring
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const separator = "."
+
+// Key is an id signing key. Only the active key signs, all keys verify.
+type Key struct {
+	Id         string
+	PrivateKey *ecdsa.PrivateKey
+	Active     bool
+}
+
+// Source loads the keys of the keyring. It is called again on every reload.
+type Source func() ([]Key, error)
+
+// Keyring holds the keys for signing and verifying presentation ids. Signed ids carry the id of the
+// signing key, so that ids stay verifiable after the active key was rotated.
+type Keyring struct {
+	source Source
+	mutex  sync.RWMutex
+	keys   map[string]Key
+	active string
+}
+
+func New(source Source) (*Keyring, error) {
+	keyring := &Keyring{source: source}
+
+	if err := keyring.Reload(); err != nil {
+		return nil, err
+	}
+
+	return keyring, nil
+}
+
+// Reload loads the keys again from the source. The current keys stay in use if loading fails.
+func (keyring *Keyring) Reload() error {
+	loaded, err := keyring.source()
+
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]Key)
+	active := ""
+
+	for _, key := range loaded {
+		if key.Active {
+			if active != "" && active != key.Id {
+				return fmt.Errorf("more than one active key: %s, %s", active, key.Id)
+			}
+			active = key.Id
+		}
+		keys[key.Id] = key
+	}
+
+	if active == "" {
+		return errors.New("no active signing key")
+	}
+
+	keyring.mutex.Lock()
+	keyring.keys = keys
+	keyring.active = active
+	keyring.mutex.Unlock()
+	return nil
+}
+
+// Watch reloads the keyring on SIGHUP and every interval, if the interval is greater than zero.
+func (keyring *Keyring) Watch(interval time.Duration, onError func(error)) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-signals:
+		case <-tick:
+		}
+
+		if err := keyring.Reload(); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+func (keyring *Keyring) ActiveKeyId() string {
+	keyring.mutex.RLock()
+	defer keyring.mutex.RUnlock()
+	return keyring.active
+}
+
+// Sign signs the message with the active key and returns "<key id>.<signature>".
+func (keyring *Keyring) Sign(message string) (string, error) {
+	keyring.mutex.RLock()
+	key := keyring.keys[keyring.active]
+	keyring.mutex.RUnlock()
+
+	signature, err := SignMessage(message, key.PrivateKey)
+
+	if err != nil {
+		return "", err
+	}
+
+	return key.Id + separator + signature, nil
+}
+
+// Verify checks a signature created by Sign with the key referenced in it.
+func (keyring *Keyring) Verify(message string, signed string) (bool, error) {
+	keyring.mutex.RLock()
+	defer keyring.mutex.RUnlock()
+
+	kid, signature, found := strings.Cut(signed, separator)
+
+	if !found {
+		return false, errors.New("signature without key id")
+	}
+
+	key, ok := keyring.keys[kid]
+
+	if !ok {
+		return false, fmt.Errorf("unknown key id %s", kid)
+	}
+
+	return VerifyMessage(message, signature, &key.PrivateKey.PublicKey)
+}
+
+// KeyId derives a stable key id from the public key.
+func KeyId(key *ecdsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:])[:8], nil
+}
+
+// DecodeKey decodes a PEM encoded ECDSA key, which can be additionally base64 encoded.
+func DecodeKey(key string) (*ecdsa.PrivateKey, error) {
+	var b []byte
+	var err error
+	if !strings.Contains(key, "BEGIN") {
+		b, err = base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	} else {
+		b = []byte(key)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return nil, errors.New("Not a ECDSA Key")
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	ecKey, ok := privateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("Not a ECDSA Key")
+	}
+	return ecKey, nil
+}
+
+func SignMessage(message string, privateKey *ecdsa.PrivateKey) (string, error) {
+	hashed := sha256.Sum256([]byte(message))
+
+	r, s, err := ecdsa.Sign(rand.Reader, privateKey, hashed[:])
+	if err != nil {
+		return "", err
+	}
+
+	signatureDER, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(signatureDER), nil
+}
+
+func VerifyMessage(message string, signatureBase64 string, publicKey *ecdsa.PublicKey) (bool, error) {
+	hashed := sha256.Sum256([]byte(message))
+
+	signatureDER, err := base64.RawURLEncoding.DecodeString(signatureBase64)
+	if err != nil {
+		return false, err
+	}
+
+	var signature struct{ R, S *big.Int }
+	_, err = asn1.Unmarshal(signatureDER, &signature)
+	if err != nil {
+		return false, err
+	}
+
+	return ecdsa.Verify(publicKey, hashed[:], signature.R, signature.S), nil
+}
+
+// StaticSource returns the given encoded keys. The first key is the active one unless activeKeyId is set.
+// The keys are fixed for the lifetime of the source, a reload returns them unchanged.
+func StaticSource(activeKeyId string, encodedKeys ...string) Source {
+	return func() ([]Key, error) {
+		return decodeKeys(activeKeyId, encodedKeys)
+	}
+}
+
+// DirectorySource reads all *.pem files of the directory on every reload.
+func DirectorySource(activeKeyId string, directory string) Source {
+	return func() ([]Key, error) {
+		files, err := filepath.Glob(filepath.Join(directory, "*.pem"))
+
+		if err != nil {
+			return nil, err
+		}
+
+		encodedKeys := make([]string, 0)
+		for _, file := range files {
+			b, err := os.ReadFile(file)
+
+			if err != nil {
+				return nil, err
+			}
+
+			encodedKeys = append(encodedKeys, string(b))
+		}
+
+		if activeKeyId == "" && len(encodedKeys) > 1 {
+			return nil, errors.New("active key id must be configured for more than one key file")
+		}
+
+		return decodeKeys(activeKeyId, encodedKeys)
+	}
+}
+
+// Combine merges the keys of several sources. The first active key wins, all others become verify only.
+func Combine(sources ...Source) Source {
+	return func() ([]Key, error) {
+		res := make([]Key, 0)
+		active := false
+		for _, source := range sources {
+			keys, err := source()
+
+			if err != nil {
+				return nil, err
+			}
+
+			for _, key := range keys {
+				key.Active = key.Active && !active
+				active = active || key.Active
+				res = append(res, key)
+			}
+		}
+		return res, nil
+	}
+}
+
+func decodeKeys(activeKeyId string, encodedKeys []string) ([]Key, error) {
+	keys := make([]Key, 0)
+
+	for _, encoded := range encodedKeys {
+		if strings.TrimSpace(encoded) == "" {
+			continue
+		}
+
+		privateKey, err := DecodeKey(encoded)
+
+		if err != nil {
+			return nil, err
+		}
+
+		kid, err := KeyId(privateKey)
+
+		if err != nil {
+			return nil, err
+		}
+
+		active := kid == activeKeyId || (activeKeyId == "" && len(keys) == 0)
+		keys = append(keys, Key{Id: kid, PrivateKey: privateKey, Active: active})
+	}
+
+	return keys, nil
+}
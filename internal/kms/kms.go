@@ -0,0 +1,149 @@
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var ErrKeyNotFound = errors.New("signing key not found")
+
+// Backend signs with keys which it holds by name, so that the service never needs the private keys of
+// remote backends.
+type Backend interface {
+	// Algorithm returns the JWS algorithm of the key.
+	Algorithm(ctx context.Context, key string) (string, error)
+	// Sign returns the JWS signature of the signing input.
+	Sign(ctx context.Context, key string, input []byte) ([]byte, error)
+}
+
+// SignJwt signs the claims as compact JWS. The kid is set in the header if given.
+func SignJwt(ctx context.Context, backend Backend, key string, kid string, typ string, claims []byte) ([]byte, error) {
+	alg, err := backend.Algorithm(ctx, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	header := map[string]string{"alg": alg, "typ": typ}
+
+	if kid != "" {
+		header["kid"] = kid
+	}
+
+	h, err := json.Marshal(header)
+
+	if err != nil {
+		return nil, err
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	signature, err := backend.Sign(ctx, key, []byte(input))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(input + "." + base64.RawURLEncoding.EncodeToString(signature)), nil
+}
+
+// Algorithm returns the JWS algorithm used for a public key: EdDSA, ES256, ES384, ES512 or RS256.
+func Algorithm(key crypto.PublicKey) (string, error) {
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return "EdDSA", nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return "ES256", nil
+		case elliptic.P384():
+			return "ES384", nil
+		case elliptic.P521():
+			return "ES512", nil
+		}
+		return "", fmt.Errorf("unsupported curve %s", k.Curve.Params().Name)
+	case *rsa.PublicKey:
+		return "RS256", nil
+	}
+	return "", fmt.Errorf("unsupported key type %T", key)
+}
+
+var algorithmHashes = map[string]crypto.Hash{
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+	"RS256": crypto.SHA256,
+}
+
+// signWith creates a JWS signature with a crypto.Signer, like local keys or keys of a PKCS#11 token. ECDSA
+// signatures are converted from ASN.1 to the JWS form r || s.
+func signWith(signer crypto.Signer, input []byte) ([]byte, error) {
+	alg, err := Algorithm(signer.Public())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if alg == "EdDSA" {
+		return signer.Sign(rand.Reader, input, crypto.Hash(0))
+	}
+
+	hash := algorithmHashes[alg]
+	h := hash.New()
+	h.Write(input)
+
+	signature, err := signer.Sign(rand.Reader, h.Sum(nil), hash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if k, ok := signer.Public().(*ecdsa.PublicKey); ok {
+		var sig struct{ R, S *big.Int }
+
+		if _, err = asn1.Unmarshal(signature, &sig); err != nil {
+			return nil, err
+		}
+
+		size := (k.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		sig.R.FillBytes(signature[:size])
+		sig.S.FillBytes(signature[size:])
+	}
+
+	return signature, nil
+}
+
+// Backends selects the backend of a tenant. Tenants without backend sign with the signer service.
+type Backends struct {
+	defaultBackend Backend
+	tenants        map[string]Backend
+}
+
+func NewBackends(defaultBackend Backend, tenants map[string]Backend) *Backends {
+	return &Backends{defaultBackend: defaultBackend, tenants: tenants}
+}
+
+// ForTenant returns the backend of the tenant, or nil if the tenant signs with the signer service.
+func (b *Backends) ForTenant(tenantId string) Backend {
+	if b == nil {
+		return nil
+	}
+
+	if backend, ok := b.tenants[tenantId]; ok {
+		return backend
+	}
+
+	return b.defaultBackend
+}
@@ -0,0 +1,189 @@
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const requestObjectType = "oauth-authz-req+jwt"
+
+func verifyJwt(t *testing.T, token []byte, key crypto.PublicKey) map[string]string {
+	parts := strings.Split(string(token), ".")
+
+	if len(parts) != 3 {
+		t.Fatal("invalid jwt", string(token))
+	}
+
+	h, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	input := []byte(parts[0] + "." + parts[1])
+	digest := sha256.Sum256(input)
+
+	var header map[string]string
+	json.Unmarshal(h, &header)
+
+	valid := false
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(k, input, signature)
+	case *ecdsa.PublicKey:
+		valid = len(signature) == 64 && ecdsa.Verify(k, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:]))
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil
+	}
+
+	if !valid {
+		t.Error("invalid signature", header["alg"])
+	}
+
+	return header
+}
+
+func Test_LocalBackend(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	backend := NewLocalBackend(map[string]crypto.Signer{"ed": edKey, "ec": ecKey, "rsa": rsaKey}, "ec")
+	claims := []byte(`{"client_id":"did:web:example.com"}`)
+
+	for name, alg := range map[string]string{"ed": "EdDSA", "ec": "ES256", "rsa": "RS256", "": "ES256"} {
+		token, err := SignJwt(context.Background(), backend, name, "did:web:example.com#"+name, requestObjectType, claims)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signer, _ := backend.key(name)
+		header := verifyJwt(t, token, signer.Public())
+
+		if header["alg"] != alg || header["typ"] != requestObjectType || header["kid"] != "did:web:example.com#"+name {
+			t.Error("unexpected header", header)
+		}
+	}
+
+	if _, err := SignJwt(context.Background(), backend, "other", "", requestObjectType, claims); !errors.Is(err, ErrKeyNotFound) {
+		t.Error(err)
+	}
+}
+
+func Test_LoadLocalBackend(t *testing.T) {
+	directory := t.TempDir()
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(ecKey)
+	os.WriteFile(filepath.Join(directory, "key-1.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	jwk := `{"kty":"OKP","crv":"Ed25519","d":"` + base64.RawURLEncoding.EncodeToString(edKey.Seed()) + `"}`
+	os.WriteFile(filepath.Join(directory, "key-2.jwk"), []byte(jwk), 0600)
+	os.WriteFile(filepath.Join(directory, "README"), []byte("ignored"), 0600)
+
+	backend, err := LoadLocalBackend(directory, "key-1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if alg, _ := backend.Algorithm(context.Background(), ""); alg != "ES384" {
+		t.Error(alg)
+	}
+
+	token, err := SignJwt(context.Background(), backend, "key-2", "", requestObjectType, []byte("{}"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifyJwt(t, token, edKey.Public())
+
+	os.WriteFile(filepath.Join(directory, "key-3.jwk"), []byte(`{"kty":"OKP","crv":"Ed25519","x":"AA"}`), 0600)
+
+	if _, err = LoadLocalBackend(directory, ""); err == nil {
+		t.Error("public keys must not be loaded")
+	}
+}
+
+func Test_VaultBackend(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	lookups := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token1" || r.Header.Get("X-Vault-Namespace") != "tenant1" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/transit-t1/keys/request-objects":
+			lookups++
+			w.Write([]byte(`{"data":{"type":"ecdsa-p256"}}`))
+		case "/v1/transit-t1/sign/request-objects":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			input, _ := base64.StdEncoding.DecodeString(body["input"])
+
+			if body["hash_algorithm"] != "sha2-256" || body["marshaling_algorithm"] != "jws" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			signature, _ := signWith(ecKey, input)
+			w.Write([]byte(`{"data":{"signature":"vault:v1:` + base64.RawURLEncoding.EncodeToString(signature) + `"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	backend := NewVaultBackend(server.URL, "token1", "tenant1", "/transit-t1/", "request-objects", server.Client())
+
+	for i := 0; i < 2; i++ {
+		token, err := SignJwt(context.Background(), backend, "", "", requestObjectType, []byte("{}"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		verifyJwt(t, token, &ecKey.PublicKey)
+	}
+
+	if lookups != 1 {
+		t.Error("key type must be cached", lookups)
+	}
+
+	if _, err := backend.Algorithm(context.Background(), "other"); !errors.Is(err, ErrKeyNotFound) {
+		t.Error(err)
+	}
+}
+
+func Test_BackendsForTenant(t *testing.T) {
+	local := NewLocalBackend(nil, "")
+	backends := NewBackends(nil, map[string]Backend{"t1": local})
+
+	if backends.ForTenant("t1") != local || backends.ForTenant("t2") != nil {
+		t.Error("tenants without backend must use the signer service")
+	}
+
+	if (*Backends)(nil).ForTenant("t1") != nil {
+		t.Error("unset backends must use the signer service")
+	}
+}
@@ -0,0 +1,227 @@
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalBackend signs with private keys loaded from PEM or JWK files. It is meant for small deployments and
+// tests, the keys are held in memory.
+type LocalBackend struct {
+	keys       map[string]crypto.Signer
+	defaultKey string
+}
+
+func NewLocalBackend(keys map[string]crypto.Signer, defaultKey string) *LocalBackend {
+	return &LocalBackend{keys: keys, defaultKey: defaultKey}
+}
+
+// LoadLocalBackend loads the *.pem, *.jwk and *.json files of the directory. The file name without
+// extension is the key name.
+func LoadLocalBackend(directory string, defaultKey string) (*LocalBackend, error) {
+	entries, err := os.ReadDir(directory)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.Signer)
+
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+
+		if entry.IsDir() || (ext != ".pem" && ext != ".jwk" && ext != ".json") {
+			continue
+		}
+
+		b, err := os.ReadFile(filepath.Join(directory, entry.Name()))
+
+		if err != nil {
+			return nil, err
+		}
+
+		var key crypto.Signer
+
+		if ext == ".pem" {
+			key, err = ParsePemKey(b)
+		} else {
+			key, err = ParseJwkKey(b)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", entry.Name(), err)
+		}
+
+		keys[strings.TrimSuffix(entry.Name(), ext)] = key
+	}
+
+	return NewLocalBackend(keys, defaultKey), nil
+}
+
+func (b *LocalBackend) key(name string) (crypto.Signer, error) {
+	if name == "" {
+		name = b.defaultKey
+	}
+
+	key, ok := b.keys[name]
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, name)
+	}
+
+	return key, nil
+}
+
+func (b *LocalBackend) Algorithm(ctx context.Context, key string) (string, error) {
+	signer, err := b.key(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	return Algorithm(signer.Public())
+}
+
+func (b *LocalBackend) Sign(ctx context.Context, key string, input []byte) ([]byte, error) {
+	signer, err := b.key(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return signWith(signer, input)
+}
+
+// ParsePemKey parses PKCS#8, SEC 1 (EC) and PKCS#1 (RSA) private keys.
+func ParsePemKey(b []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(b)
+
+	if block == nil {
+		return nil, errors.New("no pem block found")
+	}
+
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+
+	return nil, fmt.Errorf("unsupported pem block %s", block.Type)
+}
+
+func decodeJwkInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+// ParseJwkKey parses private OKP (Ed25519), EC and RSA json web keys.
+func ParseJwkKey(b []byte) (crypto.Signer, error) {
+	var jwk struct {
+		Kty string `json:"kty"`
+		Crv string `json:"crv"`
+		D   string `json:"d"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		P   string `json:"p"`
+		Q   string `json:"q"`
+	}
+
+	if err := json.Unmarshal(b, &jwk); err != nil {
+		return nil, err
+	}
+
+	if jwk.D == "" {
+		return nil, errors.New("jwk is no private key")
+	}
+
+	switch jwk.Kty {
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+
+		seed, err := base64.RawURLEncoding.DecodeString(jwk.D)
+
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, errors.New("invalid ed25519 key")
+		}
+
+		return ed25519.NewKeyFromSeed(seed), nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[jwk.Crv]
+
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+
+		d, err := decodeJwkInt(jwk.D)
+
+		if err != nil {
+			return nil, err
+		}
+
+		key := &ecdsa.PrivateKey{D: d, PublicKey: ecdsa.PublicKey{Curve: curve}}
+		key.X, key.Y = curve.ScalarBaseMult(d.Bytes())
+		return key, nil
+	case "RSA":
+		var values [5]*big.Int
+
+		for i, s := range []string{jwk.N, jwk.E, jwk.D, jwk.P, jwk.Q} {
+			v, err := decodeJwkInt(s)
+
+			if err != nil {
+				return nil, err
+			}
+
+			values[i] = v
+		}
+
+		key := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: values[0], E: int(values[1].Int64())},
+			D:         values[2],
+			Primes:    []*big.Int{values[3], values[4]},
+		}
+
+		if err := key.Validate(); err != nil {
+			return nil, err
+		}
+
+		key.Precompute()
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+}
@@ -0,0 +1,11 @@
+//go:build !pkcs11
+
+package kms
+
+import "errors"
+
+// NewPkcs11Backend is only available in builds with the tag pkcs11, which adds the crypto11 library and
+// needs cgo.
+func NewPkcs11Backend(module string, tokenLabel string, pin string, defaultKey string) (Backend, error) {
+	return nil, errors.New("pkcs11 signing is not part of this build, build with -tags pkcs11")
+}
@@ -0,0 +1,79 @@
+//go:build pkcs11
+
+package kms
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"sync"
+
+	"github.com/ThalesIgnite/crypto11"
+)
+
+// Pkcs11Backend signs with key pairs of a PKCS#11 token, like SoftHSM or a hardware security module. Keys
+// are found by label.
+type Pkcs11Backend struct {
+	context    *crypto11.Context
+	defaultKey string
+
+	mutex sync.Mutex
+	keys  map[string]crypto.Signer
+}
+
+// NewPkcs11Backend loads the PKCS#11 module and logs in to the token with the label.
+func NewPkcs11Backend(module string, tokenLabel string, pin string, defaultKey string) (Backend, error) {
+	ctx, err := crypto11.Configure(&crypto11.Config{Path: module, TokenLabel: tokenLabel, Pin: pin})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pkcs11Backend{context: ctx, defaultKey: defaultKey, keys: make(map[string]crypto.Signer)}, nil
+}
+
+func (b *Pkcs11Backend) key(name string) (crypto.Signer, error) {
+	if name == "" {
+		name = b.defaultKey
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if key, ok := b.keys[name]; ok {
+		return key, nil
+	}
+
+	key, err := b.context.FindKeyPair(nil, []byte(name))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if key == nil {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, name)
+	}
+
+	b.keys[name] = key
+	return key, nil
+}
+
+func (b *Pkcs11Backend) Algorithm(ctx context.Context, key string) (string, error) {
+	signer, err := b.key(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	return Algorithm(signer.Public())
+}
+
+func (b *Pkcs11Backend) Sign(ctx context.Context, key string, input []byte) ([]byte, error) {
+	signer, err := b.key(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return signWith(signer, input)
+}
@@ -0,0 +1,195 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var vaultAlgorithms = map[string]string{
+	"ed25519":    "EdDSA",
+	"ecdsa-p256": "ES256",
+	"ecdsa-p384": "ES384",
+	"ecdsa-p521": "ES512",
+	"rsa-2048":   "RS256",
+	"rsa-3072":   "RS256",
+	"rsa-4096":   "RS256",
+}
+
+var vaultHashes = map[string]string{
+	"ES256": "sha2-256",
+	"ES384": "sha2-384",
+	"ES512": "sha2-512",
+	"RS256": "sha2-256",
+}
+
+// VaultBackend signs with the transit secrets engine of HashiCorp Vault. The keys never leave Vault.
+type VaultBackend struct {
+	address    string
+	token      string
+	namespace  string
+	path       string
+	defaultKey string
+	client     *http.Client
+
+	mutex      sync.Mutex
+	algorithms map[string]string
+}
+
+// NewVaultBackend creates a backend for the transit engine at the path, "transit" if empty.
+func NewVaultBackend(address string, token string, namespace string, path string, defaultKey string, client *http.Client) *VaultBackend {
+	if path == "" {
+		path = "transit"
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &VaultBackend{
+		address:    strings.TrimSuffix(address, "/"),
+		token:      token,
+		namespace:  namespace,
+		path:       strings.Trim(path, "/"),
+		defaultKey: defaultKey,
+		client:     client,
+		algorithms: make(map[string]string),
+	}
+}
+
+func (b *VaultBackend) name(key string) string {
+	if key == "" {
+		return b.defaultKey
+	}
+	return key
+}
+
+func (b *VaultBackend) Algorithm(ctx context.Context, key string) (string, error) {
+	key = b.name(key)
+
+	b.mutex.Lock()
+	alg, ok := b.algorithms[key]
+	b.mutex.Unlock()
+
+	if ok {
+		return alg, nil
+	}
+
+	var res struct {
+		Data struct {
+			Type string `json:"type"`
+		} `json:"data"`
+	}
+
+	if err := b.call(ctx, http.MethodGet, "/keys/"+key, nil, &res); err != nil {
+		return "", err
+	}
+
+	alg, ok = vaultAlgorithms[res.Data.Type]
+
+	if !ok {
+		return "", fmt.Errorf("unsupported vault key type %s", res.Data.Type)
+	}
+
+	b.mutex.Lock()
+	b.algorithms[key] = alg
+	b.mutex.Unlock()
+
+	return alg, nil
+}
+
+func (b *VaultBackend) Sign(ctx context.Context, key string, input []byte) ([]byte, error) {
+	alg, err := b.Algorithm(ctx, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{
+		"input":                base64.StdEncoding.EncodeToString(input),
+		"marshaling_algorithm": "jws",
+		"signature_algorithm":  "pkcs1v15",
+	}
+
+	if hash, ok := vaultHashes[alg]; ok {
+		body["hash_algorithm"] = hash
+	}
+
+	var res struct {
+		Data struct {
+			Signature string `json:"signature"`
+		} `json:"data"`
+	}
+
+	if err = b.call(ctx, http.MethodPost, "/sign/"+b.name(key), body, &res); err != nil {
+		return nil, err
+	}
+
+	// signatures have the form vault:v<version>:<signature>
+	parts := strings.SplitN(res.Data.Signature, ":", 3)
+
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid vault signature")
+	}
+
+	if strings.HasPrefix(alg, "ES") {
+		return base64.RawURLEncoding.DecodeString(parts[2])
+	}
+
+	return base64.StdEncoding.DecodeString(parts[2])
+}
+
+func (b *VaultBackend) call(ctx context.Context, method string, operation string, body interface{}, v interface{}) error {
+	var reader io.Reader
+
+	if body != nil {
+		buf, err := json.Marshal(body)
+
+		if err != nil {
+			return err
+		}
+
+		reader = bytes.NewReader(buf)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, b.address+"/v1/"+b.path+operation, reader)
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("X-Vault-Token", b.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	if b.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", b.namespace)
+	}
+
+	res, err := b.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: vault %s", ErrKeyNotFound, operation)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(io.LimitReader(res.Body, 1<<16)).Decode(&e)
+		return fmt.Errorf("vault responded %d: %s", res.StatusCode, strings.Join(e.Errors, ", "))
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
@@ -1,23 +1,98 @@
 package middleware
 
 import (
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/auth"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/services"
+	svcCommon "github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/services/common"
 )
 
-func VerifyId(env *common.Environment) gin.HandlerFunc {
+// VerifyId checks the id token of the route for the given purpose and replaces it by the presentation id.
+func VerifyId(env *common.Environment, purpose services.IdPurpose) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		id, b := ctx.Params.Get("id")
 		tenantId, b2 := ctx.Params.Get("tenantId")
 
 		if b && b2 {
-			allow, err := services.VerifyId(tenantId, id, env.GetConfig().SigningKey)
-			if !allow || err != nil {
+			token, err := services.VerifyIdToken(tenantId, id, purpose)
+			if err != nil {
+				env.GetLogger().Debug("Id token rejected.", "error", err.Error())
 				ctx.AbortWithStatus(401)
+				return
+			}
+			for i := range ctx.Params {
+				if ctx.Params[i].Key == "id" {
+					ctx.Params[i].Value = token.Id
+				}
 			}
 		} else {
 			ctx.AbortWithStatus(401)
 		}
 	}
 }
+
+const claimsKey = "claims"
+
+// Authenticate requires an OAuth2 bearer token. The token must carry the scope of the tenant of the path
+// and, for routes with a group, the scope of the group or of all groups.
+func Authenticate(env *common.Environment, authenticator auth.Authenticator) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		config := env.GetConfig().InternalAuth
+		token, found := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+
+		if !found || token == "" {
+			ctx.Header("WWW-Authenticate", "Bearer")
+			ctx.AbortWithStatus(401)
+			return
+		}
+
+		claims, err := authenticator.Authenticate(ctx.Request.Context(), token)
+
+		if err != nil {
+			env.GetLogger().Debug("Bearer token rejected.", "error", err.Error())
+			ctx.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			ctx.AbortWithStatus(401)
+			return
+		}
+
+		if tenantId, ok := ctx.Params.Get("tenantId"); ok && !claims.HasScope(config.TenantScopePrefix+tenantId) {
+			ctx.Header("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+			ctx.AbortWithStatus(403)
+			return
+		}
+
+		if groupId, ok := ctx.Params.Get("groupId"); ok && !claims.HasScope(config.GroupScopePrefix+groupId) && !claims.HasScope(config.GroupScopePrefix+"*") {
+			ctx.Header("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+			ctx.AbortWithStatus(403)
+			return
+		}
+
+		ctx.Set(claimsKey, claims)
+	}
+}
+
+// RejectAll rejects every request. It guards the routes whose authentication is not configured.
+func RejectAll() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Header("WWW-Authenticate", "Bearer")
+		ctx.AbortWithStatus(401)
+	}
+}
+
+// Actor records the caller of the route as actor of the audit trail. Authenticated callers are recorded
+// with their subject, all others with their address.
+func Actor(actorType string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		actor := svcCommon.Actor{
+			Type: actorType,
+			Id:   ctx.ClientIP(),
+		}
+		if claims, ok := ctx.Get(claimsKey); ok {
+			actor.Id = claims.(*auth.Claims).Subject
+		}
+		ctx.Request = ctx.Request.WithContext(svcCommon.ContextWithActor(ctx.Request.Context(), actor))
+	}
+}
@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+type AuditEntry struct {
+	Id        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	State     string    `json:"state"`
+	ActorType string    `json:"actorType"`
+	ActorId   string    `json:"actorId"`
+	Outcome   string    `json:"outcome,omitempty"`
+}
@@ -6,26 +6,144 @@ import (
 )
 
 type Config struct {
-	config.BaseConfig    `mapstructure:",squash"`
-	ServingPort          string `mapstructure:"servingPort" envconfig:"SERVINGPORT" default:"8080"`
-	PublicBasePath       string `mapstructure:"publicBasePath" envconfig:"PUBLICBASEPATH" default:"/api/presentation/proof"`
-	CassandraHosts       string `mapstructure:"cassandraHosts" envconfig:"CASSANDRAHOSTS"`
-	CassandraUser        string `mapstructure:"cassandraUser" envconfig:"CASSANDRAUSER"`
-	CassandraPassword    string `mapstructure:"cassandraPassword" envconfig:"CASSANDRAPASSWORD"`
-	Country              string `mapstructure:"country" envconfig:"COUNTRY"`
-	Region               string `mapstructure:"region" envconfig:"REGION"`
-	SigningKey           string `mapstructure:"signingKey" envconfig:"SIGNINGKEY"`
+	config.BaseConfig `mapstructure:",squash"`
+	ServingPort       string `mapstructure:"servingPort" envconfig:"SERVINGPORT" default:"8080"`
+	PublicBasePath    string `mapstructure:"publicBasePath" envconfig:"PUBLICBASEPATH" default:"/api/presentation/proof"`
+	CassandraHosts    string `mapstructure:"cassandraHosts" envconfig:"CASSANDRAHOSTS"`
+	CassandraUser     string `mapstructure:"cassandraUser" envconfig:"CASSANDRAUSER"`
+	CassandraPassword string `mapstructure:"cassandraPassword" envconfig:"CASSANDRAPASSWORD"`
+	Country           string `mapstructure:"country" envconfig:"COUNTRY"`
+	Region            string `mapstructure:"region" envconfig:"REGION"`
+	SigningKey        string `mapstructure:"signingKey" envconfig:"SIGNINGKEY"`
+	ExpiredRetention  int    `mapstructure:"expiredRetention" envconfig:"EXPIREDRETENTION" default:"3600"`
+	ExpirySweepSec    int    `mapstructure:"expirySweepSec" envconfig:"EXPIRYSWEEPSEC" default:"60"`
+	IdTokenTtl        int    `mapstructure:"idTokenTtl" envconfig:"IDTOKENTTL" default:"86400"`
+	InternalAuth      struct {
+		Enabled           bool   `mapstructure:"enabled" envconfig:"ENABLED"`
+		Insecure          bool   `mapstructure:"insecure" envconfig:"INSECURE"`
+		Mode              string `mapstructure:"mode" envconfig:"MODE" default:"jwks"`
+		JwksUrl           string `mapstructure:"jwksUrl" envconfig:"JWKSURL"`
+		IntrospectionUrl  string `mapstructure:"introspectionUrl" envconfig:"INTROSPECTIONURL"`
+		ClientId          string `mapstructure:"clientId" envconfig:"CLIENTID"`
+		ClientSecret      string `mapstructure:"clientSecret" envconfig:"CLIENTSECRET"`
+		Issuer            string `mapstructure:"issuer" envconfig:"ISSUER"`
+		Audience          string `mapstructure:"audience" envconfig:"AUDIENCE"`
+		TenantScopePrefix string `mapstructure:"tenantScopePrefix" envconfig:"TENANTSCOPEPREFIX" default:"tenant:"`
+		GroupScopePrefix  string `mapstructure:"groupScopePrefix" envconfig:"GROUPSCOPEPREFIX" default:"group:"`
+	} `mapstructure:"internalAuth"`
+	HttpClient struct {
+		TimeoutSec    int             `mapstructure:"timeoutSec" envconfig:"TIMEOUTSEC" default:"30"`
+		CaBundle      string          `mapstructure:"caBundle" envconfig:"CABUNDLE"`
+		Proxy         string          `mapstructure:"proxy" envconfig:"PROXY"`
+		Insecure      bool            `mapstructure:"insecure" envconfig:"INSECURE"`
+		RequestObject HttpDestination `mapstructure:"requestObject" envconfig:"REQUESTOBJECT"`
+		ResponseUri   HttpDestination `mapstructure:"responseUri" envconfig:"RESPONSEURI"`
+		Signer        HttpDestination `mapstructure:"signer" envconfig:"SIGNER"`
+		Policy        HttpDestination `mapstructure:"policy" envconfig:"POLICY"`
+		Context       HttpDestination `mapstructure:"context" envconfig:"CONTEXT"`
+		Did           HttpDestination `mapstructure:"did" envconfig:"DID"`
+		Schema        HttpDestination `mapstructure:"schema" envconfig:"SCHEMA"`
+		Webhook       HttpDestination `mapstructure:"webhook" envconfig:"WEBHOOK"`
+		Vault         HttpDestination `mapstructure:"vault" envconfig:"VAULT"`
+		Auth          HttpDestination `mapstructure:"auth" envconfig:"AUTH"`
+		Resolver      HttpDestination `mapstructure:"resolver" envconfig:"RESOLVER"`
+	} `mapstructure:"httpClient"`
+	Egress struct {
+		AllowHttp            bool                   `mapstructure:"allowHttp" envconfig:"ALLOWHTTP"`
+		AllowPrivateNetworks bool                   `mapstructure:"allowPrivateNetworks" envconfig:"ALLOWPRIVATENETWORKS"`
+		MaxResponseBytes     int64                  `mapstructure:"maxResponseBytes" envconfig:"MAXRESPONSEBYTES" default:"1048576"`
+		Allow                []string               `mapstructure:"allow" envconfig:"ALLOW"`
+		Deny                 []string               `mapstructure:"deny" envconfig:"DENY"`
+		Tenants              map[string]EgressHosts `mapstructure:"tenants" ignored:"true"`
+	} `mapstructure:"egress"`
+	Policy struct {
+		Engine            string `mapstructure:"engine" envconfig:"ENGINE" default:"opa"`
+		OpaUrl            string `mapstructure:"opaUrl" envconfig:"OPAURL"`
+		RegoDirectory     string `mapstructure:"regoDirectory" envconfig:"REGODIRECTORY"`
+		TimeoutSec        int    `mapstructure:"timeoutSec" envconfig:"TIMEOUTSEC" default:"5"`
+		ClientId          string `mapstructure:"clientId" envconfig:"CLIENTID"`
+		RequestObject     string `mapstructure:"requestObject" envconfig:"REQUESTOBJECT"`
+		Presentation      string `mapstructure:"presentation" envconfig:"PRESENTATION"`
+		DisclosureConsent string `mapstructure:"disclosureConsent" envconfig:"DISCLOSURECONSENT"`
+	} `mapstructure:"policy"`
+	Consent struct {
+		ApprovalTopic      string                  `mapstructure:"approvalTopic" envconfig:"APPROVALTOPIC"`
+		ApprovalTimeoutSec int                     `mapstructure:"approvalTimeoutSec" envconfig:"APPROVALTIMEOUTSEC" default:"120"`
+		Tenants            map[string]ConsentRules `mapstructure:"tenants" ignored:"true"`
+	} `mapstructure:"consent"`
+	Delivery struct {
+		InitialBackoffSec int    `mapstructure:"initialBackoffSec" envconfig:"INITIALBACKOFFSEC" default:"2"`
+		MaxBackoffSec     int    `mapstructure:"maxBackoffSec" envconfig:"MAXBACKOFFSEC" default:"300"`
+		DeadlineSec       int    `mapstructure:"deadlineSec" envconfig:"DEADLINESEC" default:"3600"`
+		PollIntervalSec   int    `mapstructure:"pollIntervalSec" envconfig:"POLLINTERVALSEC" default:"5"`
+		LeaseSec          int    `mapstructure:"leaseSec" envconfig:"LEASESEC" default:"60"`
+		DeadLetterTopic   string `mapstructure:"deadLetterTopic" envconfig:"DEADLETTERTOPIC"`
+	} `mapstructure:"delivery"`
+	RequestObjectVerification struct {
+		Algorithms    []string `mapstructure:"algorithms" envconfig:"ALGORITHMS" default:"ES256,ES384,ES512,EdDSA,PS256,RS256"`
+		Audiences     []string `mapstructure:"audiences" envconfig:"AUDIENCES" default:"https://self-issued.me/v2"`
+		RequireType   bool     `mapstructure:"requireType" envconfig:"REQUIRETYPE" default:"true"`
+		RequireExpiry bool     `mapstructure:"requireExpiry" envconfig:"REQUIREEXPIRY" default:"true"`
+		MaxAgeSec     int      `mapstructure:"maxAgeSec" envconfig:"MAXAGESEC" default:"3600"`
+		LeewaySec     int      `mapstructure:"leewaySec" envconfig:"LEEWAYSEC" default:"30"`
+		CaBundle      string   `mapstructure:"caBundle" envconfig:"CABUNDLE"`
+	} `mapstructure:"requestObjectVerification"`
+	DidResolver struct {
+		UniversalResolverUrl string `mapstructure:"universalResolverUrl" envconfig:"UNIVERSALRESOLVERURL"`
+		CacheTtlSec          int    `mapstructure:"cacheTtlSec" envconfig:"CACHETTLSEC" default:"300"`
+	} `mapstructure:"didResolver"`
+	CredentialChecks struct {
+		ClockSkewSec  int                               `mapstructure:"clockSkewSec" envconfig:"CLOCKSKEWSEC" default:"60"`
+		Validity      bool                              `mapstructure:"validity" envconfig:"VALIDITY"`
+		HolderBinding bool                              `mapstructure:"holderBinding" envconfig:"HOLDERBINDING"`
+		AllowBearer   bool                              `mapstructure:"allowBearer" envconfig:"ALLOWBEARER" default:"true"`
+		Tenants       map[string]CredentialCheckToggles `mapstructure:"tenants" ignored:"true"`
+	} `mapstructure:"credentialChecks"`
+	SchemaValidation struct {
+		Enabled     bool                         `mapstructure:"enabled" envconfig:"ENABLED"`
+		Enforce     bool                         `mapstructure:"enforce" envconfig:"ENFORCE"`
+		CacheTtlSec int                          `mapstructure:"cacheTtlSec" envconfig:"CACHETTLSEC" default:"3600"`
+		Registries  map[string]map[string]string `mapstructure:"registries" ignored:"true"`
+	} `mapstructure:"schemaValidation"`
+	ClaimExtraction struct {
+		Enabled bool `mapstructure:"enabled" envconfig:"ENABLED"`
+		// Minimize keeps only the extracted claims, the presentation is neither stored nor forwarded
+		Minimize bool `mapstructure:"minimize" envconfig:"MINIMIZE"`
+	} `mapstructure:"claimExtraction"`
+	RequestObjectSigning struct {
+		TtlSec  int                       `mapstructure:"ttlSec" envconfig:"TTLSEC" default:"300"`
+		Default SigningBackend            `mapstructure:"default" envconfig:"DEFAULT"`
+		Tenants map[string]SigningBackend `mapstructure:"tenants" ignored:"true"`
+	} `mapstructure:"requestObjectSigning"`
+	ProofVerification struct {
+		Native              bool              `mapstructure:"native" envconfig:"NATIVE"`
+		SignerFallback      bool              `mapstructure:"signerFallback" envconfig:"SIGNERFALLBACK" default:"true"`
+		AllowRemoteContexts bool              `mapstructure:"allowRemoteContexts" envconfig:"ALLOWREMOTECONTEXTS"`
+		ContextCacheTtlSec  int               `mapstructure:"contextCacheTtlSec" envconfig:"CONTEXTCACHETTLSEC" default:"86400"`
+		Contexts            map[string]string `mapstructure:"contexts" ignored:"true"`
+	} `mapstructure:"proofVerification"`
+	SigningKeys struct {
+		ActiveKeyId       string   `mapstructure:"activeKeyId" envconfig:"ACTIVEKEYID"`
+		VerifyOnly        []string `mapstructure:"verifyOnly" envconfig:"VERIFYONLY"`
+		Directory         string   `mapstructure:"directory" envconfig:"DIRECTORY"`
+		ReloadIntervalSec int      `mapstructure:"reloadIntervalSec" envconfig:"RELOADINTERVALSEC" default:"60"`
+	} `mapstructure:"signingKeys"`
 	ExternalPresentation struct {
 		Enabled             bool   `mapstructure:"enabled" envconfig:"ENABLED"`
 		AuthorizeEndpoint   string `mapstructure:"authorizeEndpoint" envconfig:"AUTHORIZEENDPOINT"`
 		RequestObjectPolicy string `mapstructure:"requestObjectPolicy" envconfig:"REQUESTOBJECTPOLICY"`
 		ClientIdPolicy      string `mapstructure:"clientIdPolicy"  envconfig:"CLIENTIDPOLICY"`
 		ClientUrlSchema     string `mapstructure:"clientUrlSchema" envconfig:"CLIENTURLSCHEMA" default:"https"`
+		MaxRedirects        int    `mapstructure:"maxRedirects" envconfig:"MAXREDIRECTS" default:"5"`
 	} `mapstructure:"externalpresentation"`
 	SignerService struct {
+		Transport             string `mapstructure:"transport" envconfig:"TRANSPORT" default:"http"`
 		PresentationVerifyUrl string `mapstructure:"presentationVerifyUrl" envconfig:"PRESENTATIONVERIFYURL"`
 		PresentationSignUrl   string `mapstructure:"presentationSignUrl" envconfig:"PRESENTATIONSIGNURL"`
 		SignerTopic           string `mapstructure:"signerTopic" envconfig:"SIGNERTOPIC"`
+		TimeoutSec            int    `mapstructure:"timeoutSec" envconfig:"TIMEOUTSEC" default:"30"`
+		Retries               int    `mapstructure:"retries" envconfig:"RETRIES" default:"2"`
+		RetryBackoffMs        int    `mapstructure:"retryBackoffMs" envconfig:"RETRYBACKOFFMS" default:"500"`
 	} `mapstructure:"signerService"`
 	Topics struct {
 		Authorization       string `mapstructure:"authorization" envconfig:"AUTHORIZATION"`
@@ -38,4 +156,104 @@ type Config struct {
 		Protocol cloudeventprovider.ProtocolType `mapstructure:"protocol" envconfig:"PROTOCOL" default:"nats"`
 		Nats     cloudeventprovider.NatsConfig   `mapstructure:"nats" envconfig:"NATS"`
 	} `mapstructure:"messaging"`
+	OneTimeUse struct {
+		Enabled                 bool `mapstructure:"enabled" envconfig:"ENABLED"`
+		MaxRequestObjectFetches int  `mapstructure:"maxRequestObjectFetches" envconfig:"MAXREQUESTOBJECTFETCHES" default:"1"`
+	} `mapstructure:"oneTimeUse"`
+	Audit struct {
+		Topic string `mapstructure:"topic" envconfig:"TOPIC"`
+	} `mapstructure:"audit"`
+	StatusEvents struct {
+		Enabled bool `mapstructure:"enabled" envconfig:"ENABLED" default:"true"`
+		// SchemaBaseUrl is prefixed to the event type for the dataschema of the events, empty omits it
+		SchemaBaseUrl string `mapstructure:"schemaBaseUrl" envconfig:"SCHEMABASEURL"`
+	} `mapstructure:"statusEvents"`
+	Webhooks struct {
+		Enabled           bool               `mapstructure:"enabled" envconfig:"ENABLED" default:"true"`
+		Events            []string           `mapstructure:"events" envconfig:"EVENTS" default:"presentation-received,presentation-rejected,expired"`
+		InitialBackoffSec int                `mapstructure:"initialBackoffSec" envconfig:"INITIALBACKOFFSEC" default:"5"`
+		MaxBackoffSec     int                `mapstructure:"maxBackoffSec" envconfig:"MAXBACKOFFSEC" default:"600"`
+		MaxAttempts       int                `mapstructure:"maxAttempts" envconfig:"MAXATTEMPTS" default:"10"`
+		PollIntervalSec   int                `mapstructure:"pollIntervalSec" envconfig:"POLLINTERVALSEC" default:"10"`
+		LeaseSec          int                `mapstructure:"leaseSec" envconfig:"LEASESEC" default:"60"`
+		LogTtlSec         int                `mapstructure:"logTtlSec" envconfig:"LOGTTLSEC" default:"604800"`
+		Tenants           map[string]Webhook `mapstructure:"tenants" ignored:"true"`
+	} `mapstructure:"webhooks"`
+	Encryption struct {
+		Enabled             bool   `mapstructure:"enabled" envconfig:"ENABLED"`
+		Provider            string `mapstructure:"provider" envconfig:"PROVIDER" default:"local"`
+		DataKeyRotationDays int    `mapstructure:"dataKeyRotationDays" envconfig:"DATAKEYROTATIONDAYS" default:"90"`
+		Local               struct {
+			KeyFile          string   `mapstructure:"keyFile" envconfig:"KEYFILE"`
+			PreviousKeyFiles []string `mapstructure:"previousKeyFiles" envconfig:"PREVIOUSKEYFILES"`
+		} `mapstructure:"local"`
+		Vault struct {
+			Address     string `mapstructure:"address" envconfig:"ADDRESS"`
+			Token       string `mapstructure:"token" envconfig:"TOKEN"`
+			TransitPath string `mapstructure:"transitPath" envconfig:"TRANSITPATH" default:"transit"`
+			KeyName     string `mapstructure:"keyName" envconfig:"KEYNAME"`
+		} `mapstructure:"vault"`
+	} `mapstructure:"encryption"`
+}
+
+// HttpDestination overrides the outbound http settings for one destination.
+type HttpDestination struct {
+	TimeoutSec int    `mapstructure:"timeoutSec" envconfig:"TIMEOUTSEC"`
+	CaBundle   string `mapstructure:"caBundle" envconfig:"CABUNDLE"`
+	ClientCert string `mapstructure:"clientCert" envconfig:"CLIENTCERT"`
+	ClientKey  string `mapstructure:"clientKey" envconfig:"CLIENTKEY"`
+	Proxy      string `mapstructure:"proxy" envconfig:"PROXY"`
+	Insecure   bool   `mapstructure:"insecure" envconfig:"INSECURE"`
+}
+
+type EgressHosts struct {
+	Allow []string `mapstructure:"allow"`
+	Deny  []string `mapstructure:"deny"`
+}
+
+// ConsentRules restrict the disclosure of a tenant's credentials. Entries match exactly or, ending with "*",
+// by prefix. Client ids are matched against the verifier, fields against the requested paths and names.
+type ConsentRules struct {
+	AllowedClients  []string `mapstructure:"allowedClients"`
+	DeniedClients   []string `mapstructure:"deniedClients"`
+	DeniedFields    []string `mapstructure:"deniedFields"`
+	ApprovalFields  []string `mapstructure:"approvalFields"`
+	RequireApproval bool     `mapstructure:"requireApproval"`
+}
+
+// CredentialCheckToggles override the credential checks for a tenant. Unset toggles keep the global setting.
+type CredentialCheckToggles struct {
+	Validity      *bool `mapstructure:"validity"`
+	HolderBinding *bool `mapstructure:"holderBinding"`
+	AllowBearer   *bool `mapstructure:"allowBearer"`
+}
+
+// SigningBackend signs request objects. Type signer uses the signer service, local, pkcs11 and vault sign
+// in process or with the key management system of the tenant.
+type SigningBackend struct {
+	Type       string `mapstructure:"type" envconfig:"TYPE" default:"signer"`
+	DefaultKey string `mapstructure:"defaultKey" envconfig:"DEFAULTKEY"`
+	Directory  string `mapstructure:"directory" envconfig:"DIRECTORY"`
+	Pkcs11     struct {
+		Module     string `mapstructure:"module" envconfig:"MODULE"`
+		TokenLabel string `mapstructure:"tokenLabel" envconfig:"TOKENLABEL"`
+		Pin        string `mapstructure:"pin" envconfig:"PIN"`
+	} `mapstructure:"pkcs11"`
+	Vault struct {
+		Address     string `mapstructure:"address" envconfig:"ADDRESS"`
+		Token       string `mapstructure:"token" envconfig:"TOKEN"`
+		Namespace   string `mapstructure:"namespace" envconfig:"NAMESPACE"`
+		TransitPath string `mapstructure:"transitPath" envconfig:"TRANSITPATH" default:"transit"`
+	} `mapstructure:"vault"`
+}
+
+// Webhook is the callback of a tenant. Signature hmac signs with the secret, jws with the key of the request
+// object signing backend of the tenant. Urls of single requests are only accepted with allowRequestUrls.
+type Webhook struct {
+	Url              string   `mapstructure:"url"`
+	Signature        string   `mapstructure:"signature"`
+	Secret           string   `mapstructure:"secret"`
+	Key              string   `mapstructure:"key"`
+	Events           []string `mapstructure:"events"`
+	AllowRequestUrls bool     `mapstructure:"allowRequestUrls"`
 }
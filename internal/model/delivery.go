@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending      DeliveryStatus = "pending"
+	DeliveryDelivered    DeliveryStatus = "delivered"
+	DeliveryDeadLettered DeliveryStatus = "dead-lettered"
+)
+
+// Delivery is the state of posting the presentation to the response uri of the verifier.
+type Delivery struct {
+	Status    DeliveryStatus `json:"status"`
+	Attempts  int            `json:"attempts"`
+	LastError string         `json:"lastError,omitempty"`
+	Deadline  time.Time      `json:"deadline"`
+}
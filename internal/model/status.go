@@ -8,4 +8,56 @@ const (
 	PresentationRejected             Status = "presentation-rejected"
 	PresentationRequested            Status = "presentation-requested"
 	PresentationRequestObjectFetched Status = "request-object-fetched"
+	PresentationVerificationFailed   Status = "verification-failed"
+	PresentationExpired              Status = "expired"
+	PresentationCancelled            Status = "cancelled"
 )
+
+// transitions lists for each state the states which can follow. States without entry are final.
+var transitions = map[Status][]Status{
+	PresentationRequested: {
+		PresentationRequestObjectFetched,
+		PresentationReceived,
+		PresentationTransmitted,
+		PresentationRejected,
+		PresentationVerificationFailed,
+		PresentationExpired,
+		PresentationCancelled,
+	},
+	PresentationRequestObjectFetched: {
+		PresentationRequestObjectFetched,
+		PresentationReceived,
+		PresentationRejected,
+		PresentationVerificationFailed,
+		PresentationExpired,
+		PresentationCancelled,
+	},
+}
+
+// CanTransitionTo reports whether the state machine allows the transition to the next state.
+func (s Status) CanTransitionTo(next Status) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFinal reports whether no further transition is allowed.
+func (s Status) IsFinal() bool {
+	return len(transitions[s]) == 0
+}
+
+// Predecessors returns all states from which the state can be reached.
+func (s Status) Predecessors() []Status {
+	var res = make([]Status, 0)
+	for from, next := range transitions {
+		for _, n := range next {
+			if n == s {
+				res = append(res, from)
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,47 @@
+package model
+
+import "testing"
+
+func Test_Transitions(t *testing.T) {
+	if !PresentationRequested.CanTransitionTo(PresentationRequestObjectFetched) {
+		t.Error()
+	}
+
+	if !PresentationRequestObjectFetched.CanTransitionTo(PresentationReceived) {
+		t.Error()
+	}
+
+	if PresentationReceived.CanTransitionTo(PresentationReceived) {
+		t.Error("replay must be rejected")
+	}
+
+	if PresentationReceived.CanTransitionTo(PresentationRequestObjectFetched) {
+		t.Error()
+	}
+
+	if PresentationTransmitted.CanTransitionTo(PresentationReceived) {
+		t.Error()
+	}
+
+	if !PresentationExpired.IsFinal() || PresentationRequested.IsFinal() {
+		t.Error()
+	}
+}
+
+func Test_Predecessors(t *testing.T) {
+	p := PresentationReceived.Predecessors()
+
+	if len(p) != 2 {
+		t.Error()
+	}
+
+	for _, s := range p {
+		if !s.CanTransitionTo(PresentationReceived) {
+			t.Error()
+		}
+	}
+
+	if len(PresentationRequested.Predecessors()) != 0 {
+		t.Error()
+	}
+}
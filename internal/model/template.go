@@ -0,0 +1,19 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// PresentationTemplate is a version of a presentation definition of a tenant, with {{name}} placeholders
+// which are filled by the parameters of a request.
+type PresentationTemplate struct {
+	Id          string                 `json:"id"`
+	Version     int                    `json:"version"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Definition  json.RawMessage        `json:"definition" swaggertype:"object"`
+	Defaults    map[string]interface{} `json:"defaults,omitempty"`
+	Parameters  []string               `json:"parameters"`
+	Created     time.Time              `json:"created"`
+}
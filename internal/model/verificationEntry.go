@@ -4,22 +4,38 @@ import (
 	"time"
 
 	"gitlab.eclipse.org/eclipse/xfsc/libraries/ssi/oid4vip/model/presentation"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/pkg/messaging"
 )
 
 type VerificationEntry struct {
-	Region                 string                              `json:"region"`
-	Country                string                              `json:"country"`
-	Id                     string                              `json:"id"`
-	RequestId              string                              `json:"requestId"`
-	GroupId                string                              `json:"groupid"`
-	PresentationDefinition presentation.PresentationDefinition `json:"presentationDefinition"`
-	Presentation           []interface{}                       `json:"presentation"`
-	RedirectUri            string                              `json:"redirectUri"`
-	ResponseUri            string                              `json:"responseUri"`
-	ResponseMode           string                              `json:"responseMode"`
-	ResponseType           string                              `json:"responseType"`
-	State                  string                              `json:"state"`
-	LastUpdateTimeStamp    time.Time                           `json:"lastUpdateTimeStamp"`
-	Nonce                  string                              `json:"nonce"`
-	ClientId               string                              `json:"clientId"`
+	Region                 string                                `json:"region"`
+	Country                string                                `json:"country"`
+	Id                     string                                `json:"id"`
+	RequestId              string                                `json:"requestId"`
+	GroupId                string                                `json:"groupid"`
+	PresentationDefinition presentation.PresentationDefinition   `json:"presentationDefinition"`
+	Presentation           []interface{}                         `json:"presentation"`
+	RedirectUri            string                                `json:"redirectUri"`
+	ResponseUri            string                                `json:"responseUri"`
+	ResponseMode           string                                `json:"responseMode"`
+	ResponseType           string                                `json:"responseType"`
+	State                  string                                `json:"state"`
+	LastUpdateTimeStamp    time.Time                             `json:"lastUpdateTimeStamp"`
+	Nonce                  string                                `json:"nonce"`
+	ClientId               string                                `json:"clientId"`
+	ExpiresAt              time.Time                             `json:"expiresAt"`
+	AccessToken            string                                `json:"accessToken,omitempty"`
+	Delivery               *Delivery                             `json:"delivery,omitempty"`
+	SchemaValidation       []SchemaResult                        `json:"schemaValidation,omitempty"`
+	Claims                 map[string]messaging.DescriptorClaims `json:"claims,omitempty"`
+	WebhookUrl             string                                `json:"webhookUrl,omitempty"`
+}
+
+// SchemaResult is the json schema validation of a credential of a received presentation.
+type SchemaResult struct {
+	Presentation int      `json:"presentation"`
+	Credential   int      `json:"credential"`
+	Schema       string   `json:"schema"`
+	Valid        bool     `json:"valid"`
+	Errors       []string `json:"errors,omitempty"`
 }
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+type WebhookStatus string
+
+const (
+	WebhookPending   WebhookStatus = "pending"
+	WebhookDelivered WebhookStatus = "delivered"
+	WebhookFailed    WebhookStatus = "failed"
+)
+
+// WebhookDelivery is an entry of the delivery log of the webhook callbacks of a presentation.
+type WebhookDelivery struct {
+	Id             string        `json:"id"`
+	PresentationId string        `json:"presentationId"`
+	EventType      string        `json:"eventType"`
+	Url            string        `json:"url"`
+	Status         WebhookStatus `json:"status"`
+	Attempts       int           `json:"attempts"`
+	NextAttempt    time.Time     `json:"nextAttempt"`
+	LastError      string        `json:"lastError,omitempty"`
+	LastStatusCode int           `json:"lastStatusCode,omitempty"`
+	Created        time.Time     `json:"created"`
+	DeliveredAt    time.Time     `json:"deliveredAt"`
+	ReplayOf       string        `json:"replayOf,omitempty"`
+	Payload        []byte        `json:"-"`
+}
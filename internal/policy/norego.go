@@ -0,0 +1,10 @@
+//go:build !rego
+
+package policy
+
+import "errors"
+
+// NewRegoEngine is only available in builds with the tag rego, which adds the OPA library.
+func NewRegoEngine(directory string) (Engine, error) {
+	return nil, errors.New("embedded rego evaluation is not part of this build, build with -tags rego")
+}
@@ -0,0 +1,71 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// OpaEngine evaluates policies with the data API of an OPA server (POST /v1/data/<path>).
+type OpaEngine struct {
+	url    string
+	client *http.Client
+}
+
+func NewOpaEngine(url string, client *http.Client) *OpaEngine {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &OpaEngine{
+		url:    strings.TrimSuffix(url, "/"),
+		client: client,
+	}
+}
+
+func (engine *OpaEngine) Evaluate(ctx context.Context, path string, input interface{}) (*Decision, error) {
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Result interface{} `json:"result"`
+	}
+
+	err = post(ctx, engine.client, engine.url+"/v1/data/"+strings.Trim(path, "/"), body, &res)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseDecision(res.Result), nil
+}
+
+func post(ctx context.Context, client *http.Client, url string, body []byte, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("policy %s responded %d", url, res.StatusCode)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
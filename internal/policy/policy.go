@@ -0,0 +1,93 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type Hook string
+
+const (
+	ClientId          Hook = "clientId"
+	RequestObject     Hook = "requestObject"
+	Presentation      Hook = "presentation"
+	DisclosureConsent Hook = "disclosureConsent"
+)
+
+// Engine evaluates the policy at path with the input.
+type Engine interface {
+	Evaluate(ctx context.Context, path string, input interface{}) (*Decision, error)
+}
+
+// Decision is the typed result of a policy. Reasons explain a denial, Result holds the complete policy result
+// for hooks which need further values. RequireApproval marks an allowing decision which needs the explicit
+// approval of the holder, it is only used by the disclosure consent.
+type Decision struct {
+	Allow           bool
+	RequireApproval bool
+	Reasons         []string
+	Result          map[string]interface{}
+}
+
+var ErrDenied = errors.New("policy forbids the processing")
+
+// Err returns nil for an allowing decision, otherwise ErrDenied with the reasons.
+func (decision *Decision) Err() error {
+	if decision.Allow {
+		return nil
+	}
+	if len(decision.Reasons) == 0 {
+		return ErrDenied
+	}
+	return fmt.Errorf("%w: %s", ErrDenied, strings.Join(decision.Reasons, ", "))
+}
+
+// ParseDecision reads a policy result. The result can be a boolean or an object with "allow" (boolean or
+// "true"), "requireApproval" (boolean) and "reasons" or "deny" (list of messages). A non empty "deny" denies
+// in any case. An undefined result denies.
+func ParseDecision(result interface{}) *Decision {
+	switch r := result.(type) {
+	case bool:
+		return &Decision{Allow: r}
+	case map[string]interface{}:
+		decision := &Decision{Result: r}
+
+		switch allow := r["allow"].(type) {
+		case bool:
+			decision.Allow = allow
+		case string:
+			decision.Allow = allow == "true"
+		}
+
+		decision.RequireApproval, _ = r["requireApproval"].(bool)
+		decision.Reasons = append(messages(r["reasons"]), messages(r["reason"])...)
+		deny := messages(r["deny"])
+
+		if len(deny) > 0 {
+			decision.Allow = false
+			decision.Reasons = append(decision.Reasons, deny...)
+		}
+
+		return decision
+	case nil:
+		return &Decision{Reasons: []string{"policy result undefined"}}
+	}
+
+	return &Decision{Reasons: []string{fmt.Sprintf("unsupported policy result %T", result)}}
+}
+
+func messages(v interface{}) []string {
+	switch m := v.(type) {
+	case string:
+		return []string{m}
+	case []interface{}:
+		res := make([]string, 0, len(m))
+		for _, e := range m {
+			res = append(res, fmt.Sprint(e))
+		}
+		return res
+	}
+	return nil
+}
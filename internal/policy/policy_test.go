@@ -0,0 +1,76 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_ParseDecision(t *testing.T) {
+	if !ParseDecision(true).Allow || ParseDecision(false).Allow {
+		t.Error()
+	}
+
+	if !ParseDecision(map[string]interface{}{"allow": true}).Allow {
+		t.Error("boolean allow must be accepted")
+	}
+
+	if !ParseDecision(map[string]interface{}{"allow": "true"}).Allow {
+		t.Error("string allow must be accepted")
+	}
+
+	d := ParseDecision(map[string]interface{}{"allow": true, "deny": []interface{}{"client not trusted"}})
+
+	if d.Allow || len(d.Reasons) != 1 || !errors.Is(d.Err(), ErrDenied) {
+		t.Error("deny must win")
+	}
+
+	if d := ParseDecision(map[string]interface{}{"allow": true, "requireApproval": true}); !d.Allow || !d.RequireApproval {
+		t.Error("approval must be read")
+	}
+
+	if ParseDecision(nil).Allow || ParseDecision("yes").Allow {
+		t.Error()
+	}
+}
+
+func Test_OpaEngine(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/data/verifier/client_id" {
+			w.WriteHeader(404)
+			return
+		}
+
+		var body struct {
+			Input map[string]interface{} `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		allowed := body.Input["clientId"] == "did:web:trusted"
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": map[string]interface{}{"allow": allowed, "reasons": []string{"checked"}}})
+	}))
+	defer srv.Close()
+
+	engine := NewOpaEngine(srv.URL+"/", nil)
+
+	d, err := engine.Evaluate(context.Background(), "verifier/client_id", map[string]interface{}{"clientId": "did:web:trusted"})
+
+	if err != nil || !d.Allow || d.Err() != nil {
+		t.Error(err)
+	}
+
+	d, err = engine.Evaluate(context.Background(), "verifier/client_id", map[string]interface{}{"clientId": "did:web:other"})
+
+	if err != nil || d.Allow || d.Reasons[0] != "checked" {
+		t.Error(err)
+	}
+
+	_, err = engine.Evaluate(context.Background(), "unknown", nil)
+
+	if err == nil {
+		t.Error()
+	}
+}
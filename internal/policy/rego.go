@@ -0,0 +1,75 @@
+//go:build rego
+
+package policy
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// RegoEngine evaluates the Rego policies of a directory in process, without an OPA server.
+type RegoEngine struct {
+	directory string
+	mutex     sync.Mutex
+	queries   map[string]rego.PreparedEvalQuery
+}
+
+func NewRegoEngine(directory string) (Engine, error) {
+	engine := &RegoEngine{
+		directory: directory,
+		queries:   make(map[string]rego.PreparedEvalQuery),
+	}
+
+	// compile once on startup to fail early for broken policies
+	_, err := rego.New(rego.Query("data"), rego.Load([]string{directory}, nil)).PrepareForEval(context.Background())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return engine, nil
+}
+
+func (engine *RegoEngine) query(ctx context.Context, path string) (rego.PreparedEvalQuery, error) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+
+	if query, ok := engine.queries[path]; ok {
+		return query, nil
+	}
+
+	query, err := rego.New(
+		rego.Query("data."+strings.ReplaceAll(strings.Trim(path, "/"), "/", ".")),
+		rego.Load([]string{engine.directory}, nil),
+	).PrepareForEval(ctx)
+
+	if err != nil {
+		return query, err
+	}
+
+	engine.queries[path] = query
+	return query, nil
+}
+
+func (engine *RegoEngine) Evaluate(ctx context.Context, path string, input interface{}) (*Decision, error) {
+	query, err := engine.query(ctx, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rs, err := query.Eval(ctx, rego.EvalInput(input))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
+		return ParseDecision(nil), nil
+	}
+
+	return ParseDecision(rs[0].Expressions[0].Value), nil
+}
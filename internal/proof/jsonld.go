@@ -0,0 +1,49 @@
+//go:build jsonld
+
+package proof
+
+import (
+	"context"
+
+	"github.com/piprate/json-gold/ld"
+)
+
+// jsonGold canonicalizes with the URDNA2015 algorithm of json-gold. Contexts are only resolved by the loader.
+type jsonGold struct {
+	loader *ContextLoader
+}
+
+func NewCanonicalizer(loader *ContextLoader) (Canonicalizer, error) {
+	return &jsonGold{loader: loader}, nil
+}
+
+func (c *jsonGold) Canonicalize(ctx context.Context, document map[string]interface{}) ([]byte, error) {
+	options := ld.NewJsonLdOptions("")
+	options.Algorithm = ld.AlgorithmURDNA2015
+	options.Format = "application/n-quads"
+	options.DocumentLoader = &documentLoader{ctx: ctx, loader: c.loader}
+
+	res, err := ld.NewJsonLdProcessor().Normalize(document, options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	nquads, _ := res.(string)
+	return []byte(nquads), nil
+}
+
+type documentLoader struct {
+	ctx    context.Context
+	loader *ContextLoader
+}
+
+func (l *documentLoader) LoadDocument(url string) (*ld.RemoteDocument, error) {
+	document, err := l.loader.Load(l.ctx, url)
+
+	if err != nil {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+
+	return &ld.RemoteDocument{DocumentURL: url, Document: document}, nil
+}
@@ -0,0 +1,113 @@
+package proof
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const maxContextBytes = 1 << 20
+
+type cachedContext struct {
+	document interface{}
+	expires  time.Time
+}
+
+// ContextLoader serves JSON-LD contexts. Pinned contexts are read once from local files and are never
+// fetched. Other contexts are only fetched if a client is given, and are cached for the ttl.
+type ContextLoader struct {
+	client *http.Client
+	ttl    time.Duration
+
+	mutex sync.Mutex
+	cache map[string]cachedContext
+}
+
+// NewContextLoader reads the pinned contexts, given as url to file. A nil client disables remote contexts.
+func NewContextLoader(pinned map[string]string, client *http.Client, ttl time.Duration) (*ContextLoader, error) {
+	loader := &ContextLoader{
+		client: client,
+		ttl:    ttl,
+		cache:  make(map[string]cachedContext),
+	}
+
+	for url, file := range pinned {
+		b, err := os.ReadFile(file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var document interface{}
+
+		if err = json.Unmarshal(b, &document); err != nil {
+			return nil, fmt.Errorf("context %s: %w", file, err)
+		}
+
+		loader.cache[url] = cachedContext{document: document}
+	}
+
+	return loader, nil
+}
+
+// Load returns the parsed context document of the url.
+func (loader *ContextLoader) Load(ctx context.Context, url string) (interface{}, error) {
+	loader.mutex.Lock()
+	cached, ok := loader.cache[url]
+	loader.mutex.Unlock()
+
+	if ok && (cached.expires.IsZero() || cached.expires.After(time.Now())) {
+		return cached.document, nil
+	}
+
+	if loader.client == nil {
+		return nil, fmt.Errorf("%w: context %s is not pinned", ErrUnsupported, url)
+	}
+
+	document, err := loader.fetch(ctx, url)
+
+	if err != nil {
+		return nil, err
+	}
+
+	loader.mutex.Lock()
+	loader.cache[url] = cachedContext{document: document, expires: time.Now().Add(loader.ttl)}
+	loader.mutex.Unlock()
+
+	return document, nil
+}
+
+func (loader *ContextLoader) fetch(ctx context.Context, url string) (interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/ld+json, application/json")
+
+	res, err := loader.client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("context %s responded %d", url, res.StatusCode)
+	}
+
+	var document interface{}
+
+	if err = json.NewDecoder(io.LimitReader(res.Body, maxContextBytes)).Decode(&document); err != nil {
+		return nil, fmt.Errorf("context %s: %w", url, err)
+	}
+
+	return document, nil
+}
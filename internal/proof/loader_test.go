@@ -0,0 +1,56 @@
+package proof
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_ContextLoader(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "v2.jsonld")
+	os.WriteFile(file, []byte(`{"@context":{"id":"@id"}}`), 0600)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"@context":{}}`))
+	}))
+	defer server.Close()
+
+	pinned := map[string]string{"https://www.w3.org/ns/credentials/v2": file}
+
+	loader, err := NewContextLoader(pinned, nil, time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if document, err := loader.Load(context.Background(), "https://www.w3.org/ns/credentials/v2"); err != nil || document == nil {
+		t.Error("pinned context must be served", err)
+	}
+
+	if _, err = loader.Load(context.Background(), server.URL); !errors.Is(err, ErrUnsupported) || calls != 0 {
+		t.Error("remote contexts must not be fetched without client", err)
+	}
+
+	loader, _ = NewContextLoader(pinned, server.Client(), time.Hour)
+
+	for i := 0; i < 2; i++ {
+		if _, err = loader.Load(context.Background(), server.URL); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if calls != 1 {
+		t.Error("remote context must be cached", calls)
+	}
+
+	if _, err = NewContextLoader(map[string]string{"https://example.com": filepath.Join(t.TempDir(), "missing")}, nil, time.Hour); err == nil {
+		t.Error("missing pinned file must fail")
+	}
+}
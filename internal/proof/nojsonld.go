@@ -0,0 +1,10 @@
+//go:build !jsonld
+
+package proof
+
+import "errors"
+
+// NewCanonicalizer is only available in builds with the tag jsonld, which adds the json-gold library.
+func NewCanonicalizer(loader *ContextLoader) (Canonicalizer, error) {
+	return nil, errors.New("json-ld canonicalization is not part of this build, build with -tags jsonld")
+}
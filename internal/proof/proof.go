@@ -0,0 +1,170 @@
+package proof
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidProof = errors.New("invalid proof")
+	// ErrUnsupported is returned for proofs which can not be verified in process, for example because of an
+	// unknown suite or an unresolvable verification method.
+	ErrUnsupported = errors.New("proof not supported")
+)
+
+// Canonicalizer returns the canonical N-Quads of a JSON-LD document (RDF Dataset Canonicalization).
+type Canonicalizer interface {
+	Canonicalize(ctx context.Context, document map[string]interface{}) ([]byte, error)
+}
+
+// KeyResolver returns the public key of a verification method, which must be authorized for the proof purpose.
+type KeyResolver func(ctx context.Context, verificationMethod string, purpose string) (crypto.PublicKey, error)
+
+// Verifier verifies Data Integrity and JWS proofs of JSON-LD documents in process.
+type Verifier struct {
+	canonicalizer Canonicalizer
+	resolveKey    KeyResolver
+}
+
+// NewVerifier creates a verifier. Without canonicalizer all proofs are unsupported.
+func NewVerifier(canonicalizer Canonicalizer, resolveKey KeyResolver) *Verifier {
+	return &Verifier{canonicalizer: canonicalizer, resolveKey: resolveKey}
+}
+
+// VerifyPresentation verifies the proofs of a presentation and of its embedded credentials. If challenge is
+// given, a challenge of the presentation proof must match it.
+func (v *Verifier) VerifyPresentation(ctx context.Context, presentation map[string]interface{}, challenge string) error {
+	if err := v.Verify(ctx, presentation, challenge); err != nil {
+		return err
+	}
+
+	credentials, ok := presentation["verifiableCredential"].([]interface{})
+
+	if !ok && presentation["verifiableCredential"] != nil {
+		credentials = []interface{}{presentation["verifiableCredential"]}
+	}
+
+	for i, c := range credentials {
+		credential, ok := c.(map[string]interface{})
+
+		if !ok {
+			return fmt.Errorf("%w: credential %d is no json-ld document", ErrUnsupported, i)
+		}
+
+		if err := v.Verify(ctx, credential, ""); err != nil {
+			return fmt.Errorf("credential %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// Verify verifies all proofs of a document.
+func (v *Verifier) Verify(ctx context.Context, document map[string]interface{}, challenge string) error {
+	var proofs []interface{}
+
+	switch p := document["proof"].(type) {
+	case map[string]interface{}:
+		proofs = []interface{}{p}
+	case []interface{}:
+		proofs = p
+	}
+
+	if len(proofs) == 0 {
+		return fmt.Errorf("%w: document has no proof", ErrInvalidProof)
+	}
+
+	unsecured := make(map[string]interface{}, len(document))
+	for k, e := range document {
+		if k != "proof" {
+			unsecured[k] = e
+		}
+	}
+
+	for _, p := range proofs {
+		proof, ok := p.(map[string]interface{})
+
+		if !ok {
+			return fmt.Errorf("%w: proof is no object", ErrInvalidProof)
+		}
+
+		if err := v.verifyProof(ctx, unsecured, proof, challenge); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (v *Verifier) verifyProof(ctx context.Context, document map[string]interface{}, proof map[string]interface{}, challenge string) error {
+	if c, ok := proof["challenge"]; ok && challenge != "" && c != challenge {
+		return fmt.Errorf("%w: challenge does not match", ErrInvalidProof)
+	}
+
+	if expires, ok := proof["expires"].(string); ok {
+		t, err := time.Parse(time.RFC3339, expires)
+
+		if err != nil || t.Before(time.Now()) {
+			return fmt.Errorf("%w: proof expired", ErrInvalidProof)
+		}
+	}
+
+	verify, err := suite(proof)
+
+	if err != nil {
+		return err
+	}
+
+	if v.canonicalizer == nil {
+		return fmt.Errorf("%w: json-ld canonicalization is not available", ErrUnsupported)
+	}
+
+	method, ok := proof["verificationMethod"].(string)
+
+	if !ok {
+		return fmt.Errorf("%w: verification method is no reference", ErrUnsupported)
+	}
+
+	purpose, _ := proof["proofPurpose"].(string)
+	key, err := v.resolveKey(ctx, method, purpose)
+
+	if err != nil {
+		return fmt.Errorf("%w: verification method %s: %w", ErrUnsupported, method, err)
+	}
+
+	return verify(ctx, v, document, proof, key)
+}
+
+// hashData hashes the canonical proof options and document, as all rdfc suites do. The proof options are the
+// proof without its value and with the context of the document.
+func (v *Verifier) hashData(ctx context.Context, document map[string]interface{}, proof map[string]interface{}, hash crypto.Hash) ([]byte, error) {
+	options := make(map[string]interface{}, len(proof))
+	for k, e := range proof {
+		if k != "proofValue" && k != "jws" && k != "signatureValue" {
+			options[k] = e
+		}
+	}
+
+	if _, ok := options["@context"]; !ok {
+		options["@context"] = document["@context"]
+	}
+
+	res := make([]byte, 0, 2*hash.Size())
+
+	for _, d := range []map[string]interface{}{options, document} {
+		canonical, err := v.canonicalizer.Canonicalize(ctx, d)
+
+		if err != nil {
+			return nil, err
+		}
+
+		h := hash.New()
+		h.Write(canonical)
+		res = h.Sum(res)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,168 @@
+package proof
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/did"
+)
+
+type jsonCanonicalizer struct{}
+
+func (jsonCanonicalizer) Canonicalize(ctx context.Context, document map[string]interface{}) ([]byte, error) {
+	return json.Marshal(document)
+}
+
+func resolveKey(ctx context.Context, verificationMethod string, purpose string) (crypto.PublicKey, error) {
+	return did.NewResolver(nil, nil, "", 0).ResolveKey(ctx, verificationMethod, purpose)
+}
+
+func didKey(t *testing.T, key crypto.PublicKey) string {
+	multikey, err := did.EncodeMultikey(key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return "did:key:" + multikey + "#" + multikey
+}
+
+func sign(t *testing.T, v *Verifier, document map[string]interface{}, proof map[string]interface{}, key crypto.Signer) {
+	switch key.Public().(type) {
+	case ed25519.PublicKey:
+		data, _ := v.hashData(context.Background(), document, proof, crypto.SHA256)
+
+		if proof["type"] == "JsonWebSignature2020" {
+			header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"EdDSA","b64":false,"crit":["b64"]}`))
+			signature, _ := key.Sign(rand.Reader, append([]byte(header+"."), data...), crypto.Hash(0))
+			proof["jws"] = header + ".." + base64.RawURLEncoding.EncodeToString(signature)
+		} else {
+			signature, _ := key.Sign(rand.Reader, data, crypto.Hash(0))
+			proof["proofValue"] = did.EncodeMultibase(signature)
+		}
+	case *ecdsa.PublicKey:
+		k := key.(*ecdsa.PrivateKey)
+		hash := curveHash(k.Curve)
+		data, _ := v.hashData(context.Background(), document, proof, hash)
+		h := hash.New()
+		h.Write(data)
+		r, s, _ := ecdsa.Sign(rand.Reader, k, h.Sum(nil))
+		size := (k.Curve.Params().BitSize + 7) / 8
+		signature := make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+		proof["proofValue"] = did.EncodeMultibase(signature)
+	}
+
+	document["proof"] = proof
+}
+
+func newPresentation() map[string]interface{} {
+	return map[string]interface{}{
+		"@context": []interface{}{"https://www.w3.org/ns/credentials/v2"},
+		"type":     []interface{}{"VerifiablePresentation"},
+		"holder":   "did:example:holder",
+	}
+}
+
+func Test_VerifySuites(t *testing.T) {
+	v := NewVerifier(jsonCanonicalizer{}, resolveKey)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	p256Key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384Key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+
+	tests := []struct {
+		name  string
+		key   crypto.Signer
+		proof map[string]interface{}
+	}{
+		{"Ed25519Signature2020", edKey, map[string]interface{}{"type": "Ed25519Signature2020"}},
+		{"eddsa-rdfc-2022", edKey, map[string]interface{}{"type": "DataIntegrityProof", "cryptosuite": "eddsa-rdfc-2022"}},
+		{"ecdsa-rdfc-2019 P-256", p256Key, map[string]interface{}{"type": "DataIntegrityProof", "cryptosuite": "ecdsa-rdfc-2019"}},
+		{"ecdsa-rdfc-2019 P-384", p384Key, map[string]interface{}{"type": "DataIntegrityProof", "cryptosuite": "ecdsa-rdfc-2019"}},
+		{"JsonWebSignature2020", edKey, map[string]interface{}{"type": "JsonWebSignature2020"}},
+	}
+
+	for _, test := range tests {
+		presentation := newPresentation()
+		test.proof["verificationMethod"] = didKey(t, test.key.Public())
+		test.proof["proofPurpose"] = "authentication"
+		test.proof["challenge"] = "nonce1"
+		sign(t, v, presentation, test.proof, test.key)
+
+		if err := v.VerifyPresentation(context.Background(), presentation, "nonce1"); err != nil {
+			t.Error(test.name, err)
+		}
+
+		presentation["holder"] = "did:example:other"
+
+		if err := v.VerifyPresentation(context.Background(), presentation, "nonce1"); !errors.Is(err, ErrInvalidProof) {
+			t.Error(test.name, "tampered presentation must be invalid", err)
+		}
+	}
+}
+
+func Test_VerifyChallengeAndCredentials(t *testing.T) {
+	v := NewVerifier(jsonCanonicalizer{}, resolveKey)
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	method := didKey(t, key.Public())
+
+	credential := map[string]interface{}{"@context": []interface{}{"https://www.w3.org/ns/credentials/v2"}, "issuer": "did:example:issuer"}
+	sign(t, v, credential, map[string]interface{}{"type": "Ed25519Signature2020", "verificationMethod": method}, key)
+
+	presentation := newPresentation()
+	presentation["verifiableCredential"] = []interface{}{credential}
+	sign(t, v, presentation, map[string]interface{}{"type": "Ed25519Signature2020", "verificationMethod": method, "challenge": "nonce1"}, key)
+
+	if err := v.VerifyPresentation(context.Background(), presentation, "nonce1"); err != nil {
+		t.Error(err)
+	}
+
+	if err := v.VerifyPresentation(context.Background(), presentation, "nonce2"); !errors.Is(err, ErrInvalidProof) {
+		t.Error("challenge mismatch must be invalid", err)
+	}
+
+	credential["issuer"] = "did:example:other"
+
+	if err := v.VerifyPresentation(context.Background(), presentation, "nonce1"); !errors.Is(err, ErrInvalidProof) {
+		t.Error("tampered credential must be invalid", err)
+	}
+}
+
+func Test_VerifyUnsupported(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	v := NewVerifier(jsonCanonicalizer{}, resolveKey)
+
+	presentation := newPresentation()
+	presentation["proof"] = map[string]interface{}{"type": "BbsBlsSignature2020", "verificationMethod": didKey(t, key.Public())}
+
+	if err := v.Verify(context.Background(), presentation, ""); !errors.Is(err, ErrUnsupported) {
+		t.Error("unknown suite must be unsupported", err)
+	}
+
+	presentation["proof"] = map[string]interface{}{"type": "Ed25519Signature2020", "verificationMethod": "did:example:123#key-1", "proofValue": "z1"}
+
+	if err := v.Verify(context.Background(), presentation, ""); !errors.Is(err, ErrUnsupported) {
+		t.Error("unresolvable method must be unsupported", err)
+	}
+
+	presentation["proof"] = map[string]interface{}{"type": "Ed25519Signature2020", "verificationMethod": didKey(t, key.Public())}
+
+	if err := NewVerifier(nil, resolveKey).Verify(context.Background(), presentation, ""); !errors.Is(err, ErrUnsupported) {
+		t.Error("missing canonicalizer must be unsupported", err)
+	}
+
+	delete(presentation, "proof")
+
+	if err := v.Verify(context.Background(), presentation, ""); !errors.Is(err, ErrInvalidProof) {
+		t.Error("missing proof must be invalid", err)
+	}
+}
@@ -0,0 +1,221 @@
+package proof
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/did"
+)
+
+type verifyFunc func(ctx context.Context, v *Verifier, document map[string]interface{}, proof map[string]interface{}, key crypto.PublicKey) error
+
+func suite(proof map[string]interface{}) (verifyFunc, error) {
+	switch proof["type"] {
+	case "Ed25519Signature2020":
+		return verifyEddsa, nil
+	case "JsonWebSignature2020":
+		return verifyJws, nil
+	case "DataIntegrityProof":
+		switch proof["cryptosuite"] {
+		case "eddsa-rdfc-2022":
+			return verifyEddsa, nil
+		case "ecdsa-rdfc-2019":
+			return verifyEcdsa, nil
+		}
+		return nil, fmt.Errorf("%w: cryptosuite %v", ErrUnsupported, proof["cryptosuite"])
+	}
+
+	return nil, fmt.Errorf("%w: proof type %v", ErrUnsupported, proof["type"])
+}
+
+func proofValue(proof map[string]interface{}) ([]byte, error) {
+	value, ok := proof["proofValue"].(string)
+
+	if !ok {
+		return nil, fmt.Errorf("%w: proof value missing", ErrInvalidProof)
+	}
+
+	b, err := did.DecodeMultibase(value)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProof, err)
+	}
+
+	return b, nil
+}
+
+func verifyEddsa(ctx context.Context, v *Verifier, document map[string]interface{}, proof map[string]interface{}, key crypto.PublicKey) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+
+	if !ok {
+		return fmt.Errorf("%w: key type %T for eddsa", ErrInvalidProof, key)
+	}
+
+	signature, err := proofValue(proof)
+
+	if err != nil {
+		return err
+	}
+
+	data, err := v.hashData(ctx, document, proof, crypto.SHA256)
+
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(publicKey, data, signature) {
+		return fmt.Errorf("%w: signature mismatch", ErrInvalidProof)
+	}
+
+	return nil
+}
+
+func curveHash(curve elliptic.Curve) crypto.Hash {
+	if curve == elliptic.P384() {
+		return crypto.SHA384
+	}
+	return crypto.SHA256
+}
+
+func verifyEcdsa(ctx context.Context, v *Verifier, document map[string]interface{}, proof map[string]interface{}, key crypto.PublicKey) error {
+	publicKey, ok := key.(*ecdsa.PublicKey)
+
+	if !ok {
+		return fmt.Errorf("%w: key type %T for ecdsa", ErrInvalidProof, key)
+	}
+
+	signature, err := proofValue(proof)
+
+	if err != nil {
+		return err
+	}
+
+	hash := curveHash(publicKey.Curve)
+	data, err := v.hashData(ctx, document, proof, hash)
+
+	if err != nil {
+		return err
+	}
+
+	return verifyEcdsaSignature(publicKey, hash, data, signature)
+}
+
+// verifyEcdsaSignature checks a signature in the IEEE P1363 form (r || s).
+func verifyEcdsaSignature(key *ecdsa.PublicKey, hash crypto.Hash, data []byte, signature []byte) error {
+	size := (key.Curve.Params().BitSize + 7) / 8
+
+	if len(signature) != 2*size {
+		return fmt.Errorf("%w: invalid signature length", ErrInvalidProof)
+	}
+
+	h := hash.New()
+	h.Write(data)
+
+	r := new(big.Int).SetBytes(signature[:size])
+	s := new(big.Int).SetBytes(signature[size:])
+
+	if !ecdsa.Verify(key, h.Sum(nil), r, s) {
+		return fmt.Errorf("%w: signature mismatch", ErrInvalidProof)
+	}
+
+	return nil
+}
+
+var jwsCurves = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(),
+	"ES384": elliptic.P384(),
+}
+
+// verifyJws checks a detached JWS with unencoded payload (RFC 7797), whose payload is the hash data.
+func verifyJws(ctx context.Context, v *Verifier, document map[string]interface{}, proof map[string]interface{}, key crypto.PublicKey) error {
+	jws, ok := proof["jws"].(string)
+
+	if !ok {
+		return fmt.Errorf("%w: jws missing", ErrInvalidProof)
+	}
+
+	parts := strings.Split(jws, ".")
+
+	if len(parts) != 3 || parts[1] != "" {
+		return fmt.Errorf("%w: jws is not detached", ErrInvalidProof)
+	}
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidProof, err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidProof, err)
+	}
+
+	var header struct {
+		Alg  string   `json:"alg"`
+		B64  *bool    `json:"b64"`
+		Crit []string `json:"crit"`
+	}
+
+	if err = json.Unmarshal(headerBytes, &header); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidProof, err)
+	}
+
+	if header.B64 == nil || *header.B64 || len(header.Crit) != 1 || header.Crit[0] != "b64" {
+		return fmt.Errorf("%w: jws payload must be unencoded", ErrInvalidProof)
+	}
+
+	data, err := v.hashData(ctx, document, proof, crypto.SHA256)
+
+	if err != nil {
+		return err
+	}
+
+	input := append([]byte(parts[0]+"."), data...)
+
+	switch header.Alg {
+	case "EdDSA":
+		if k, ok := key.(ed25519.PublicKey); ok {
+			if !ed25519.Verify(k, input, signature) {
+				return fmt.Errorf("%w: signature mismatch", ErrInvalidProof)
+			}
+			return nil
+		}
+	case "ES256", "ES384":
+		if k, ok := key.(*ecdsa.PublicKey); ok && k.Curve == jwsCurves[header.Alg] {
+			return verifyEcdsaSignature(k, curveHash(k.Curve), input, signature)
+		}
+	case "PS256", "RS256":
+		if k, ok := key.(*rsa.PublicKey); ok {
+			digest := crypto.SHA256.New()
+			digest.Write(input)
+
+			if header.Alg == "PS256" {
+				err = rsa.VerifyPSS(k, crypto.SHA256, digest.Sum(nil), signature, nil)
+			} else {
+				err = rsa.VerifyPKCS1v15(k, crypto.SHA256, digest.Sum(nil), signature)
+			}
+
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalidProof, err)
+			}
+			return nil
+		}
+	default:
+		return fmt.Errorf("%w: jws algorithm %s", ErrUnsupported, header.Alg)
+	}
+
+	return fmt.Errorf("%w: key type %T does not match algorithm %s", ErrInvalidProof, key, header.Alg)
+}
@@ -0,0 +1,86 @@
+package requestobject
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"math/big"
+)
+
+var hashes = map[string]crypto.Hash{
+	"256": crypto.SHA256,
+	"384": crypto.SHA384,
+	"512": crypto.SHA512,
+}
+
+var curves = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(),
+	"ES384": elliptic.P384(),
+	"ES512": elliptic.P521(),
+}
+
+// verifySignature checks a JWS signature. The key type must match the algorithm.
+func verifySignature(alg string, key crypto.PublicKey, input []byte, signature []byte) error {
+	if alg == "EdDSA" {
+		k, ok := key.(ed25519.PublicKey)
+
+		if !ok {
+			return invalid("key type %T does not match algorithm %s", key, alg)
+		}
+
+		if !ed25519.Verify(k, input, signature) {
+			return invalid("signature mismatch")
+		}
+
+		return nil
+	}
+
+	if len(alg) != 5 {
+		return invalid("algorithm %s is not supported", alg)
+	}
+
+	hash, ok := hashes[alg[2:]]
+
+	if !ok {
+		return invalid("algorithm %s is not supported", alg)
+	}
+
+	h := hash.New()
+	h.Write(input)
+	digest := h.Sum(nil)
+
+	valid := false
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+
+		if alg[:2] != "ES" || curves[alg] != k.Curve {
+			return invalid("key type %T does not match algorithm %s", key, alg)
+		}
+
+		valid = len(signature) == 2*size &&
+			ecdsa.Verify(k, digest, new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:]))
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			valid = rsa.VerifyPKCS1v15(k, hash, digest, signature) == nil
+		case "PS":
+			valid = rsa.VerifyPSS(k, hash, digest, signature, nil) == nil
+		default:
+			return invalid("key type %T does not match algorithm %s", key, alg)
+		}
+	default:
+		return invalid("key type %T does not match algorithm %s", key, alg)
+	}
+
+	if !valid {
+		return invalid("signature mismatch")
+	}
+
+	return nil
+}
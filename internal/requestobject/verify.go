@@ -0,0 +1,290 @@
+package requestobject
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/did"
+)
+
+// ErrInvalidRequestObject is returned for request objects which are forged, expired or not meant for
+// this wallet.
+var ErrInvalidRequestObject = errors.New("invalid request object")
+
+// Type is the JWT type of signed authorization requests (RFC 9101).
+const Type = "oauth-authz-req+jwt"
+
+// Options configure the checks of request objects.
+type Options struct {
+	// Algorithms allowed to sign, "none" is never allowed.
+	Algorithms []string
+	// Audiences of which the aud claim must contain one. Empty disables the check.
+	Audiences []string
+	// RequireType requires the header typ oauth-authz-req+jwt.
+	RequireType bool
+	// RequireExpiry requires the exp claim.
+	RequireExpiry bool
+	// MaxAge limits the age by iat, zero disables the limit.
+	MaxAge time.Duration
+	Leeway time.Duration
+	// Roots verify x5c certificate chains, nil uses the system roots.
+	Roots *x509.CertPool
+}
+
+type header struct {
+	Alg string   `json:"alg"`
+	Typ string   `json:"typ"`
+	Kid string   `json:"kid"`
+	X5c []string `json:"x5c"`
+}
+
+type claims struct {
+	ClientId       string          `json:"client_id"`
+	ClientIdScheme string          `json:"client_id_scheme"`
+	Audience       json.RawMessage `json:"aud"`
+	Exp            *float64        `json:"exp"`
+	Nbf            *float64        `json:"nbf"`
+	Iat            *float64        `json:"iat"`
+}
+
+// Verifier verifies the signature and claims of request objects. The key is resolved from the DID of the
+// client_id, or taken from the x5c certificate which must name the client_id.
+type Verifier struct {
+	resolver *did.Resolver
+	options  Options
+	now      func() time.Time
+}
+
+func NewVerifier(resolver *did.Resolver, options Options) *Verifier {
+	return &Verifier{resolver: resolver, options: options, now: time.Now}
+}
+
+func invalid(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: "+format, append([]interface{}{ErrInvalidRequestObject}, a...)...)
+}
+
+// Verify returns the claims of a verified compact JWS.
+func (v *Verifier) Verify(ctx context.Context, token string) ([]byte, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+
+	if len(parts) != 3 {
+		return nil, invalid("no compact jws")
+	}
+
+	var h header
+	var c claims
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+
+	if err == nil {
+		err = json.Unmarshal(headerBytes, &h)
+	}
+
+	if err != nil {
+		return nil, invalid("header: %s", err)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+
+	if err == nil {
+		err = json.Unmarshal(payload, &c)
+	}
+
+	if err != nil {
+		return nil, invalid("claims: %s", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+
+	if err != nil {
+		return nil, invalid("signature: %s", err)
+	}
+
+	if h.Alg == "" || strings.EqualFold(h.Alg, "none") || !slices.Contains(v.options.Algorithms, h.Alg) {
+		return nil, invalid("algorithm %q is not allowed", h.Alg)
+	}
+
+	if v.options.RequireType && h.Typ != Type {
+		return nil, invalid("type %q is not %s", h.Typ, Type)
+	}
+
+	key, err := v.clientKey(ctx, h, c)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = verifySignature(h.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	if err = v.checkClaims(c); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// clientKey returns the key of the client, which must be bound to the client_id.
+func (v *Verifier) clientKey(ctx context.Context, h header, c claims) (crypto.PublicKey, error) {
+	if c.ClientId == "" {
+		return nil, invalid("client_id missing")
+	}
+
+	switch {
+	case c.ClientIdScheme == "did" || (c.ClientIdScheme == "" && strings.HasPrefix(c.ClientId, "did:")):
+		return v.didKey(ctx, h, c)
+	case c.ClientIdScheme == "x509_san_dns" || c.ClientIdScheme == "x509_san_uri":
+		return v.certificateKey(h, c)
+	}
+
+	return nil, invalid("client_id_scheme %q is not supported for signed requests", c.ClientIdScheme)
+}
+
+func (v *Verifier) didKey(ctx context.Context, h header, c claims) (crypto.PublicKey, error) {
+	if h.Kid == "" {
+		return nil, invalid("kid missing")
+	}
+
+	kid := h.Kid
+
+	if strings.HasPrefix(kid, "#") {
+		kid = c.ClientId + kid
+	}
+
+	controller, _, _ := strings.Cut(kid, "#")
+
+	if controller != c.ClientId {
+		return nil, invalid("kid %s does not belong to client_id %s", h.Kid, c.ClientId)
+	}
+
+	if v.resolver == nil {
+		return nil, invalid("did resolution is not available")
+	}
+
+	key, err := v.resolver.ResolveKey(ctx, kid, "")
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: kid %s could not be resolved: %w", ErrInvalidRequestObject, kid, err)
+	}
+
+	return key, nil
+}
+
+func (v *Verifier) certificateKey(h header, c claims) (crypto.PublicKey, error) {
+	if len(h.X5c) == 0 {
+		return nil, invalid("x5c missing for client_id_scheme %s", c.ClientIdScheme)
+	}
+
+	var certificates []*x509.Certificate
+
+	for _, encoded := range h.X5c {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+
+		if err != nil {
+			return nil, invalid("x5c: %s", err)
+		}
+
+		certificate, err := x509.ParseCertificate(der)
+
+		if err != nil {
+			return nil, invalid("x5c: %s", err)
+		}
+
+		certificates = append(certificates, certificate)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+
+	leaf := certificates[0]
+
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         v.options.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   v.now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+
+	if err != nil {
+		return nil, invalid("x5c: %s", err)
+	}
+
+	if c.ClientIdScheme == "x509_san_dns" {
+		if err = leaf.VerifyHostname(c.ClientId); err != nil || strings.Contains(c.ClientId, "/") {
+			return nil, invalid("certificate has no dns name %s", c.ClientId)
+		}
+		return leaf.PublicKey, nil
+	}
+
+	for _, uri := range leaf.URIs {
+		if uri.String() == c.ClientId {
+			return leaf.PublicKey, nil
+		}
+	}
+
+	return nil, invalid("certificate has no uri %s", c.ClientId)
+}
+
+func (v *Verifier) checkClaims(c claims) error {
+	now := v.now()
+	leeway := v.options.Leeway
+
+	if c.Exp == nil && v.options.RequireExpiry {
+		return invalid("exp missing")
+	}
+
+	if c.Exp != nil && now.After(time.Unix(int64(*c.Exp), 0).Add(leeway)) {
+		return invalid("expired")
+	}
+
+	if c.Nbf != nil && now.Before(time.Unix(int64(*c.Nbf), 0).Add(-leeway)) {
+		return invalid("not yet valid")
+	}
+
+	if c.Iat != nil {
+		iat := time.Unix(int64(*c.Iat), 0)
+
+		if now.Before(iat.Add(-leeway)) {
+			return invalid("issued in the future")
+		}
+
+		if v.options.MaxAge > 0 && now.After(iat.Add(v.options.MaxAge+leeway)) {
+			return invalid("issued more than %s ago", v.options.MaxAge)
+		}
+	}
+
+	if len(v.options.Audiences) == 0 {
+		return nil
+	}
+
+	var audiences []string
+
+	if len(c.Audience) > 0 {
+		var single string
+
+		if json.Unmarshal(c.Audience, &single) == nil {
+			audiences = []string{single}
+		} else if err := json.Unmarshal(c.Audience, &audiences); err != nil {
+			return invalid("aud: %s", err)
+		}
+	}
+
+	for _, audience := range audiences {
+		if slices.Contains(v.options.Audiences, audience) {
+			return nil
+		}
+	}
+
+	return invalid("aud %v is not this wallet", audiences)
+}
@@ -0,0 +1,190 @@
+package requestobject
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/did"
+)
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, header map[string]interface{}, claims map[string]interface{}) string {
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(input))
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func options() Options {
+	return Options{
+		Algorithms:    []string{"ES256", "EdDSA"},
+		Audiences:     []string{"https://self-issued.me/v2"},
+		RequireType:   true,
+		RequireExpiry: true,
+		MaxAge:        time.Hour,
+		Leeway:        time.Second,
+	}
+}
+
+func Test_VerifyDid(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	multikey, _ := did.EncodeMultikey(&key.PublicKey)
+	clientId := "did:key:" + multikey
+	verifier := NewVerifier(did.NewResolver(nil, nil, "", time.Minute), options())
+
+	header := func() map[string]interface{} {
+		return map[string]interface{}{"alg": "ES256", "typ": Type, "kid": clientId + "#" + multikey}
+	}
+	claims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"client_id":        clientId,
+			"client_id_scheme": "did",
+			"aud":              "https://self-issued.me/v2",
+			"iat":              time.Now().Unix(),
+			"exp":              time.Now().Add(time.Minute).Unix(),
+			"nonce":            "n1",
+		}
+	}
+
+	payload, err := verifier.Verify(context.Background(), sign(t, key, header(), claims()))
+
+	if err != nil || !strings.Contains(string(payload), `"nonce":"n1"`) {
+		t.Fatal(err)
+	}
+
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherMultikey, _ := did.EncodeMultikey(&other.PublicKey)
+
+	tests := map[string]func(h map[string]interface{}, c map[string]interface{}) (*ecdsa.PrivateKey, map[string]interface{}, map[string]interface{}){
+		"algorithm none": func(h, c map[string]interface{}) (*ecdsa.PrivateKey, map[string]interface{}, map[string]interface{}) {
+			h["alg"] = "none"
+			return key, h, c
+		},
+		"algorithm not allowed": func(h, c map[string]interface{}) (*ecdsa.PrivateKey, map[string]interface{}, map[string]interface{}) {
+			h["alg"] = "ES384"
+			return key, h, c
+		},
+		"wrong type": func(h, c map[string]interface{}) (*ecdsa.PrivateKey, map[string]interface{}, map[string]interface{}) {
+			h["typ"] = "JWT"
+			return key, h, c
+		},
+		"kid of other did": func(h, c map[string]interface{}) (*ecdsa.PrivateKey, map[string]interface{}, map[string]interface{}) {
+			h["kid"] = "did:key:" + otherMultikey + "#" + otherMultikey
+			return other, h, c
+		},
+		"forged signature": func(h, c map[string]interface{}) (*ecdsa.PrivateKey, map[string]interface{}, map[string]interface{}) {
+			return other, h, c
+		},
+		"expired": func(h, c map[string]interface{}) (*ecdsa.PrivateKey, map[string]interface{}, map[string]interface{}) {
+			c["exp"] = time.Now().Add(-time.Minute).Unix()
+			return key, h, c
+		},
+		"exp missing": func(h, c map[string]interface{}) (*ecdsa.PrivateKey, map[string]interface{}, map[string]interface{}) {
+			delete(c, "exp")
+			return key, h, c
+		},
+		"issued in the future": func(h, c map[string]interface{}) (*ecdsa.PrivateKey, map[string]interface{}, map[string]interface{}) {
+			c["iat"] = time.Now().Add(time.Minute).Unix()
+			return key, h, c
+		},
+		"too old": func(h, c map[string]interface{}) (*ecdsa.PrivateKey, map[string]interface{}, map[string]interface{}) {
+			c["iat"] = time.Now().Add(-2 * time.Hour).Unix()
+			return key, h, c
+		},
+		"other audience": func(h, c map[string]interface{}) (*ecdsa.PrivateKey, map[string]interface{}, map[string]interface{}) {
+			c["aud"] = []string{"https://wallet.example.com"}
+			return key, h, c
+		},
+		"unsigned client id scheme": func(h, c map[string]interface{}) (*ecdsa.PrivateKey, map[string]interface{}, map[string]interface{}) {
+			c["client_id_scheme"] = "redirect_uri"
+			return key, h, c
+		},
+	}
+
+	for name, modify := range tests {
+		k, h, c := modify(header(), claims())
+
+		if _, err = verifier.Verify(context.Background(), sign(t, k, h, c)); !errors.Is(err, ErrInvalidRequestObject) {
+			t.Error(name, err)
+		}
+	}
+}
+
+func Test_VerifyX5c(t *testing.T) {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDer, _ := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	ca, _ = x509.ParseCertificate(caDer)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leafDer, _ := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "verifier"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"verifier.example.com"},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, ca, &key.PublicKey, caKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	o := options()
+	o.Roots = roots
+	verifier := NewVerifier(nil, o)
+
+	header := map[string]interface{}{"alg": "ES256", "typ": Type, "x5c": []string{base64.StdEncoding.EncodeToString(leafDer)}}
+	claims := map[string]interface{}{
+		"client_id":        "verifier.example.com",
+		"client_id_scheme": "x509_san_dns",
+		"aud":              "https://self-issued.me/v2",
+		"exp":              time.Now().Add(time.Minute).Unix(),
+	}
+
+	if _, err := verifier.Verify(context.Background(), sign(t, key, header, claims)); err != nil {
+		t.Error(err)
+	}
+
+	claims["client_id"] = "other.example.com"
+
+	if _, err := verifier.Verify(context.Background(), sign(t, key, header, claims)); !errors.Is(err, ErrInvalidRequestObject) {
+		t.Error("client_id must be named by the certificate", err)
+	}
+
+	claims["client_id"] = "verifier.example.com"
+
+	if _, err := NewVerifier(nil, options()).Verify(context.Background(), sign(t, key, header, claims)); !errors.Is(err, ErrInvalidRequestObject) {
+		t.Error("untrusted certificates must be rejected", err)
+	}
+}
@@ -0,0 +1,287 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/credential"
+)
+
+const maxSchemaBytes = 1 << 20
+
+// maxCachedSchemas bounds the cache, the urls of schemas are chosen by holders.
+const maxCachedSchemas = 1000
+
+// Result is the validation of a credential against one schema.
+type Result struct {
+	Credential int
+	Schema     string
+	Errors     []string
+}
+
+func (r Result) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+type cachedSchema struct {
+	schema  interface{}
+	expires time.Time
+}
+
+// Validator validates credentials against the schemas named by their credentialSchema, and against the schemas
+// which tenants registered for credential types. Fetched schemas are cached for the ttl.
+type Validator struct {
+	client *http.Client
+	ttl    time.Duration
+	// registries map tenants to credential types to the url or file of the schema
+	registries map[string]map[string]string
+
+	mutex     sync.Mutex
+	cache     map[string]cachedSchema
+	maxCached int
+}
+
+func NewValidator(client *http.Client, ttl time.Duration, registries map[string]map[string]string) *Validator {
+	return &Validator{
+		client:     client,
+		ttl:        ttl,
+		registries: registries,
+		cache:      make(map[string]cachedSchema),
+		maxCached:  maxCachedSchemas,
+	}
+}
+
+type reference struct {
+	id  string
+	typ string
+}
+
+func references(document map[string]interface{}) []reference {
+	var refs []reference
+	schemas, ok := document["credentialSchema"].([]interface{})
+
+	if !ok && document["credentialSchema"] != nil {
+		schemas = []interface{}{document["credentialSchema"]}
+	}
+
+	for _, s := range schemas {
+		if m, ok := s.(map[string]interface{}); ok {
+			id, _ := m["id"].(string)
+			typ, _ := m["type"].(string)
+			refs = append(refs, reference{id: id, typ: typ})
+		}
+	}
+
+	return refs
+}
+
+// ValidatePresentation validates all credentials of a json-ld presentation. Invalid or unsupported schemas are
+// reported as failed results. Schemas which can not be fetched return an error if enforced, otherwise they are
+// reported as failed results as well.
+func (v *Validator) ValidatePresentation(ctx context.Context, tenantId string, presentation map[string]interface{}, enforce bool) ([]Result, error) {
+	var results []Result
+
+	for i, c := range credential.Credentials(presentation) {
+		document, err := credential.Document(c)
+
+		if err != nil {
+			results = append(results, Result{Credential: i, Errors: []string{err.Error()}})
+			continue
+		}
+
+		for _, ref := range references(document) {
+			result, err := v.validate(i, ref.id, document, enforce, func() (interface{}, error) { return v.referenced(ctx, ref) })
+
+			if err != nil {
+				return nil, err
+			}
+
+			results = append(results, result)
+		}
+
+		for _, typ := range credential.Types(document) {
+			location, ok := v.registries[tenantId][typ]
+
+			if !ok {
+				continue
+			}
+
+			result, err := v.validate(i, location, document, enforce, func() (interface{}, error) { return v.load(ctx, location, true) })
+
+			if err != nil {
+				return nil, err
+			}
+
+			results = append(results, result)
+		}
+	}
+
+	return results, nil
+}
+
+func (v *Validator) validate(i int, location string, document map[string]interface{}, enforce bool, load func() (interface{}, error)) (Result, error) {
+	result := Result{Credential: i, Schema: location}
+	schema, err := load()
+
+	if err == nil {
+		result.Errors, err = Validate(schema, document)
+	}
+
+	if errors.Is(err, ErrInvalidSchema) || (err != nil && !enforce) {
+		result.Errors = []string{err.Error()}
+		return result, nil
+	}
+
+	if err != nil {
+		return result, fmt.Errorf("credential %d schema %s: %w", i, location, err)
+	}
+
+	return result, nil
+}
+
+// referenced returns the json schema of a credentialSchema.
+func (v *Validator) referenced(ctx context.Context, ref reference) (interface{}, error) {
+	switch ref.typ {
+	case "JsonSchema", "JsonSchema2023", "JsonSchemaValidator2018":
+		return v.load(ctx, ref.id, false)
+	case "JsonSchemaCredential":
+		// the schema is the jsonSchema of the credential subject, the proof of the schema credential is not verified
+		document, err := v.load(ctx, ref.id, false)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if token, ok := document.(string); ok {
+			document, err = credential.Document(token)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		schemaCredential, _ := document.(map[string]interface{})
+		subject, _ := schemaCredential["credentialSubject"].(map[string]interface{})
+		schema, ok := subject["jsonSchema"]
+
+		if !ok {
+			return nil, fmt.Errorf("%w: credential has no jsonSchema", ErrInvalidSchema)
+		}
+
+		return schema, nil
+	}
+
+	return nil, fmt.Errorf("%w: credentialSchema type %q is not supported", ErrInvalidSchema, ref.typ)
+}
+
+// load returns the parsed document of an http(s) url. Local files are only read for registered schemas,
+// never for locations named by credentials.
+func (v *Validator) load(ctx context.Context, location string, local bool) (interface{}, error) {
+	remote := strings.HasPrefix(location, "https://") || strings.HasPrefix(location, "http://")
+
+	if !remote && !local {
+		return nil, fmt.Errorf("%w: schema %q is no http url", ErrInvalidSchema, location)
+	}
+
+	v.mutex.Lock()
+	cached, ok := v.cache[location]
+	v.mutex.Unlock()
+
+	if ok && (cached.expires.IsZero() || cached.expires.After(time.Now())) {
+		return cached.schema, nil
+	}
+
+	var b []byte
+	var err error
+	var expires time.Time
+
+	if remote {
+		b, err = v.fetch(ctx, location)
+		expires = time.Now().Add(v.ttl)
+	} else {
+		b, err = os.ReadFile(strings.TrimPrefix(location, "file://"))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var schema interface{}
+
+	if err = json.Unmarshal(b, &schema); err != nil {
+		// schema credentials can be served as jwt
+		if token := strings.TrimSpace(string(b)); strings.Count(token, ".") == 2 {
+			schema = token
+		} else {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidSchema, err)
+		}
+	}
+
+	v.store(location, cachedSchema{schema: schema, expires: expires})
+
+	return schema, nil
+}
+
+// store caches a schema. A full cache evicts the expired schemas, and if none expired the fetched schema
+// which expires first. Registered local schemas never expire and are kept.
+func (v *Validator) store(location string, schema cachedSchema) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if _, ok := v.cache[location]; !ok && len(v.cache) >= v.maxCached {
+		now := time.Now()
+		oldest := ""
+
+		for l, c := range v.cache {
+			switch {
+			case c.expires.IsZero():
+			case c.expires.Before(now):
+				delete(v.cache, l)
+			case oldest == "" || c.expires.Before(v.cache[oldest].expires):
+				oldest = l
+			}
+		}
+
+		if len(v.cache) >= v.maxCached && oldest != "" {
+			delete(v.cache, oldest)
+		}
+	}
+
+	v.cache[location] = schema
+}
+
+func (v *Validator) fetch(ctx context.Context, url string) ([]byte, error) {
+	if v.client == nil {
+		return nil, fmt.Errorf("schema %s can not be fetched without http client", url)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/schema+json, application/json, application/vc+jwt")
+
+	res, err := v.client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("schema %s responded %d", url, res.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(res.Body, maxSchemaBytes))
+}
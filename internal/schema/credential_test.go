@@ -0,0 +1,130 @@
+package schema
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const subjectSchema = `{"type": "object", "properties": {"credentialSubject": {"type": "object", "required": ["name"]}}}`
+
+func Test_ValidatePresentation(t *testing.T) {
+	fetches := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+
+		switch r.URL.Path {
+		case "/schema.json":
+			w.Write([]byte(subjectSchema))
+		case "/schema-credential":
+			w.Write([]byte(`{"type": ["VerifiableCredential", "JsonSchemaCredential"], "credentialSubject": {"type": "JsonSchema", "jsonSchema": ` + subjectSchema + `}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	registered := filepath.Join(t.TempDir(), "license.json")
+	os.WriteFile(registered, []byte(`{"properties": {"credentialSubject": {"required": ["licenseNumber"]}}}`), 0600)
+
+	validator := NewValidator(server.Client(), time.Minute, map[string]map[string]string{
+		"tenant1": {"DriverLicense": registered},
+	})
+
+	claims, _ := json.Marshal(map[string]interface{}{
+		"vc": map[string]interface{}{
+			"credentialSchema":  map[string]interface{}{"id": server.URL + "/schema-credential", "type": "JsonSchemaCredential"},
+			"credentialSubject": map[string]interface{}{"name": "Alice"},
+		},
+	})
+
+	presentation := map[string]interface{}{
+		"verifiableCredential": []interface{}{
+			map[string]interface{}{
+				"type":              []interface{}{"VerifiableCredential", "DriverLicense"},
+				"credentialSchema":  []interface{}{map[string]interface{}{"id": server.URL + "/schema.json", "type": "JsonSchema"}},
+				"credentialSubject": map[string]interface{}{"name": "Alice", "licenseNumber": "L1"},
+			},
+			map[string]interface{}{
+				"credentialSchema":  map[string]interface{}{"id": server.URL + "/schema.json", "type": "JsonSchema"},
+				"credentialSubject": map[string]interface{}{},
+			},
+			"eyJhbGciOiJFUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(claims) + ".c2ln",
+			map[string]interface{}{
+				"credentialSchema":  map[string]interface{}{"id": "/etc/passwd", "type": "JsonSchema"},
+				"credentialSubject": map[string]interface{}{},
+			},
+		},
+	}
+
+	results, err := validator.ValidatePresentation(context.Background(), "tenant1", presentation, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := make([]bool, 0, len(results))
+	for _, r := range results {
+		valid = append(valid, r.Valid())
+	}
+
+	// credential 0 against its schema and the registered one, 1 misses the name, 3 names a local file
+	if len(results) != 5 || !valid[0] || !valid[1] || valid[2] || !valid[3] || valid[4] || results[1].Schema != registered {
+		t.Error("unexpected results", results)
+	}
+
+	if !strings.Contains(results[2].Errors[0], "name is required") {
+		t.Error(results[2].Errors)
+	}
+
+	if fetches != 2 {
+		t.Error("schemas must be cached", fetches)
+	}
+
+	if results, _ = validator.ValidatePresentation(context.Background(), "tenant2", presentation, true); len(results) != 4 {
+		t.Error("registries are per tenant", results)
+	}
+
+	presentation["verifiableCredential"] = map[string]interface{}{
+		"credentialSchema": map[string]interface{}{"id": server.URL + "/missing.json", "type": "JsonSchema"},
+	}
+
+	if _, err = validator.ValidatePresentation(context.Background(), "tenant1", presentation, true); err == nil {
+		t.Error("unavailable schemas must fail the validation")
+	}
+
+	if results, err = validator.ValidatePresentation(context.Background(), "tenant1", presentation, false); err != nil || len(results) != 1 || results[0].Valid() {
+		t.Error("unavailable schemas must be failed results if not enforced", results, err)
+	}
+}
+
+func Test_SchemaCacheIsBounded(t *testing.T) {
+	validator := NewValidator(nil, time.Minute, nil)
+	validator.maxCached = 2
+
+	validator.store("file:///registered.json", cachedSchema{})
+	validator.store("https://a.example.com", cachedSchema{expires: time.Now().Add(-time.Second)})
+	validator.store("https://b.example.com", cachedSchema{expires: time.Now().Add(time.Minute)})
+
+	if _, ok := validator.cache["https://a.example.com"]; ok || len(validator.cache) != 2 {
+		t.Error("expired schemas must be evicted first", validator.cache)
+	}
+
+	validator.store("https://c.example.com", cachedSchema{expires: time.Now().Add(2 * time.Minute)})
+
+	if _, ok := validator.cache["https://b.example.com"]; ok || len(validator.cache) != 2 {
+		t.Error("schema which expires first must be evicted", validator.cache)
+	}
+
+	if _, ok := validator.cache["file:///registered.json"]; !ok {
+		t.Error("registered schemas must be kept", validator.cache)
+	}
+}
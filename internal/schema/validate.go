@@ -0,0 +1,511 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalidSchema is returned for schemas which can not be evaluated, e.g. with remote references.
+var ErrInvalidSchema = errors.New("invalid json schema")
+
+const maxDepth = 64
+
+// validator evaluates the assertions of JSON Schema draft-07 and 2020-12. Annotations like format and
+// the vocabularies for unevaluated properties are ignored.
+type validator struct {
+	root     interface{}
+	patterns map[string]*regexp.Regexp
+	depth    int
+}
+
+// Validate returns the violations of the instance as "path: message". The instance is the result of
+// json.Unmarshal into interface{}.
+func Validate(schema interface{}, instance interface{}) ([]string, error) {
+	v := &validator{root: schema, patterns: make(map[string]*regexp.Regexp)}
+	return v.validate(schema, instance, "")
+}
+
+func violation(path string, format string, a ...interface{}) []string {
+	if path == "" {
+		path = "/"
+	}
+	return []string{path + ": " + fmt.Sprintf(format, a...)}
+}
+
+func (v *validator) validate(schema interface{}, instance interface{}, path string) ([]string, error) {
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			return violation(path, "not allowed"), nil
+		}
+		return nil, nil
+	case map[string]interface{}:
+		v.depth++
+		defer func() { v.depth-- }()
+
+		if v.depth > maxDepth {
+			return nil, fmt.Errorf("%w: references nested deeper than %d", ErrInvalidSchema, maxDepth)
+		}
+
+		return v.validateObject(s, instance, path)
+	}
+	return nil, fmt.Errorf("%w: schema at %s is no object", ErrInvalidSchema, path)
+}
+
+func (v *validator) validateObject(schema map[string]interface{}, instance interface{}, path string) ([]string, error) {
+	var violations []string
+
+	checks := []func(map[string]interface{}, interface{}, string) ([]string, error){
+		v.ref,
+		v.generic,
+		v.combinators,
+		v.object,
+		v.array,
+		v.str,
+		v.number,
+	}
+
+	for _, check := range checks {
+		found, err := check(schema, instance, path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		violations = append(violations, found...)
+	}
+
+	return violations, nil
+}
+
+// ref resolves local references, which are json pointers into the root schema.
+func (v *validator) ref(schema map[string]interface{}, instance interface{}, path string) ([]string, error) {
+	ref, ok := schema["$ref"].(string)
+
+	if !ok {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("%w: remote reference %s", ErrInvalidSchema, ref)
+	}
+
+	target := v.root
+
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+
+		switch t := target.(type) {
+		case map[string]interface{}:
+			target, ok = t[token]
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			ok = err == nil && i >= 0 && i < len(t)
+			if ok {
+				target = t[i]
+			}
+		default:
+			ok = false
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("%w: reference %s not found", ErrInvalidSchema, ref)
+		}
+	}
+
+	return v.validate(target, instance, path)
+}
+
+func typeOf(instance interface{}) string {
+	switch i := instance.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if i == math.Trunc(i) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", instance)
+}
+
+func hasType(instance interface{}, t string) bool {
+	actual := typeOf(instance)
+	return actual == t || (t == "number" && actual == "integer")
+}
+
+func (v *validator) generic(schema map[string]interface{}, instance interface{}, path string) ([]string, error) {
+	switch t := schema["type"].(type) {
+	case string:
+		if !hasType(instance, t) {
+			return violation(path, "must be of type %s, not %s", t, typeOf(instance)), nil
+		}
+	case []interface{}:
+		matches := false
+		names := make([]string, 0, len(t))
+
+		for _, e := range t {
+			name, _ := e.(string)
+			names = append(names, name)
+			matches = matches || hasType(instance, name)
+		}
+
+		if !matches {
+			return violation(path, "must be of type %s, not %s", strings.Join(names, " or "), typeOf(instance)), nil
+		}
+	}
+
+	if c, ok := schema["const"]; ok && !reflect.DeepEqual(c, instance) {
+		return violation(path, "must be the constant value"), nil
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		for _, e := range enum {
+			if reflect.DeepEqual(e, instance) {
+				return nil, nil
+			}
+		}
+		return violation(path, "must be one of the enum values"), nil
+	}
+
+	return nil, nil
+}
+
+func (v *validator) combinators(schema map[string]interface{}, instance interface{}, path string) ([]string, error) {
+	var violations []string
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, s := range all {
+			found, err := v.validate(s, instance, path)
+
+			if err != nil {
+				return nil, err
+			}
+
+			violations = append(violations, found...)
+		}
+	}
+
+	for _, keyword := range []string{"anyOf", "oneOf"} {
+		subschemas, ok := schema[keyword].([]interface{})
+
+		if !ok {
+			continue
+		}
+
+		matches := 0
+
+		for _, s := range subschemas {
+			found, err := v.validate(s, instance, path)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if len(found) == 0 {
+				matches++
+			}
+		}
+
+		if matches == 0 {
+			violations = append(violations, violation(path, "must match a schema of %s", keyword)...)
+		} else if keyword == "oneOf" && matches > 1 {
+			violations = append(violations, violation(path, "must match exactly one schema of oneOf, matches %d", matches)...)
+		}
+	}
+
+	if not, ok := schema["not"]; ok {
+		found, err := v.validate(not, instance, path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(found) == 0 {
+			violations = append(violations, violation(path, "must not match the schema of not")...)
+		}
+	}
+
+	if condition, ok := schema["if"]; ok {
+		found, err := v.validate(condition, instance, path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		branch, ok := schema["then"]
+
+		if len(found) > 0 {
+			branch, ok = schema["else"]
+		}
+
+		if ok {
+			found, err = v.validate(branch, instance, path)
+
+			if err != nil {
+				return nil, err
+			}
+
+			violations = append(violations, found...)
+		}
+	}
+
+	return violations, nil
+}
+
+func (v *validator) object(schema map[string]interface{}, instance interface{}, path string) ([]string, error) {
+	object, ok := instance.(map[string]interface{})
+
+	if !ok {
+		return nil, nil
+	}
+
+	var violations []string
+
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+
+			if _, ok := object[name]; !ok {
+				violations = append(violations, violation(path, "property %s is required", name)...)
+			}
+		}
+	}
+
+	if n, ok := schema["minProperties"].(float64); ok && float64(len(object)) < n {
+		violations = append(violations, violation(path, "must have at least %v properties", n)...)
+	}
+
+	if n, ok := schema["maxProperties"].(float64); ok && float64(len(object)) > n {
+		violations = append(violations, violation(path, "must have at most %v properties", n)...)
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	patternProperties, _ := schema["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := schema["additionalProperties"]
+
+	for name, value := range object {
+		child := path + "/" + strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+		var subschemas []interface{}
+
+		if s, ok := properties[name]; ok {
+			subschemas = append(subschemas, s)
+		}
+
+		for pattern, s := range patternProperties {
+			re, err := v.compile(pattern)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if re.MatchString(name) {
+				subschemas = append(subschemas, s)
+			}
+		}
+
+		if len(subschemas) == 0 && hasAdditional {
+			subschemas = append(subschemas, additional)
+		}
+
+		for _, s := range subschemas {
+			found, err := v.validate(s, value, child)
+
+			if err != nil {
+				return nil, err
+			}
+
+			violations = append(violations, found...)
+		}
+	}
+
+	return violations, nil
+}
+
+func (v *validator) array(schema map[string]interface{}, instance interface{}, path string) ([]string, error) {
+	array, ok := instance.([]interface{})
+
+	if !ok {
+		return nil, nil
+	}
+
+	var violations []string
+
+	if n, ok := schema["minItems"].(float64); ok && float64(len(array)) < n {
+		violations = append(violations, violation(path, "must have at least %v items", n)...)
+	}
+
+	if n, ok := schema["maxItems"].(float64); ok && float64(len(array)) > n {
+		violations = append(violations, violation(path, "must have at most %v items", n)...)
+	}
+
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+		for i := range array {
+			for j := i + 1; j < len(array); j++ {
+				if reflect.DeepEqual(array[i], array[j]) {
+					violations = append(violations, violation(path, "items %d and %d must be unique", i, j)...)
+				}
+			}
+		}
+	}
+
+	// prefixItems of 2020-12, or items as array of draft-07
+	prefix, ok := schema["prefixItems"].([]interface{})
+	rest, hasRest := schema["items"]
+
+	if !ok {
+		if tuple, isTuple := rest.([]interface{}); isTuple {
+			prefix = tuple
+			rest, hasRest = schema["additionalItems"]
+		}
+	}
+
+	for i, item := range array {
+		var s interface{}
+
+		switch {
+		case i < len(prefix):
+			s = prefix[i]
+		case hasRest:
+			s = rest
+		default:
+			continue
+		}
+
+		found, err := v.validate(s, item, path+"/"+strconv.Itoa(i))
+
+		if err != nil {
+			return nil, err
+		}
+
+		violations = append(violations, found...)
+	}
+
+	if contains, ok := schema["contains"]; ok {
+		matches := 0
+
+		for _, item := range array {
+			found, err := v.validate(contains, item, path)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if len(found) == 0 {
+				matches++
+			}
+		}
+
+		minimum := 1.0
+		if n, ok := schema["minContains"].(float64); ok {
+			minimum = n
+		}
+
+		if float64(matches) < minimum {
+			violations = append(violations, violation(path, "must contain at least %v matching items", minimum)...)
+		}
+
+		if n, ok := schema["maxContains"].(float64); ok && float64(matches) > n {
+			violations = append(violations, violation(path, "must contain at most %v matching items", n)...)
+		}
+	}
+
+	return violations, nil
+}
+
+func (v *validator) str(schema map[string]interface{}, instance interface{}, path string) ([]string, error) {
+	s, ok := instance.(string)
+
+	if !ok {
+		return nil, nil
+	}
+
+	var violations []string
+	length := float64(utf8.RuneCountInString(s))
+
+	if n, ok := schema["minLength"].(float64); ok && length < n {
+		violations = append(violations, violation(path, "must be at least %v characters long", n)...)
+	}
+
+	if n, ok := schema["maxLength"].(float64); ok && length > n {
+		violations = append(violations, violation(path, "must be at most %v characters long", n)...)
+	}
+
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := v.compile(pattern)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !re.MatchString(s) {
+			violations = append(violations, violation(path, "must match the pattern %s", pattern)...)
+		}
+	}
+
+	return violations, nil
+}
+
+func (v *validator) number(schema map[string]interface{}, instance interface{}, path string) ([]string, error) {
+	n, ok := instance.(float64)
+
+	if !ok {
+		return nil, nil
+	}
+
+	var violations []string
+
+	if m, ok := schema["minimum"].(float64); ok && n < m {
+		violations = append(violations, violation(path, "must be >= %v", m)...)
+	}
+
+	if m, ok := schema["maximum"].(float64); ok && n > m {
+		violations = append(violations, violation(path, "must be <= %v", m)...)
+	}
+
+	// draft-04 booleans are not supported, only the numeric form of draft-06 and later
+	if m, ok := schema["exclusiveMinimum"].(float64); ok && n <= m {
+		violations = append(violations, violation(path, "must be > %v", m)...)
+	}
+
+	if m, ok := schema["exclusiveMaximum"].(float64); ok && n >= m {
+		violations = append(violations, violation(path, "must be < %v", m)...)
+	}
+
+	if m, ok := schema["multipleOf"].(float64); ok && m > 0 {
+		if q := n / m; math.Abs(q-math.Round(q)) > 1e-9 {
+			violations = append(violations, violation(path, "must be a multiple of %v", m)...)
+		}
+	}
+
+	return violations, nil
+}
+
+func (v *validator) compile(pattern string) (*regexp.Regexp, error) {
+	if re, ok := v.patterns[pattern]; ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: pattern %s: %s", ErrInvalidSchema, pattern, err)
+	}
+
+	v.patterns[pattern] = re
+	return re, nil
+}
@@ -0,0 +1,80 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func parse(t *testing.T, s string) interface{} {
+	var v interface{}
+
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
+
+func Test_Validate(t *testing.T) {
+	schema := parse(t, `{
+		"$defs": {"name": {"type": "string", "minLength": 1, "maxLength": 8}},
+		"type": "object",
+		"required": ["credentialSubject"],
+		"properties": {
+			"type": {"type": "array", "contains": {"const": "DriverLicense"}},
+			"credentialSubject": {
+				"type": "object",
+				"required": ["name", "age"],
+				"additionalProperties": false,
+				"properties": {
+					"id": {"type": "string", "pattern": "^did:"},
+					"name": {"$ref": "#/$defs/name"},
+					"age": {"type": "integer", "minimum": 18, "exclusiveMaximum": 150},
+					"classes": {"type": "array", "items": {"enum": ["A", "B", "C"]}, "uniqueItems": true},
+					"address": {"oneOf": [{"type": "string"}, {"type": "object", "required": ["city"]}]}
+				}
+			}
+		}
+	}`)
+
+	tests := []struct {
+		instance   string
+		violations int
+	}{
+		{`{"type": ["VerifiableCredential", "DriverLicense"], "credentialSubject": {"id": "did:example:a", "name": "Alice", "age": 30, "classes": ["A", "B"], "address": {"city": "Berlin"}}}`, 0},
+		{`{"type": ["VerifiableCredential"], "credentialSubject": {"name": "Alice", "age": 30}}`, 1},
+		{`{"credentialSubject": {"name": "Alice"}}`, 1},
+		{`{"credentialSubject": {"name": "", "age": 17.5}}`, 3},
+		{`{"credentialSubject": {"id": "urn:a", "name": "Alice", "age": 150, "other": 1}}`, 3},
+		{`{"credentialSubject": {"name": "Alice", "age": 20, "classes": ["A", "A", "D"], "address": 1}}`, 3},
+		{`{}`, 1},
+		{`[]`, 1},
+	}
+
+	for _, test := range tests {
+		violations, err := Validate(schema, parse(t, test.instance))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(violations) != test.violations {
+			t.Error(test.instance, violations)
+		}
+	}
+}
+
+func Test_ValidateInvalidSchema(t *testing.T) {
+	for _, schema := range []string{
+		`{"$ref": "https://example.com/schema.json"}`,
+		`{"$ref": "#/$defs/missing"}`,
+		`{"$defs": {"loop": {"$ref": "#/$defs/loop"}}, "$ref": "#/$defs/loop"}`,
+		`{"type": "string", "pattern": "("}`,
+		`[]`,
+	} {
+		if _, err := Validate(parse(t, schema), "a"); !errors.Is(err, ErrInvalidSchema) {
+			t.Error(schema, err)
+		}
+	}
+}
@@ -15,7 +15,10 @@ import (
 	"gitlab.eclipse.org/eclipse/xfsc/libraries/messaging/cloudeventprovider"
 	logr "gitlab.eclipse.org/eclipse/xfsc/libraries/microservice/core/pkg/logr"
 	"gitlab.eclipse.org/eclipse/xfsc/libraries/ssi/oid4vip/model/types"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/httpclient"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/policy"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/requestobject"
 	serviceCommon "github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/services/common"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/pkg/messaging"
 	"gitlab.eclipse.org/eclipse/xfsc/organisational-credential-manager-w-stack/libraries/messaging/common"
@@ -29,46 +32,43 @@ type AuthorizationHandler struct {
 }
 
 func (handler *AuthorizationHandler) HandleRequestObject(ctx context.Context, clientId string, request_uri string, tenantId string, config *model.Config, authUrl *url.URL) (string, error) {
-	if config.ExternalPresentation.ClientIdPolicy != "" {
-		var clientIdObject map[string]interface{} = make(map[string]interface{})
-		clientIdObject["clientId"] = clientId
-		//Check for ClientId, redirect Uris etc.
-		res, err := GetPolicyResult(clientIdObject, config.ExternalPresentation.ClientIdPolicy)
+	var clientIdObject map[string]interface{} = make(map[string]interface{})
+	clientIdObject["clientId"] = clientId
+	clientIdObject["tenantId"] = tenantId
+	//Check for ClientId, redirect Uris etc.
+	decision, err := EvaluatePolicy(ctx, policy.ClientId, clientIdObject)
 
-		if err != nil {
-			return "", err
-		}
-
-		val, exist := res["allow"]
+	if err != nil {
+		return "", err
+	}
 
-		if !exist || val != "true" {
-			return "", errors.New("policy forbids the processing")
-		}
+	if err = decision.Err(); err != nil {
+		return "", err
 	}
 
-	object, err := getRequestObject(request_uri, ctx)
+	object, err := getRequestObject(request_uri, httpclient.WithTenant(ctx, tenantId))
 
 	if err != nil {
 		return "", err
 	}
 
+	if object.ClientID != clientId {
+		return "", fmt.Errorf("%w: client_id %s does not match %s", requestobject.ErrInvalidRequestObject, object.ClientID, clientId)
+	}
+
 	if object.ResponseMode != types.DirectPost {
 		return "", errors.ErrUnsupported
 	}
 
-	if config.ExternalPresentation.RequestObjectPolicy != "" {
-		//Check for ClientId, redirect Uris etc.
-		res, err := GetPolicyResult(object, config.ExternalPresentation.RequestObjectPolicy)
+	//Check for ClientId, redirect Uris etc.
+	decision, err = EvaluatePolicy(ctx, policy.RequestObject, object)
 
-		if err != nil {
-			return "", err
-		}
-
-		val, exist := res["allow"]
+	if err != nil {
+		return "", err
+	}
 
-		if !exist || val != "true" {
-			return "", errors.New("policy forbidds the processing")
-		}
+	if err = decision.Err(); err != nil {
+		return "", err
 	}
 
 	if err != nil {
@@ -85,13 +85,15 @@ func (handler *AuthorizationHandler) HandleRequestObject(ctx context.Context, cl
 		requestId = object.State
 	}
 
-	id, err := SignId(tenantId, config.SigningKey)
+	id := NewPresentationId()
+
+	accessToken, err := IssueIdToken(tenantId, id, PurposeInternal, time.Time{})
 
 	if err != nil {
 		return "", errors.Join(errors.New("error during signing"), err)
 	}
 
-	err = serviceCommon.StoreRequest(ctx, requestId, tenantId, id, object)
+	err = storeRequest(ctx, requestId, tenantId, id, object)
 
 	if err != nil {
 		return "", err
@@ -99,6 +101,7 @@ func (handler *AuthorizationHandler) HandleRequestObject(ctx context.Context, cl
 
 	query := authUrl.Query()
 	query.Add("presentation", id)
+	query.Add("token", accessToken)
 	query.Add("nonce", object.Nonce)
 	authUrl.RawQuery = query.Encode()
 
@@ -134,6 +137,8 @@ func (handler *AuthorizationHandler) HandleAuthorizationRequest(c *gin.Context,
 			if err == nil {
 				handler.logger.Info("Redirect to: " + redirect_uri)
 				c.Redirect(302, redirect_uri)
+			} else if errors.Is(err, requestobject.ErrInvalidRequestObject) {
+				ErrorResponse(c, err.Error(), err)
 			} else {
 				ErrorResponse(c, "Request could not be handled", err)
 			}
@@ -220,6 +225,7 @@ func (handler *AuthorizationHandler) receive(event event.Event) {
 		headers.Add("X-DID", remoteRequest.Did)
 
 		ctx = context.WithValue(ctx, HeaderContextKey, headers)
+		ctx = serviceCommon.ContextWithActor(ctx, serviceCommon.Actor{Type: serviceCommon.ActorNats, Id: remoteRequest.RequestId})
 
 		_, err = handler.HandleRequestObject(ctx, remoteRequest.ClientId, remoteRequest.RequestUri, remoteRequest.TenantId, handler.config, authUrl)
 
@@ -0,0 +1,125 @@
+package common
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gocql/gocql"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+)
+
+const (
+	ActorHttp   = "http"
+	ActorNats   = "nats"
+	ActorWallet = "wallet"
+	ActorSystem = "system"
+
+	OutcomeValid   = "valid"
+	OutcomeInvalid = "invalid"
+)
+
+type actorContextKey struct{}
+
+// Actor is the initiator of a state transition, recorded in the audit trail.
+type Actor struct {
+	Type string
+	Id   string
+}
+
+func ContextWithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+func ActorFromContext(ctx context.Context) Actor {
+	actor, ok := ctx.Value(actorContextKey{}).(Actor)
+
+	if !ok {
+		return Actor{Type: ActorSystem}
+	}
+
+	return actor
+}
+
+var auditListeners []func(tenantId string, row *model.VerificationEntry, entry model.AuditEntry)
+
+// AddAuditListener registers a function which is called after each written audit entry. The row holds the
+// columns of the record as written with the entry, listeners must not read the record again.
+func AddAuditListener(listener func(tenantId string, row *model.VerificationEntry, entry model.AuditEntry)) {
+	auditListeners = append(auditListeners, listener)
+}
+
+// appendAudit adds an audit entry for a state transition to the batch. The entry is append only and has no ttl.
+func appendAudit(ctx context.Context, batch *gocql.Batch, tenantId string, id string, state string, outcome string) model.AuditEntry {
+	env := common.GetEnvironment()
+	actor := ActorFromContext(ctx)
+	eventId := gocql.TimeUUID()
+
+	queryString := fmt.Sprintf(`INSERT INTO %s.presentation_audit (region,country,id,event_id,state,actor_type,actor_id,outcome) VALUES(?,?,?,?,?,?,?,?);`, tenantId)
+
+	batch.Query(queryString,
+		env.GetRegion(),
+		env.GetCountry(),
+		id,
+		eventId,
+		state,
+		actor.Type,
+		actor.Id,
+		outcome)
+
+	return model.AuditEntry{
+		Id:        eventId.String(),
+		Timestamp: eventId.Time(),
+		State:     state,
+		ActorType: actor.Type,
+		ActorId:   actor.Id,
+		Outcome:   outcome,
+	}
+}
+
+// executeWithAudit executes the batch and notifies the audit listener about the written entries.
+func executeWithAudit(batch *gocql.Batch, tenantId string, row *model.VerificationEntry, entries ...model.AuditEntry) error {
+	env := common.GetEnvironment()
+
+	err := env.GetSession().ExecuteBatch(batch)
+
+	if err != nil {
+		return err
+	}
+
+	for _, listener := range auditListeners {
+		for _, entry := range entries {
+			listener(tenantId, row, entry)
+		}
+	}
+
+	return nil
+}
+
+func GetAuditTrail(ctx context.Context, tenantId string, id string) ([]model.AuditEntry, error) {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	var eventId gocql.UUID
+	var entry model.AuditEntry
+	ret := make([]model.AuditEntry, 0)
+
+	queryString := fmt.Sprintf(`SELECT event_id,state,actor_type,actor_id,outcome FROM %s.presentation_audit WHERE region=? AND country=? AND id=?;`, tenantId)
+
+	query := session.Query(queryString,
+		env.GetRegion(),
+		env.GetCountry(),
+		id).WithContext(ctx).Consistency(gocql.LocalQuorum).Iter()
+
+	for query.Scan(&eventId, &entry.State, &entry.ActorType, &entry.ActorId, &entry.Outcome) {
+		entry.Id = eventId.String()
+		entry.Timestamp = eventId.Time()
+		ret = append(ret, entry)
+	}
+
+	if err := query.Close(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,23 @@
+package common
+
+import "hash/fnv"
+
+// PartitionBuckets is the number of partitions per tenant of the tables which are not partitioned by record.
+// Rows are spread over the buckets by the hash of their id, so that a tenant has no single unbounded partition.
+const PartitionBuckets = 16
+
+// bucketOf returns the partition bucket of an id.
+func bucketOf(id string) int {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() % PartitionBuckets)
+}
+
+// allBuckets returns all buckets, for reads of all rows of a tenant.
+func allBuckets() []int {
+	buckets := make([]int, PartitionBuckets)
+	for i := range buckets {
+		buckets[i] = i
+	}
+	return buckets
+}
@@ -0,0 +1,25 @@
+package common
+
+import "testing"
+
+func Test_Buckets(t *testing.T) {
+	seen := make(map[int]bool)
+
+	for _, id := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"} {
+		bucket := bucketOf(id)
+
+		if bucket < 0 || bucket >= PartitionBuckets || bucket != bucketOf(id) {
+			t.Error("bucket out of range or not stable", id, bucket)
+		}
+
+		seen[bucket] = true
+	}
+
+	if len(seen) < 2 {
+		t.Error("ids must be spread over the buckets")
+	}
+
+	if b := allBuckets(); len(b) != PartitionBuckets || b[PartitionBuckets-1] != PartitionBuckets-1 {
+		t.Error(b)
+	}
+}
@@ -15,7 +15,12 @@ import (
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
 )
 
-func getEntriesFromDb(ctx context.Context, tenantId string, id string, searchField string) ([]model.VerificationEntry, error) {
+const (
+	requestLookupTable = "presentations_by_request"
+	groupLookupTable   = "presentations_by_group"
+)
+
+func queryEntryFromDb(ctx context.Context, tenantId string, id string) ([]model.VerificationEntry, error) {
 	env := common.GetEnvironment()
 	session := env.GetSession()
 	var dregion string
@@ -33,15 +38,23 @@ func getEntriesFromDb(ctx context.Context, tenantId string, id string, searchFie
 	var dresponseType string
 	var dclientId string
 	var dgroupId string
-
-	queryString := fmt.Sprintf(`SELECT region,country,id,requestid,presentationdefinition,presentation,redirecturi,state,last_update_timestamp,nonce,responseuri,responsemode,responsetype,clientid,groupid FROM %s.presentations WHERE region=? AND
+	var dexpiresAt time.Time
+	var ddeliveryStatus string
+	var ddeliveryAttempts int
+	var ddeliveryError string
+	var ddeliveryDeadline time.Time
+	var dschemaValidation string
+	var dclaims string
+	var dwebhookUrl string
+
+	queryString := fmt.Sprintf(`SELECT region,country,id,requestid,presentationdefinition,presentation,redirecturi,state,last_update_timestamp,nonce,responseuri,responsemode,responsetype,clientid,groupid,expires_at,delivery_status,delivery_attempts,delivery_error,delivery_deadline,schema_validation,claims,webhook_url FROM %s.presentations WHERE region=? AND
 																																												country=? AND
-																																												%s=?;`, tenantId, searchField)
+																																												id=?;`, tenantId)
 
 	query := session.Query(queryString,
 		env.GetRegion(),
 		env.GetCountry(),
-		id).Consistency(gocql.LocalQuorum).Iter()
+		id).WithContext(ctx).Consistency(gocql.LocalQuorum).Iter()
 
 	ret := make([]model.VerificationEntry, 0)
 
@@ -60,7 +73,15 @@ func getEntriesFromDb(ctx context.Context, tenantId string, id string, searchFie
 		&dresponseMode,
 		&dresponseType,
 		&dclientId,
-		&dgroupId) {
+		&dgroupId,
+		&dexpiresAt,
+		&ddeliveryStatus,
+		&ddeliveryAttempts,
+		&ddeliveryError,
+		&ddeliveryDeadline,
+		&dschemaValidation,
+		&dclaims,
+		&dwebhookUrl) {
 
 		row := model.VerificationEntry{
 			Region:              dregion,
@@ -76,9 +97,28 @@ func getEntriesFromDb(ctx context.Context, tenantId string, id string, searchFie
 			ResponseType:        dresponseType,
 			ClientId:            dclientId,
 			GroupId:             dgroupId,
+			ExpiresAt:           dexpiresAt,
+			WebhookUrl:          dwebhookUrl,
 		}
 
-		bpresentatioDefinition, err := base64.RawStdEncoding.DecodeString(ddefinition)
+		if ddeliveryStatus != "" {
+			row.Delivery = &model.Delivery{
+				Status:    model.DeliveryStatus(ddeliveryStatus),
+				Attempts:  ddeliveryAttempts,
+				LastError: ddeliveryError,
+				Deadline:  ddeliveryDeadline,
+			}
+		}
+
+		if dschemaValidation != "" {
+			err := json.Unmarshal([]byte(dschemaValidation), &row.SchemaValidation)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		bpresentatioDefinition, staleDefinition, err := decodeColumn(ctx, tenantId, did, presentationDefinitionColumn, ddefinition)
 
 		if err != nil {
 			return nil, err
@@ -97,7 +137,7 @@ func getEntriesFromDb(ctx context.Context, tenantId string, id string, searchFie
 
 		}
 
-		bPresentation, err := base64.RawStdEncoding.DecodeString(dpresentation)
+		bPresentation, stalePresentation, err := decodeColumn(ctx, tenantId, did, presentationColumn, dpresentation)
 
 		if err != nil {
 			return nil, err
@@ -115,6 +155,30 @@ func getEntriesFromDb(ctx context.Context, tenantId string, id string, searchFie
 			row.Presentation = p
 		}
 
+		bClaims, staleClaims, err := decodeColumn(ctx, tenantId, did, claimsColumn, dclaims)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(bClaims) > 0 {
+			err = json.Unmarshal(bClaims, &row.Claims)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if staleDefinition || stalePresentation || staleClaims {
+			err = reencryptEntry(ctx, tenantId, did, model.Status(dstate), bpresentatioDefinition, bPresentation, bClaims)
+
+			if err != nil {
+				env.GetLogger().Error(err, "Error during re-encryption of entry.", "id", did)
+			}
+		}
+
+		expireEntry(ctx, tenantId, &row)
+
 		ret = append(ret, row)
 	}
 
@@ -125,8 +189,50 @@ func getEntriesFromDb(ctx context.Context, tenantId string, id string, searchFie
 	return ret, nil
 }
 
+func getEntriesFromDb(ctx context.Context, tenantId string, ids ...string) ([]model.VerificationEntry, error) {
+	ret := make([]model.VerificationEntry, 0)
+
+	for _, id := range ids {
+		rows, err := queryEntryFromDb(ctx, tenantId, id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, rows...)
+	}
+
+	return ret, nil
+}
+
+// lookupIds reads the presentation ids from a denormalized lookup table.
+func lookupIds(ctx context.Context, tenantId string, table string, column string, value string) ([]string, error) {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	var id string
+	ret := make([]string, 0)
+
+	queryString := fmt.Sprintf(`SELECT id FROM %s.%s WHERE region=? AND country=? AND %s=?;`, tenantId, table, column)
+
+	query := session.Query(queryString,
+		env.GetRegion(),
+		env.GetCountry(),
+		value).WithContext(ctx).Consistency(gocql.LocalQuorum).Iter()
+
+	for query.Scan(&id) {
+		ret = append(ret, id)
+	}
+
+	if err := query.Close(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
 func GetEntryFromDb(ctx context.Context, tenantId string, id string) (*model.VerificationEntry, error) {
-	rows, err := getEntriesFromDb(ctx, tenantId, id, "id")
+	rows, err := getEntriesFromDb(ctx, tenantId, id)
 	if len(rows) > 0 {
 		return &rows[0], err
 	} else {
@@ -135,7 +241,13 @@ func GetEntryFromDb(ctx context.Context, tenantId string, id string) (*model.Ver
 }
 
 func GetEntryFromDbByRequestId(ctx context.Context, tenantId string, requestId string) (*model.VerificationEntry, error) {
-	rows, err := getEntriesFromDb(ctx, tenantId, requestId, "requestId")
+	ids, err := lookupIds(ctx, tenantId, requestLookupTable, "requestId", requestId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := getEntriesFromDb(ctx, tenantId, ids...)
 	if len(rows) > 0 {
 		return &rows[0], err
 	} else {
@@ -150,13 +262,17 @@ type PresentationRequestOptions struct {
 	GroupId   string `json:"groupId"`
 	// in seconds
 	Ttl int `json:"ttl"`
+	// WebhookUrl overrides the webhook url of the tenant for this request
+	WebhookUrl string `json:"webhookUrl"`
+	// ClientId is the did of the verifier, used in the authorization request and the request object
+	ClientId string `json:"clientId"`
 }
 
 func AddPresentationDefinitonToDb(presentationDefinition presentation.PresentationDefinition, options PresentationRequestOptions, ctx context.Context) error {
 	env := common.GetEnvironment()
 	session := env.GetSession()
 
-	queryString := fmt.Sprintf(`INSERT INTO %s.presentations (region,country,id,presentationDefinition,state,last_update_timestamp,requestId,nonce, groupid) VALUES(?,?,?,?,?,toTimestamp(now()),?,?,?) USING TTL ?;`, options.TenantId)
+	queryString := fmt.Sprintf(`INSERT INTO %s.presentations (region,country,id,presentationDefinition,state,last_update_timestamp,requestId,nonce, groupid,expires_at,webhook_url,clientId) VALUES(?,?,?,?,?,toTimestamp(now()),?,?,?,?,?,?) USING TTL ?;`, options.TenantId)
 
 	pD, err := json.Marshal(presentationDefinition)
 
@@ -173,17 +289,61 @@ func AddPresentationDefinitonToDb(presentationDefinition presentation.Presentati
 		return err
 	}
 
-	err = session.Query(queryString,
+	encDefinition, err := encodeColumn(ctx, options.TenantId, options.Id, presentationDefinitionColumn, pD)
+
+	if err != nil {
+		env.GetLogger().Error(err, "Error encrypting definition.")
+		return err
+	}
+
+	ttl := recordTtl(options.Ttl, env.GetConfig().ExpiredRetention)
+	expires := expiresAt(options.Ttl)
+
+	batch := session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+
+	batch.Query(queryString,
 		env.GetRegion(),  // region
 		env.GetCountry(), //country
 		options.Id,
-		base64.RawStdEncoding.EncodeToString(pD), //presentation Definition
-		model.PresentationRequested,              //status
+		encDefinition,               //presentation Definition
+		model.PresentationRequested, //status
 		options.RequestId,
 		base64.RawStdEncoding.EncodeToString(b), //nonce
 		options.GroupId,
-		options.Ttl, //TTL
-	).WithContext(ctx).Exec()
+		expires,
+		options.WebhookUrl,
+		options.ClientId,
+		ttl, //TTL
+	)
+
+	if options.RequestId != "" {
+		addLookup(batch, options.TenantId, requestLookupTable, "requestId", options.RequestId, options.Id, ttl)
+	}
+
+	if options.GroupId != "" {
+		addLookup(batch, options.TenantId, groupLookupTable, "groupId", options.GroupId, options.Id, ttl)
+	}
+
+	if t, ok := expires.(time.Time); ok {
+		addExpiry(batch, options.TenantId, options.Id, t, ttl)
+	}
+
+	audit := appendAudit(ctx, batch, options.TenantId, options.Id, string(model.PresentationRequested), "")
+
+	row := &model.VerificationEntry{
+		Id:         options.Id,
+		RequestId:  options.RequestId,
+		GroupId:    options.GroupId,
+		State:      string(model.PresentationRequested),
+		WebhookUrl: options.WebhookUrl,
+		ClientId:   options.ClientId,
+	}
+
+	if t, ok := expires.(time.Time); ok {
+		row.ExpiresAt = t
+	}
+
+	err = executeWithAudit(batch, options.TenantId, row, audit)
 
 	if err != nil {
 		env.GetLogger().Error(err, "Error during db update.")
@@ -193,24 +353,106 @@ func AddPresentationDefinitonToDb(presentationDefinition presentation.Presentati
 	return nil
 }
 
+func expiresAt(ttl int) interface{} {
+	if ttl <= 0 {
+		return nil
+	}
+	return time.Now().Add(time.Duration(ttl) * time.Second)
+}
+
+func addLookup(batch *gocql.Batch, tenantId string, table string, column string, value string, id string, ttl int) {
+	env := common.GetEnvironment()
+
+	queryString := fmt.Sprintf(`INSERT INTO %s.%s (region,country,%s,id) VALUES(?,?,?,?) USING TTL ?;`, tenantId, table, column)
+
+	batch.Query(queryString,
+		env.GetRegion(),
+		env.GetCountry(),
+		value,
+		id,
+		ttl)
+}
+
+func removeLookup(batch *gocql.Batch, tenantId string, table string, column string, value string, id string) {
+	env := common.GetEnvironment()
+
+	queryString := fmt.Sprintf(`DELETE FROM %s.%s WHERE region=? AND country=? AND %s=? AND id=?;`, tenantId, table, column)
+
+	batch.Query(queryString,
+		env.GetRegion(),
+		env.GetCountry(),
+		value,
+		id)
+}
+
+// getRemainingTtl returns the remaining ttl of a record, 0 if it has none.
+func getRemainingTtl(ctx context.Context, tenantId string, id string) (int, error) {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	var ttl int
+
+	queryString := fmt.Sprintf(`SELECT TTL(state) FROM %s.presentations WHERE region=? AND country=? AND id=?;`, tenantId)
+
+	err := session.Query(queryString,
+		env.GetRegion(),
+		env.GetCountry(),
+		id).WithContext(ctx).Consistency(gocql.LocalQuorum).Scan(&ttl)
+
+	if err == gocql.ErrNotFound {
+		return 0, nil
+	}
+
+	return ttl, err
+}
+
 func GetEntriesFromDb(ctx context.Context, tenantId string, id string) ([]model.VerificationEntry, error) {
-	return getEntriesFromDb(ctx, tenantId, id, "groupId")
+	ids, err := lookupIds(ctx, tenantId, groupLookupTable, "groupId", id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getEntriesFromDb(ctx, tenantId, ids...)
 }
 
 func AssignEntryToGroup(ctx context.Context, tenantId string, id string, groupId string) error {
 	env := common.GetEnvironment()
 	session := env.GetSession()
 
-	queryString := fmt.Sprintf(`UPDATE %s.presentations SET groupId=?,last_update_timestamp=toTimestamp(now()) WHERE 
-		region=? AND 
-		country=? AND
-		id=?;`, tenantId)
+	row, err := GetEntryFromDb(ctx, tenantId, id)
 
-	err := session.Query(queryString,
-		groupId,          //groupId
-		env.GetRegion(),  // region
-		env.GetCountry(), //country
-		id).WithContext(ctx).Exec()
+	if err != nil {
+		return err
+	}
+
+	ttl, err := getRemainingTtl(ctx, tenantId, id)
+
+	if err != nil {
+		env.GetLogger().Error(err, "Error during ttl read.")
+		return err
+	}
+
+	// the group is only changed if no transition happened since the read
+	err = updateEntry(ctx, tenantId, id, ttl, []model.Status{model.Status(row.State)}, "groupId=?,last_update_timestamp=toTimestamp(now())", groupId)
+
+	if err != nil {
+		env.GetLogger().Error(err, "Error during db update.")
+		return err
+	}
+
+	batch := session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+
+	if row.GroupId != "" && row.GroupId != groupId {
+		removeLookup(batch, tenantId, groupLookupTable, "groupId", row.GroupId, id)
+	}
+
+	addLookup(batch, tenantId, groupLookupTable, "groupId", groupId, id, ttl)
+
+	audit := appendAudit(ctx, batch, tenantId, id, row.State, "assigned to group "+groupId)
+	row.GroupId = groupId
+
+	err = executeWithAudit(batch, tenantId, row, audit)
 
 	if err != nil {
 		env.GetLogger().Error(err, "Error during db update.")
@@ -220,19 +462,52 @@ func AssignEntryToGroup(ctx context.Context, tenantId string, id string, groupId
 }
 
 func UpdateDbStatus(ctx context.Context, tenantId string, status string, id string) error {
+	return UpdateDbStatusWithOutcome(ctx, tenantId, status, id, "")
+}
+
+// UpdateDbStatusWithOutcome updates the state and records the verification outcome in the audit trail.
+// ErrInvalidTransition is returned if the current state does not allow the transition.
+func UpdateDbStatusWithOutcome(ctx context.Context, tenantId string, status string, id string, outcome string) error {
 	env := common.GetEnvironment()
-	session := env.GetSession()
 
-	queryString := fmt.Sprintf(`UPDATE %s.presentations SET state=?,last_update_timestamp=toTimestamp(now()) WHERE 
-		region=? AND 
-		country=? AND
-		id=?;`, tenantId)
+	err := transitionState(ctx, tenantId, id, model.Status(status), outcome, nil, "")
 
-	err := session.Query(queryString,
-		status,           //status
-		env.GetRegion(),  // region
-		env.GetCountry(), //country
-		id).WithContext(ctx).Exec()
+	if err != nil {
+		env.GetLogger().Error(err, "Error during db update.")
+		return err
+	}
+	return nil
+}
+
+// StorePresentation stores the received presentation and its extracted claims, either can be empty.
+func StorePresentation(ctx context.Context, id string, tenantId string, proof []byte, claims []byte) error {
+	env := common.GetEnvironment()
+
+	encProof, err := encodeColumn(ctx, tenantId, id, presentationColumn, proof)
+
+	if err != nil {
+		env.GetLogger().Error(err, "Error encrypting presentation.")
+		return err
+	}
+
+	encClaims, err := encodeColumn(ctx, tenantId, id, claimsColumn, claims)
+
+	if err != nil {
+		env.GetLogger().Error(err, "Error encrypting claims.")
+		return err
+	}
+
+	var row model.VerificationEntry
+
+	if len(claims) > 0 {
+		if err = json.Unmarshal(claims, &row.Claims); err != nil {
+			return err
+		}
+	}
+
+	err = transitionState(ctx, tenantId, id, model.PresentationReceived, OutcomeValid, func(r *model.VerificationEntry) {
+		r.Claims = row.Claims
+	}, ",presentation=?,claims=?", encProof, encClaims)
 
 	if err != nil {
 		env.GetLogger().Error(err, "Error during db update.")
@@ -241,21 +516,24 @@ func UpdateDbStatus(ctx context.Context, tenantId string, status string, id stri
 	return nil
 }
 
-func StorePresentation(ctx context.Context, id string, tenantId string, proof []byte) error {
+// StoreSchemaResults records the schema validation of the received presentation. The remaining ttl of the record is kept.
+func StoreSchemaResults(ctx context.Context, tenantId string, id string, results []model.SchemaResult) error {
 	env := common.GetEnvironment()
-	session := env.GetSession()
 
-	queryString := fmt.Sprintf(`UPDATE %s.presentations SET state=?,last_update_timestamp=toTimestamp(now()),presentation=? WHERE
-		region=? AND
-		country=? AND
-		id=?;`, tenantId)
+	b, err := json.Marshal(results)
 
-	err := session.Query(queryString,
-		model.PresentationReceived, //status
-		base64.RawStdEncoding.EncodeToString(proof),
-		env.GetRegion(),  // region
-		env.GetCountry(), //country
-		id).WithContext(ctx).Exec()
+	if err != nil {
+		return err
+	}
+
+	ttl, err := getRemainingTtl(ctx, tenantId, id)
+
+	if err != nil {
+		return err
+	}
+
+	// the results belong to the presentation which is being received
+	err = updateEntry(ctx, tenantId, id, ttl, model.PresentationReceived.Predecessors(), "schema_validation=?", string(b))
 
 	if err != nil {
 		env.GetLogger().Error(err, "Error during db update.")
@@ -268,10 +546,11 @@ func StoreRequest(ctx context.Context, requestId string, tenantId string, id str
 	env := common.GetEnvironment()
 	session := env.GetSession()
 
-	queryString := fmt.Sprintf(`UPDATE %s.presentations SET state=?,last_update_timestamp=toTimestamp(now()),presentationDefinition=?,redirectUri=?,nonce=?,requestId=?,responseUri=?,responseMode=?,responseType=?,ClientId=? WHERE 
-		region=? AND 
-		country=? AND
-		id=?;`, tenantId)
+	// records of the authorization flow have no ttl, the lookup is written with the same ttl as the record
+	ttl := 0
+
+	// the record is created with a lightweight transaction like all state changes of the table
+	queryString := fmt.Sprintf(`INSERT INTO %s.presentations (region,country,id,state,last_update_timestamp,presentationDefinition,redirectUri,nonce,requestId,responseUri,responseMode,responseType,clientId) VALUES(?,?,?,?,toTimestamp(now()),?,?,?,?,?,?,?,?) IF NOT EXISTS USING TTL ?;`, tenantId)
 
 	b, err := json.Marshal(requestObject.PresentationDefinition)
 
@@ -280,9 +559,20 @@ func StoreRequest(ctx context.Context, requestId string, tenantId string, id str
 		return err
 	}
 
-	err = session.Query(queryString,
+	encDefinition, err := encodeColumn(ctx, tenantId, id, presentationDefinitionColumn, b)
+
+	if err != nil {
+		env.GetLogger().Logger.Error(err, "Error encrypting definition.")
+		return err
+	}
+
+	previous := make(map[string]interface{})
+	applied, err := session.Query(queryString,
+		env.GetRegion(),  // region
+		env.GetCountry(), //country
+		id,
 		model.PresentationRequested, //status
-		base64.RawStdEncoding.EncodeToString(b),
+		encDefinition,
 		requestObject.RedirectUri,
 		requestObject.Nonce,
 		requestId,
@@ -290,9 +580,31 @@ func StoreRequest(ctx context.Context, requestId string, tenantId string, id str
 		requestObject.ResponseMode,
 		requestObject.ResponseType,
 		requestObject.ClientID,
-		env.GetRegion(),  // region
-		env.GetCountry(), //country
-		id).WithContext(ctx).Exec()
+		ttl).WithContext(ctx).SerialConsistency(gocql.LocalSerial).MapScanCAS(previous)
+
+	if err != nil {
+		env.GetLogger().Logger.Error(err, "Error during db update.")
+		return err
+	}
+
+	if !applied {
+		return fmt.Errorf("%w: record %s exists", ErrInvalidTransition, id)
+	}
+
+	batch := session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+
+	addLookup(batch, tenantId, requestLookupTable, "requestId", requestId, id, ttl)
+
+	audit := appendAudit(ctx, batch, tenantId, id, string(model.PresentationRequested), "")
+
+	row := &model.VerificationEntry{
+		Id:        id,
+		RequestId: requestId,
+		ClientId:  requestObject.ClientID,
+		State:     string(model.PresentationRequested),
+	}
+
+	err = executeWithAudit(batch, tenantId, row, audit)
 
 	if err != nil {
 		env.GetLogger().Logger.Error(err, "Error during db update.")
@@ -0,0 +1,134 @@
+package common
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/gocql/gocql"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/encryption"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+)
+
+const (
+	presentationDefinitionColumn = "presentationDefinition"
+	presentationColumn           = "presentation"
+	claimsColumn                 = "claims"
+)
+
+type dataKeyStore struct{}
+
+// NewDataKeyStore returns a store which keeps the wrapped data keys in the data_keys table of the tenant.
+func NewDataKeyStore() encryption.DataKeyStore {
+	return &dataKeyStore{}
+}
+
+func (store *dataKeyStore) LoadDataKeys(ctx context.Context, tenantId string) ([]encryption.DataKey, error) {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	var key encryption.DataKey
+	ret := make([]encryption.DataKey, 0)
+
+	queryString := fmt.Sprintf(`SELECT id,kekid,wrappedkey,created FROM %s.data_keys WHERE region=? AND country=? AND bucket IN ?;`, tenantId)
+
+	query := session.Query(queryString,
+		env.GetRegion(),
+		env.GetCountry(),
+		allBuckets()).WithContext(ctx).Consistency(gocql.LocalQuorum).Iter()
+
+	for query.Scan(&key.Id, &key.KekId, &key.WrappedKey, &key.Created) {
+		ret = append(ret, key)
+	}
+
+	if err := query.Close(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (store *dataKeyStore) SaveDataKey(ctx context.Context, tenantId string, key encryption.DataKey) error {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	queryString := fmt.Sprintf(`INSERT INTO %s.data_keys (region,country,bucket,id,kekid,wrappedkey,created) VALUES(?,?,?,?,?,?,?);`, tenantId)
+
+	return session.Query(queryString,
+		env.GetRegion(),
+		env.GetCountry(),
+		bucketOf(key.Id),
+		key.Id,
+		key.KekId,
+		key.WrappedKey,
+		key.Created).WithContext(ctx).Exec()
+}
+
+func encodeColumn(ctx context.Context, tenantId string, id string, column string, value []byte) (string, error) {
+	envelope := common.GetEnvironment().GetEnvelope()
+
+	if envelope == nil || len(value) == 0 {
+		return base64.RawStdEncoding.EncodeToString(value), nil
+	}
+
+	return envelope.Encrypt(ctx, tenantId, value, id+"|"+column)
+}
+
+// decodeColumn returns the plain column value. The flag is true if the value should be re-encrypted.
+func decodeColumn(ctx context.Context, tenantId string, id string, column string, value string) ([]byte, bool, error) {
+	envelope := common.GetEnvironment().GetEnvelope()
+
+	if !encryption.IsEncrypted(value) {
+		b, err := base64.RawStdEncoding.DecodeString(value)
+		return b, envelope != nil && len(b) > 0, err
+	}
+
+	if envelope == nil {
+		return nil, false, errors.New("encrypted value found, but encryption is not configured")
+	}
+
+	return envelope.Decrypt(ctx, tenantId, value, id+"|"+column)
+}
+
+// reencryptEntry writes the columns again with the active data key and keeps the remaining ttl of the record.
+// The columns are only written if the state did not change since they were read, otherwise a presentation
+// stored in between would be overwritten.
+func reencryptEntry(ctx context.Context, tenantId string, id string, state model.Status, definition []byte, presentation []byte, claims []byte) error {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	var ttl int
+
+	queryString := fmt.Sprintf(`SELECT TTL(presentationDefinition) FROM %s.presentations WHERE region=? AND country=? AND id=?;`, tenantId)
+
+	err := session.Query(queryString,
+		env.GetRegion(),
+		env.GetCountry(),
+		id).WithContext(ctx).Consistency(gocql.LocalQuorum).Scan(&ttl)
+
+	if err != nil {
+		return err
+	}
+
+	encDefinition, err := encodeColumn(ctx, tenantId, id, presentationDefinitionColumn, definition)
+
+	if err != nil {
+		return err
+	}
+
+	encPresentation, err := encodeColumn(ctx, tenantId, id, presentationColumn, presentation)
+
+	if err != nil {
+		return err
+	}
+
+	encClaims, err := encodeColumn(ctx, tenantId, id, claimsColumn, claims)
+
+	if err != nil {
+		return err
+	}
+
+	return updateEntry(ctx, tenantId, id, ttl, []model.Status{state}, "presentationDefinition=?,presentation=?,claims=?", encDefinition, encPresentation, encClaims)
+}
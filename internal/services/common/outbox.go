@@ -0,0 +1,361 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+)
+
+const outboxTable = "response_outbox"
+
+// OutboxItem is one pending post of a signed presentation to the response uri.
+type OutboxItem struct {
+	TenantId    string
+	Id          string
+	Seq         int
+	ResponseUri string
+	Form        string
+	Attempts    int
+	NextAttempt time.Time
+	Deadline    time.Time
+	LastError   string
+}
+
+func outboxColumn(seq int) string {
+	return fmt.Sprintf("outbox.%d", seq)
+}
+
+// setDelivery adds the update of the delivery columns to the batch. The remaining ttl of the record is kept.
+func setDelivery(batch *gocql.Batch, tenantId string, id string, ttl int, delivery model.Delivery) {
+	env := common.GetEnvironment()
+
+	queryString := fmt.Sprintf(`UPDATE %s.presentations USING TTL ? SET delivery_status=?,delivery_attempts=?,delivery_error=?,delivery_deadline=? WHERE
+		region=? AND
+		country=? AND
+		id=?;`, tenantId)
+
+	batch.Query(queryString,
+		ttl,
+		string(delivery.Status),
+		delivery.Attempts,
+		delivery.LastError,
+		delivery.Deadline,
+		env.GetRegion(),
+		env.GetCountry(),
+		id)
+}
+
+// deliveryCondition returns the values of the delivery state which was read, null if there was none.
+func deliveryCondition(delivery *model.Delivery) (interface{}, interface{}) {
+	if delivery == nil {
+		return nil, nil
+	}
+	return string(delivery.Status), delivery.Deadline
+}
+
+// ClaimDelivery marks the delivery of a presentation as pending before it is signed. The compare and set on
+// the delivery state which was read lets only one of concurrent callers sign and post the presentation. If
+// the claim is not applied, the current delivery is returned.
+func ClaimDelivery(ctx context.Context, tenantId string, id string, current *model.Delivery, deadline time.Time) (bool, *model.Delivery, error) {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	ttl, err := getRemainingTtl(ctx, tenantId, id)
+
+	if err != nil {
+		return false, nil, err
+	}
+
+	queryString := fmt.Sprintf(`UPDATE %s.presentations USING TTL ? SET delivery_status=?,delivery_attempts=?,delivery_error=?,delivery_deadline=? WHERE
+		region=? AND
+		country=? AND
+		id=? IF delivery_status=? AND delivery_deadline=?;`, tenantId)
+
+	status, previousDeadline := deliveryCondition(current)
+	previous := make(map[string]interface{})
+
+	applied, err := session.Query(queryString,
+		ttl,
+		string(model.DeliveryPending),
+		0,
+		"",
+		deadline,
+		env.GetRegion(),
+		env.GetCountry(),
+		id,
+		status,
+		previousDeadline).WithContext(ctx).SerialConsistency(gocql.LocalSerial).MapScanCAS(previous)
+
+	if err != nil || applied {
+		return applied, nil, err
+	}
+
+	delivery := &model.Delivery{}
+	if s, ok := previous["delivery_status"].(string); ok {
+		delivery.Status = model.DeliveryStatus(s)
+	}
+	if d, ok := previous["delivery_deadline"].(time.Time); ok {
+		delivery.Deadline = d
+	}
+
+	return false, delivery, nil
+}
+
+// ReleaseDelivery restores the delivery state of a claim which was given up before anything was queued.
+func ReleaseDelivery(ctx context.Context, tenantId string, id string, previous *model.Delivery, deadline time.Time) error {
+	env := common.GetEnvironment()
+
+	queryString := fmt.Sprintf(`UPDATE %s.presentations SET delivery_status=?,delivery_attempts=?,delivery_error=?,delivery_deadline=? WHERE
+		region=? AND
+		country=? AND
+		id=? IF delivery_status=? AND delivery_deadline=?;`, tenantId)
+
+	status, previousDeadline := deliveryCondition(previous)
+	var attempts, lastError interface{}
+
+	if previous != nil {
+		attempts, lastError = previous.Attempts, previous.LastError
+	}
+
+	_, err := env.GetSession().Query(queryString,
+		status,
+		attempts,
+		lastError,
+		previousDeadline,
+		env.GetRegion(),
+		env.GetCountry(),
+		id,
+		string(model.DeliveryPending),
+		deadline).WithContext(ctx).SerialConsistency(gocql.LocalSerial).MapScanCAS(make(map[string]interface{}))
+
+	return err
+}
+
+// AddToOutbox persists the form posts of a presentation together with the pending delivery state. The items
+// are leased until now plus lease, so that the caller can try the first delivery without concurrent workers.
+func AddToOutbox(ctx context.Context, tenantId string, row *model.VerificationEntry, forms []string, deadline time.Time, lease time.Duration) error {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	ttl, err := getRemainingTtl(ctx, tenantId, row.Id)
+
+	if err != nil {
+		return err
+	}
+
+	queryString := fmt.Sprintf(`INSERT INTO %s.%s (region,country,bucket,id,seq,response_uri,form,attempts,next_attempt,deadline,last_error) VALUES(?,?,?,?,?,?,?,?,?,?,?) USING TTL ?;`, tenantId, outboxTable)
+
+	// items are removed on delivery and dead lettering, the ttl only cleans up after crashes
+	outboxTtl := int(time.Until(deadline).Seconds()) + int(lease.Seconds()) + 3600
+
+	batch := session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+
+	for seq, form := range forms {
+		encForm, err := encodeColumn(ctx, tenantId, row.Id, outboxColumn(seq), []byte(form))
+
+		if err != nil {
+			return err
+		}
+
+		batch.Query(queryString,
+			env.GetRegion(),
+			env.GetCountry(),
+			bucketOf(row.Id),
+			row.Id,
+			seq,
+			row.ResponseUri,
+			encForm,
+			0,
+			time.Now().Add(lease),
+			deadline,
+			"",
+			outboxTtl)
+	}
+
+	setDelivery(batch, tenantId, row.Id, ttl, model.Delivery{Status: model.DeliveryPending, Deadline: deadline})
+
+	return session.ExecuteBatch(batch)
+}
+
+// GetOutboxItems reads the pending items of a presentation.
+func GetOutboxItems(ctx context.Context, tenantId string, id string) ([]OutboxItem, error) {
+	return queryOutbox(ctx, tenantId, bucketOf(id), id)
+}
+
+// GetOutboxBucket reads the pending items of all presentations of the tenant in the partition bucket.
+func GetOutboxBucket(ctx context.Context, tenantId string, bucket int) ([]OutboxItem, error) {
+	return queryOutbox(ctx, tenantId, bucket, "")
+}
+
+func queryOutbox(ctx context.Context, tenantId string, bucket int, id string) ([]OutboxItem, error) {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	queryString := fmt.Sprintf(`SELECT id,seq,response_uri,form,attempts,next_attempt,deadline,last_error FROM %s.%s WHERE region=? AND country=? AND bucket=?`, tenantId, outboxTable)
+	args := []interface{}{env.GetRegion(), env.GetCountry(), bucket}
+
+	if id != "" {
+		queryString += ` AND id=?`
+		args = append(args, id)
+	}
+
+	query := session.Query(queryString+";", args...).WithContext(ctx).Consistency(gocql.LocalQuorum).Iter()
+
+	ret := make([]OutboxItem, 0)
+	var item OutboxItem
+	var form string
+
+	for query.Scan(&item.Id, &item.Seq, &item.ResponseUri, &form, &item.Attempts, &item.NextAttempt, &item.Deadline, &item.LastError) {
+		b, _, err := decodeColumn(ctx, tenantId, item.Id, outboxColumn(item.Seq), form)
+
+		if err != nil {
+			query.Close()
+			return nil, err
+		}
+
+		item.TenantId = tenantId
+		item.Form = string(b)
+		ret = append(ret, item)
+	}
+
+	if err := query.Close(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// ClaimOutboxItem leases the item with a compare and set on its next attempt. False is returned if another
+// worker claimed it first.
+func ClaimOutboxItem(ctx context.Context, item *OutboxItem, lease time.Duration) (bool, error) {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	queryString := fmt.Sprintf(`UPDATE %s.%s SET next_attempt=? WHERE region=? AND country=? AND bucket=? AND id=? AND seq=? IF next_attempt=?;`, item.TenantId, outboxTable)
+
+	until := time.Now().Add(lease)
+	previous := make(map[string]interface{})
+
+	applied, err := session.Query(queryString,
+		until,
+		env.GetRegion(),
+		env.GetCountry(),
+		bucketOf(item.Id),
+		item.Id,
+		item.Seq,
+		item.NextAttempt).WithContext(ctx).SerialConsistency(gocql.LocalSerial).MapScanCAS(previous)
+
+	if err != nil || !applied {
+		return false, err
+	}
+
+	item.NextAttempt = until
+	return true, nil
+}
+
+// CompleteOutboxItem removes a delivered item.
+func CompleteOutboxItem(ctx context.Context, item *OutboxItem) error {
+	env := common.GetEnvironment()
+
+	queryString := fmt.Sprintf(`DELETE FROM %s.%s WHERE region=? AND country=? AND bucket=? AND id=? AND seq=?;`, item.TenantId, outboxTable)
+
+	return env.GetSession().Query(queryString,
+		env.GetRegion(),
+		env.GetCountry(),
+		bucketOf(item.Id),
+		item.Id,
+		item.Seq).WithContext(ctx).Exec()
+}
+
+// RescheduleOutboxItem records a failed attempt and the time of the next one.
+func RescheduleOutboxItem(ctx context.Context, item *OutboxItem, next time.Time, lastError string) error {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	ttl, err := getRemainingTtl(ctx, item.TenantId, item.Id)
+
+	if err != nil {
+		return err
+	}
+
+	queryString := fmt.Sprintf(`UPDATE %s.%s SET attempts=?,next_attempt=?,last_error=? WHERE region=? AND country=? AND bucket=? AND id=? AND seq=?;`, item.TenantId, outboxTable)
+
+	batch := session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+
+	batch.Query(queryString,
+		item.Attempts,
+		next,
+		lastError,
+		env.GetRegion(),
+		env.GetCountry(),
+		bucketOf(item.Id),
+		item.Id,
+		item.Seq)
+
+	setDelivery(batch, item.TenantId, item.Id, ttl, model.Delivery{Status: model.DeliveryPending, Attempts: item.Attempts, LastError: lastError, Deadline: item.Deadline})
+
+	return session.ExecuteBatch(batch)
+}
+
+// DeadLetterOutbox gives up the delivery of a presentation. Its items are removed and the failure is recorded
+// in the delivery state and the audit trail.
+func DeadLetterOutbox(ctx context.Context, tenantId string, row *model.VerificationEntry, delivery model.Delivery) error {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	ttl, err := getRemainingTtl(ctx, tenantId, row.Id)
+
+	if err != nil {
+		return err
+	}
+
+	queryString := fmt.Sprintf(`DELETE FROM %s.%s WHERE region=? AND country=? AND bucket=? AND id=?;`, tenantId, outboxTable)
+
+	batch := session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+
+	batch.Query(queryString,
+		env.GetRegion(),
+		env.GetCountry(),
+		bucketOf(row.Id),
+		row.Id)
+
+	delivery.Status = model.DeliveryDeadLettered
+	setDelivery(batch, tenantId, row.Id, ttl, delivery)
+
+	audit := appendAudit(ctx, batch, tenantId, row.Id, row.State, "delivery dead-lettered: "+delivery.LastError)
+
+	return executeWithAudit(batch, tenantId, row, audit)
+}
+
+// CompleteDelivery marks the presentation as transmitted after all items were delivered.
+func CompleteDelivery(ctx context.Context, tenantId string, id string, attempts int) error {
+	return transitionState(ctx, tenantId, id, model.PresentationTransmitted, "", nil, ",delivery_status=?,delivery_attempts=?,delivery_error=?", string(model.DeliveryDelivered), attempts, "")
+}
+
+// OutboxTenants returns the tenant keyspaces which have an outbox table.
+func OutboxTenants(ctx context.Context) ([]string, error) {
+	return tenantsWithTable(ctx, outboxTable)
+}
+
+func tenantsWithTable(ctx context.Context, table string) ([]string, error) {
+	session := common.GetEnvironment().GetSession()
+
+	query := session.Query(`SELECT keyspace_name FROM system_schema.tables WHERE table_name=? ALLOW FILTERING;`, table).WithContext(ctx).Iter()
+
+	ret := make([]string, 0)
+	var keyspace string
+
+	for query.Scan(&keyspace) {
+		ret = append(ret, keyspace)
+	}
+
+	if err := query.Close(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,280 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+)
+
+var ErrInvalidTransition = errors.New("state transition not allowed")
+
+// transitionState sets the new state with a lightweight transaction, which is only applied if the
+// current state allows the transition. Additional columns can be set with the same statement, apply
+// updates the snapshot of the record for the audit listeners with them.
+func transitionState(ctx context.Context, tenantId string, id string, status model.Status, outcome string, apply func(row *model.VerificationEntry), columns string, values ...interface{}) error {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	predecessors := make([]string, 0)
+	for _, p := range status.Predecessors() {
+		predecessors = append(predecessors, string(p))
+	}
+
+	if len(predecessors) == 0 {
+		return fmt.Errorf("%w: %s is an initial state", ErrInvalidTransition, status)
+	}
+
+	// keep the ttl of the record, otherwise the updated cells would outlive it
+	row, ttl, err := readSnapshot(ctx, tenantId, id)
+
+	if err != nil {
+		return err
+	}
+
+	queryString := fmt.Sprintf(`UPDATE %s.presentations USING TTL ? SET state=?,last_update_timestamp=toTimestamp(now())%s WHERE
+		region=? AND
+		country=? AND
+		id=? IF state IN ?;`, tenantId, columns)
+
+	args := append([]interface{}{ttl, status}, values...)
+	args = append(args, env.GetRegion(), env.GetCountry(), id, predecessors)
+
+	previous := make(map[string]interface{})
+	applied, err := session.Query(queryString, args...).
+		WithContext(ctx).
+		SerialConsistency(gocql.LocalSerial).
+		MapScanCAS(previous)
+
+	if err != nil {
+		return err
+	}
+
+	if !applied {
+		current, ok := previous["state"]
+		if !ok {
+			return fmt.Errorf("%w: record %s not found", ErrInvalidTransition, id)
+		}
+		return fmt.Errorf("%w: %v to %s", ErrInvalidTransition, current, status)
+	}
+
+	row.State = string(status)
+	if apply != nil {
+		apply(row)
+	}
+
+	// the lightweight transaction can not be batched with the audit partition, the transition is applied
+	// even if the audit write fails. The error is returned, so that no transition is reported without audit.
+	batch := session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	audit := appendAudit(ctx, batch, tenantId, id, string(status), outcome)
+
+	err = executeWithAudit(batch, tenantId, row, audit)
+
+	if err != nil {
+		env.GetLogger().Error(err, "Error during audit write.", "id", id, "state", status)
+		return fmt.Errorf("audit of transition to %s: %w", status, err)
+	}
+
+	return nil
+}
+
+// updateEntry sets columns of a record with a lightweight transaction, which is only applied if the record is
+// in one of the states. Column updates are conditional like the transitions, so that they are serialized with
+// them and do not overwrite them.
+func updateEntry(ctx context.Context, tenantId string, id string, ttl int, states []model.Status, columns string, values ...interface{}) error {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	queryString := fmt.Sprintf(`UPDATE %s.presentations USING TTL ? SET %s WHERE
+		region=? AND
+		country=? AND
+		id=? IF state IN ?;`, tenantId, columns)
+
+	conditions := make([]string, 0)
+	for _, s := range states {
+		conditions = append(conditions, string(s))
+	}
+
+	args := append([]interface{}{ttl}, values...)
+	args = append(args, env.GetRegion(), env.GetCountry(), id, conditions)
+
+	previous := make(map[string]interface{})
+	applied, err := session.Query(queryString, args...).
+		WithContext(ctx).
+		SerialConsistency(gocql.LocalSerial).
+		MapScanCAS(previous)
+
+	if err != nil {
+		return err
+	}
+
+	if !applied {
+		current, ok := previous["state"]
+		if !ok {
+			return fmt.Errorf("%w: record %s not found", ErrInvalidTransition, id)
+		}
+		return fmt.Errorf("%w: record is %v", ErrInvalidTransition, current)
+	}
+
+	return nil
+}
+
+// readSnapshot reads the remaining ttl of a record together with the columns the audit listeners need, so
+// that they get the record of the transition without reading it again.
+func readSnapshot(ctx context.Context, tenantId string, id string) (*model.VerificationEntry, int, error) {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	row := &model.VerificationEntry{Id: id}
+	var ttl int
+	var schemaValidation, claims string
+
+	queryString := fmt.Sprintf(`SELECT TTL(state),state,requestId,groupId,clientId,expires_at,webhook_url,schema_validation,claims FROM %s.presentations WHERE region=? AND country=? AND id=?;`, tenantId)
+
+	err := session.Query(queryString,
+		env.GetRegion(),
+		env.GetCountry(),
+		id).WithContext(ctx).Consistency(gocql.LocalQuorum).Scan(&ttl, &row.State, &row.RequestId, &row.GroupId, &row.ClientId, &row.ExpiresAt, &row.WebhookUrl, &schemaValidation, &claims)
+
+	if err == gocql.ErrNotFound {
+		// the transition reports the missing record
+		return row, 0, nil
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if schemaValidation != "" {
+		if err = json.Unmarshal([]byte(schemaValidation), &row.SchemaValidation); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	bClaims, _, err := decodeColumn(ctx, tenantId, id, claimsColumn, claims)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(bClaims) > 0 {
+		if err = json.Unmarshal(bClaims, &row.Claims); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return row, ttl, nil
+}
+
+// expiryDue reports if the validity of an open entry ended.
+func expiryDue(row *model.VerificationEntry, now time.Time) bool {
+	if row.ExpiresAt.IsZero() || model.Status(row.State).IsFinal() {
+		return false
+	}
+
+	return !row.ExpiresAt.After(now)
+}
+
+// expireEntry marks an entry as expired after its validity ended. The record itself is removed by its ttl.
+func expireEntry(ctx context.Context, tenantId string, row *model.VerificationEntry) {
+	if !expiryDue(row, time.Now()) {
+		return
+	}
+
+	err := transitionState(ContextWithActor(ctx, Actor{Type: ActorSystem}), tenantId, row.Id, model.PresentationExpired, "", nil, "")
+
+	if err != nil {
+		if !errors.Is(err, ErrInvalidTransition) {
+			common.GetEnvironment().GetLogger().Error(err, "Error during expiry of entry.", "id", row.Id)
+		}
+		return
+	}
+
+	row.State = string(model.PresentationExpired)
+}
+
+const expiryTable = "presentations_by_expiry"
+
+// expiryBucket is the partition of the expiry index. An hour keeps the partitions small and the sweeps short.
+func expiryBucket(t time.Time) int64 {
+	return t.Unix() / int64(time.Hour.Seconds())
+}
+
+// recordTtl is the ttl of a record which expires after ttl seconds. The record is kept for the retention after
+// its expiry, so that the expired state is observable and the expiry sweep finds it.
+func recordTtl(ttl int, retention int) int {
+	if ttl > 0 {
+		ttl += retention
+	}
+	return ttl
+}
+
+// addExpiry adds the entry to the expiry index, which is read by the expiry sweep.
+func addExpiry(batch *gocql.Batch, tenantId string, id string, expires time.Time, ttl int) {
+	env := common.GetEnvironment()
+
+	queryString := fmt.Sprintf(`INSERT INTO %s.%s (region,country,bucket,expires_at,id) VALUES(?,?,?,?,?) USING TTL ?;`, tenantId, expiryTable)
+
+	batch.Query(queryString,
+		env.GetRegion(),
+		env.GetCountry(),
+		expiryBucket(expires),
+		expires,
+		id,
+		ttl)
+}
+
+// ExpiryTenants lists the tenants which have the expiry index.
+func ExpiryTenants(ctx context.Context) ([]string, error) {
+	return tenantsWithTable(ctx, expiryTable)
+}
+
+// ExpireDueEntries marks the open entries of the tenant as expired, whose validity ended between since and now.
+func ExpireDueEntries(ctx context.Context, tenantId string, since time.Time) error {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+	now := time.Now()
+
+	queryString := fmt.Sprintf(`SELECT id FROM %s.%s WHERE region=? AND country=? AND bucket=? AND expires_at<=?;`, tenantId, expiryTable)
+	entryQuery := fmt.Sprintf(`SELECT state,expires_at FROM %s.presentations WHERE region=? AND country=? AND id=?;`, tenantId)
+
+	for bucket := expiryBucket(since); bucket <= expiryBucket(now); bucket++ {
+		ids := make([]string, 0)
+		query := session.Query(queryString, env.GetRegion(), env.GetCountry(), bucket, now).WithContext(ctx).Iter()
+
+		var id string
+		for query.Scan(&id) {
+			ids = append(ids, id)
+		}
+
+		if err := query.Close(); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			row := model.VerificationEntry{Id: id}
+
+			err := session.Query(entryQuery, env.GetRegion(), env.GetCountry(), id).
+				WithContext(ctx).
+				Consistency(gocql.LocalQuorum).
+				Scan(&row.State, &row.ExpiresAt)
+
+			if errors.Is(err, gocql.ErrNotFound) {
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			expireEntry(ctx, tenantId, &row)
+		}
+	}
+
+	return nil
+}
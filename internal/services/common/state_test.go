@@ -0,0 +1,54 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+)
+
+func Test_ExpiryWithDefaultConfig(t *testing.T) {
+	var config model.Config
+
+	if err := envconfig.Process("EXPIRYTEST", &config); err != nil {
+		t.Fatal(err)
+	}
+
+	ttl := 300
+	created := time.Now()
+	row := &model.VerificationEntry{
+		State:     string(model.PresentationRequestObjectFetched),
+		ExpiresAt: created.Add(time.Duration(ttl) * time.Second),
+	}
+
+	if expiryDue(row, created) {
+		t.Error("entry must not expire before its ttl")
+	}
+
+	// the sweep runs at the latest one interval after the expiry, the record must still exist then
+	sweep := row.ExpiresAt.Add(time.Duration(config.ExpirySweepSec) * time.Second)
+	removed := created.Add(time.Duration(recordTtl(ttl, config.ExpiredRetention)) * time.Second)
+
+	if !sweep.Before(removed) {
+		t.Error("record is removed before the expiry sweep", config.ExpiredRetention, config.ExpirySweepSec)
+	}
+
+	if !expiryDue(row, sweep) {
+		t.Error("open entry must expire")
+	}
+
+	if expiryBucket(row.ExpiresAt) < expiryBucket(created) || expiryBucket(row.ExpiresAt) > expiryBucket(sweep) {
+		t.Error("expiry bucket must be in the swept range")
+	}
+
+	row.State = string(model.PresentationExpired)
+
+	if expiryDue(row, sweep) {
+		t.Error("final entry must not expire again")
+	}
+
+	if recordTtl(0, config.ExpiredRetention) != 0 {
+		t.Error("records without ttl must be kept")
+	}
+}
@@ -0,0 +1,183 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/template"
+)
+
+const templateTable = "presentation_templates"
+
+var (
+	ErrTemplateNotFound = errors.New("template not found")
+	ErrTemplateConflict = errors.New("template version was created concurrently")
+)
+
+func scanTemplates(query *gocql.Iter) ([]model.PresentationTemplate, error) {
+	var t model.PresentationTemplate
+	var definition string
+	var defaults string
+	ret := make([]model.PresentationTemplate, 0)
+
+	for query.Scan(&t.Id, &t.Version, &t.Name, &t.Description, &definition, &defaults, &t.Created) {
+		t.Definition = json.RawMessage(definition)
+		t.Defaults = nil
+
+		if defaults != "" {
+			if err := json.Unmarshal([]byte(defaults), &t.Defaults); err != nil {
+				query.Close()
+				return nil, err
+			}
+		}
+
+		t.Parameters, _ = template.Parameters(t.Definition)
+		ret = append(ret, t)
+	}
+
+	if err := query.Close(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+const templateColumns = "id,version,name,description,definition,defaults,created"
+
+// GetTemplate returns a version of a template, the latest for version 0.
+func GetTemplate(ctx context.Context, tenantId string, id string, version int) (*model.PresentationTemplate, error) {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	queryString := fmt.Sprintf(`SELECT %s FROM %s.%s WHERE region=? AND country=? AND bucket=? AND id=?`, templateColumns, tenantId, templateTable)
+	args := []interface{}{env.GetRegion(), env.GetCountry(), bucketOf(id), id}
+
+	if version > 0 {
+		queryString += " AND version=?"
+		args = append(args, version)
+	}
+
+	templates, err := scanTemplates(session.Query(queryString+" LIMIT 1;", args...).WithContext(ctx).Consistency(gocql.LocalQuorum).Iter())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("%w: %s version %d", ErrTemplateNotFound, id, version)
+	}
+
+	return &templates[0], nil
+}
+
+// GetTemplateVersions returns all versions of a template, the latest first.
+func GetTemplateVersions(ctx context.Context, tenantId string, id string) ([]model.PresentationTemplate, error) {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	queryString := fmt.Sprintf(`SELECT %s FROM %s.%s WHERE region=? AND country=? AND bucket=? AND id=?;`, templateColumns, tenantId, templateTable)
+
+	return scanTemplates(session.Query(queryString, env.GetRegion(), env.GetCountry(), bucketOf(id), id).WithContext(ctx).Consistency(gocql.LocalQuorum).Iter())
+}
+
+// ListTemplates returns the latest version of all templates of the tenant.
+func ListTemplates(ctx context.Context, tenantId string) ([]model.PresentationTemplate, error) {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	queryString := fmt.Sprintf(`SELECT %s FROM %s.%s WHERE region=? AND country=? AND bucket IN ?;`, templateColumns, tenantId, templateTable)
+
+	templates, err := scanTemplates(session.Query(queryString, env.GetRegion(), env.GetCountry(), allBuckets()).WithContext(ctx).Consistency(gocql.LocalQuorum).Iter())
+
+	if err != nil {
+		return nil, err
+	}
+
+	// versions are clustered in descending order, the first row of an id is the latest
+	ret := make([]model.PresentationTemplate, 0)
+	for _, t := range templates {
+		if len(ret) == 0 || ret[len(ret)-1].Id != t.Id {
+			ret = append(ret, t)
+		}
+	}
+
+	// the buckets are read one after another, the ids are only sorted within a bucket
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Id < ret[j].Id
+	})
+
+	return ret, nil
+}
+
+// AddTemplateVersion stores the template as next version of its id. ErrTemplateConflict is returned if the
+// version was taken by a concurrent update.
+func AddTemplateVersion(ctx context.Context, tenantId string, t *model.PresentationTemplate) error {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	latest, err := GetTemplate(ctx, tenantId, t.Id, 0)
+
+	switch {
+	case err == nil:
+		t.Version = latest.Version + 1
+	case errors.Is(err, ErrTemplateNotFound):
+		t.Version = 1
+	default:
+		return err
+	}
+
+	defaults := ""
+
+	if len(t.Defaults) > 0 {
+		b, err := json.Marshal(t.Defaults)
+
+		if err != nil {
+			return err
+		}
+
+		defaults = string(b)
+	}
+
+	t.Created = time.Now().UTC()
+
+	queryString := fmt.Sprintf(`INSERT INTO %s.%s (region,country,bucket,%s) VALUES(?,?,?,?,?,?,?,?,?,?) IF NOT EXISTS;`, tenantId, templateTable, templateColumns)
+
+	applied, err := session.Query(queryString,
+		env.GetRegion(),
+		env.GetCountry(),
+		bucketOf(t.Id),
+		t.Id,
+		t.Version,
+		t.Name,
+		t.Description,
+		string(t.Definition),
+		defaults,
+		t.Created).WithContext(ctx).SerialConsistency(gocql.LocalSerial).MapScanCAS(make(map[string]interface{}))
+
+	if err != nil {
+		return err
+	}
+
+	if !applied {
+		return fmt.Errorf("%w: %s version %d", ErrTemplateConflict, t.Id, t.Version)
+	}
+
+	return nil
+}
+
+// DeleteTemplate removes all versions of a template. Requests which were created from it keep their definition.
+func DeleteTemplate(ctx context.Context, tenantId string, id string) error {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	queryString := fmt.Sprintf(`DELETE FROM %s.%s WHERE region=? AND country=? AND bucket=? AND id=?;`, tenantId, templateTable)
+
+	return session.Query(queryString, env.GetRegion(), env.GetCountry(), bucketOf(id), id).WithContext(ctx).Exec()
+}
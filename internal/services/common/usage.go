@@ -0,0 +1,121 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gocql/gocql"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+)
+
+var ErrUsageExceeded = errors.New("usage limit exceeded")
+
+const claimRetries = 5
+
+func openStates() []string {
+	return []string{string(model.PresentationRequested), string(model.PresentationRequestObjectFetched)}
+}
+
+// ClaimRequestObjectFetch counts a fetch of the request object with a compare and set on the fetch counter.
+// ErrUsageExceeded is returned if the request object was already fetched max times.
+func ClaimRequestObjectFetch(ctx context.Context, tenantId string, id string, max int) error {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	for i := 0; i < claimRetries; i++ {
+		var count int
+
+		queryString := fmt.Sprintf(`SELECT fetch_count FROM %s.presentations WHERE region=? AND country=? AND id=?;`, tenantId)
+
+		err := session.Query(queryString,
+			env.GetRegion(),
+			env.GetCountry(),
+			id).WithContext(ctx).Consistency(gocql.LocalQuorum).Scan(&count)
+
+		if err != nil {
+			return err
+		}
+
+		if count >= max {
+			return fmt.Errorf("%w: request object of %s fetched %d times", ErrUsageExceeded, id, count)
+		}
+
+		ttl, err := getRemainingTtl(ctx, tenantId, id)
+
+		if err != nil {
+			return err
+		}
+
+		var expected interface{} = count
+		if count == 0 {
+			expected = nil
+		}
+
+		queryString = fmt.Sprintf(`UPDATE %s.presentations USING TTL ? SET fetch_count=? WHERE
+			region=? AND
+			country=? AND
+			id=? IF state IN ? AND fetch_count=?;`, tenantId)
+
+		previous := make(map[string]interface{})
+		applied, err := session.Query(queryString,
+			ttl,
+			count+1,
+			env.GetRegion(),
+			env.GetCountry(),
+			id,
+			openStates(),
+			expected).WithContext(ctx).SerialConsistency(gocql.LocalSerial).MapScanCAS(previous)
+
+		if err != nil {
+			return err
+		}
+
+		if applied {
+			return nil
+		}
+
+		if state, ok := previous["state"]; ok && !model.Status(fmt.Sprint(state)).CanTransitionTo(model.PresentationRequestObjectFetched) {
+			return fmt.Errorf("%w: %v to %s", ErrInvalidTransition, state, model.PresentationRequestObjectFetched)
+		}
+	}
+
+	return fmt.Errorf("%w: concurrent fetches of %s", ErrUsageExceeded, id)
+}
+
+// ClaimSubmission marks the response endpoint of the record as used. Only the first caller succeeds,
+// every further submission gets ErrUsageExceeded.
+func ClaimSubmission(ctx context.Context, tenantId string, id string) error {
+	env := common.GetEnvironment()
+	session := env.GetSession()
+
+	ttl, err := getRemainingTtl(ctx, tenantId, id)
+
+	if err != nil {
+		return err
+	}
+
+	queryString := fmt.Sprintf(`UPDATE %s.presentations USING TTL ? SET submitted=true WHERE
+		region=? AND
+		country=? AND
+		id=? IF state IN ? AND submitted=null;`, tenantId)
+
+	previous := make(map[string]interface{})
+	applied, err := session.Query(queryString,
+		ttl,
+		env.GetRegion(),
+		env.GetCountry(),
+		id,
+		openStates()).WithContext(ctx).SerialConsistency(gocql.LocalSerial).MapScanCAS(previous)
+
+	if err != nil {
+		return err
+	}
+
+	if !applied {
+		return fmt.Errorf("%w: response endpoint of %s already used", ErrUsageExceeded, id)
+	}
+
+	return nil
+}
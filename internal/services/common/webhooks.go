@@ -0,0 +1,206 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+)
+
+const webhookTable = "webhook_deliveries"
+
+var ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+
+func webhookColumn(deliveryId string) string {
+	return "webhook." + deliveryId
+}
+
+// webhookTtl keeps the log entry for the log ttl after its creation.
+func webhookTtl(created time.Time) int {
+	ttl := common.GetEnvironment().GetConfig().Webhooks.LogTtlSec - int(time.Since(created).Seconds())
+
+	if ttl < 1 {
+		return 1
+	}
+	return ttl
+}
+
+// AddWebhookDelivery logs a new pending delivery. It is leased until now plus lease, so that the caller can try
+// the first attempt without concurrent workers.
+func AddWebhookDelivery(ctx context.Context, tenantId string, d *model.WebhookDelivery, lease time.Duration) error {
+	env := common.GetEnvironment()
+
+	deliveryId := gocql.TimeUUID()
+	d.Id = deliveryId.String()
+	d.Created = deliveryId.Time()
+	d.Status = model.WebhookPending
+	d.NextAttempt = time.Now().Add(lease)
+
+	encPayload, err := encodeColumn(ctx, tenantId, d.PresentationId, webhookColumn(d.Id), d.Payload)
+
+	if err != nil {
+		return err
+	}
+
+	queryString := fmt.Sprintf(`INSERT INTO %s.%s (region,country,bucket,id,delivery_id,event_type,url,payload,status,attempts,next_attempt,last_error,last_status_code,replay_of) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?) USING TTL ?;`, tenantId, webhookTable)
+
+	return env.GetSession().Query(queryString,
+		env.GetRegion(),
+		env.GetCountry(),
+		bucketOf(d.PresentationId),
+		d.PresentationId,
+		deliveryId,
+		d.EventType,
+		d.Url,
+		encPayload,
+		string(d.Status),
+		0,
+		d.NextAttempt,
+		"",
+		0,
+		d.ReplayOf,
+		webhookTtl(d.Created)).WithContext(ctx).Exec()
+}
+
+// GetWebhookDeliveries reads the delivery log of a presentation.
+func GetWebhookDeliveries(ctx context.Context, tenantId string, id string) ([]model.WebhookDelivery, error) {
+	return queryWebhookDeliveries(ctx, tenantId, bucketOf(id), id)
+}
+
+// GetWebhookBucket reads the delivery log of all presentations of the tenant in the partition bucket.
+func GetWebhookBucket(ctx context.Context, tenantId string, bucket int) ([]model.WebhookDelivery, error) {
+	return queryWebhookDeliveries(ctx, tenantId, bucket, "")
+}
+
+func queryWebhookDeliveries(ctx context.Context, tenantId string, bucket int, id string) ([]model.WebhookDelivery, error) {
+	env := common.GetEnvironment()
+
+	queryString := fmt.Sprintf(`SELECT id,delivery_id,event_type,url,payload,status,attempts,next_attempt,last_error,last_status_code,delivered_at,replay_of FROM %s.%s WHERE region=? AND country=? AND bucket=?`, tenantId, webhookTable)
+	args := []interface{}{env.GetRegion(), env.GetCountry(), bucket}
+
+	if id != "" {
+		queryString += ` AND id=?`
+		args = append(args, id)
+	}
+
+	query := env.GetSession().Query(queryString+";", args...).WithContext(ctx).Consistency(gocql.LocalQuorum).Iter()
+
+	ret := make([]model.WebhookDelivery, 0)
+	var d model.WebhookDelivery
+	var deliveryId gocql.UUID
+	var status string
+	var payload string
+
+	for query.Scan(&d.PresentationId, &deliveryId, &d.EventType, &d.Url, &payload, &status, &d.Attempts, &d.NextAttempt, &d.LastError, &d.LastStatusCode, &d.DeliveredAt, &d.ReplayOf) {
+		d.Id = deliveryId.String()
+		d.Created = deliveryId.Time()
+		d.Status = model.WebhookStatus(status)
+
+		b, _, err := decodeColumn(ctx, tenantId, d.PresentationId, webhookColumn(d.Id), payload)
+
+		if err != nil {
+			query.Close()
+			return nil, err
+		}
+
+		d.Payload = b
+		ret = append(ret, d)
+	}
+
+	if err := query.Close(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func GetWebhookDelivery(ctx context.Context, tenantId string, id string, deliveryId string) (*model.WebhookDelivery, error) {
+	deliveries, err := GetWebhookDeliveries(ctx, tenantId, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range deliveries {
+		if deliveries[i].Id == deliveryId {
+			return &deliveries[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrWebhookDeliveryNotFound, deliveryId)
+}
+
+// ClaimWebhookDelivery leases the delivery with a compare and set on its next attempt. False is returned if
+// another worker claimed it first.
+func ClaimWebhookDelivery(ctx context.Context, tenantId string, d *model.WebhookDelivery, lease time.Duration) (bool, error) {
+	env := common.GetEnvironment()
+
+	deliveryId, err := gocql.ParseUUID(d.Id)
+
+	if err != nil {
+		return false, err
+	}
+
+	queryString := fmt.Sprintf(`UPDATE %s.%s USING TTL ? SET next_attempt=? WHERE region=? AND country=? AND bucket=? AND id=? AND delivery_id=? IF next_attempt=?;`, tenantId, webhookTable)
+
+	until := time.Now().Add(lease)
+	previous := make(map[string]interface{})
+
+	applied, err := env.GetSession().Query(queryString,
+		webhookTtl(d.Created),
+		until,
+		env.GetRegion(),
+		env.GetCountry(),
+		bucketOf(d.PresentationId),
+		d.PresentationId,
+		deliveryId,
+		d.NextAttempt).WithContext(ctx).SerialConsistency(gocql.LocalSerial).MapScanCAS(previous)
+
+	if err != nil || !applied {
+		return false, err
+	}
+
+	d.NextAttempt = until
+	return true, nil
+}
+
+// UpdateWebhookDelivery records the result of an attempt.
+func UpdateWebhookDelivery(ctx context.Context, tenantId string, d *model.WebhookDelivery) error {
+	env := common.GetEnvironment()
+
+	deliveryId, err := gocql.ParseUUID(d.Id)
+
+	if err != nil {
+		return err
+	}
+
+	queryString := fmt.Sprintf(`UPDATE %s.%s USING TTL ? SET status=?,attempts=?,next_attempt=?,last_error=?,last_status_code=?,delivered_at=? WHERE region=? AND country=? AND bucket=? AND id=? AND delivery_id=?;`, tenantId, webhookTable)
+
+	var deliveredAt interface{}
+	if !d.DeliveredAt.IsZero() {
+		deliveredAt = d.DeliveredAt
+	}
+
+	return env.GetSession().Query(queryString,
+		webhookTtl(d.Created),
+		string(d.Status),
+		d.Attempts,
+		d.NextAttempt,
+		d.LastError,
+		d.LastStatusCode,
+		deliveredAt,
+		env.GetRegion(),
+		env.GetCountry(),
+		bucketOf(d.PresentationId),
+		d.PresentationId,
+		deliveryId).WithContext(ctx).Exec()
+}
+
+// WebhookTenants returns the tenant keyspaces which have a webhook delivery log.
+func WebhookTenants(ctx context.Context) ([]string, error) {
+	return tenantsWithTable(ctx, webhookTable)
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/policy"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/pkg/messaging"
+)
+
+var ErrApprovalRejected = errors.New("disclosure rejected by holder")
+
+// ConsentApprover asks the holder to approve a disclosure. It returns the approval and the reason of a rejection.
+type ConsentApprover func(ctx context.Context, request messaging.ConsentApprovalRequest) (bool, string, error)
+
+var consentApprover ConsentApprover
+
+// SetConsentApprover registers the channel for approvals. Without approver, disclosures requiring an approval are denied.
+func SetConsentApprover(approver ConsentApprover) {
+	consentApprover = approver
+}
+
+// disclosure describes what a verifier requests from the holder.
+type disclosure struct {
+	ClientId    string
+	ResponseUri string
+	Purposes    []string
+	Fields      []string
+}
+
+func requestedDisclosure(row *model.VerificationEntry) disclosure {
+	d := disclosure{
+		ClientId:    row.ClientId,
+		ResponseUri: row.ResponseUri,
+		Purposes:    make([]string, 0),
+		Fields:      make([]string, 0),
+	}
+
+	definition := row.PresentationDefinition
+
+	addUnique := func(list []string, values ...string) []string {
+		for _, v := range values {
+			if v == "" {
+				continue
+			}
+			found := false
+			for _, e := range list {
+				if e == v {
+					found = true
+					break
+				}
+			}
+			if !found {
+				list = append(list, v)
+			}
+		}
+		return list
+	}
+
+	d.Purposes = addUnique(d.Purposes, definition.Purpose)
+
+	for _, requirement := range definition.SubmissionRequirements {
+		d.Purposes = addUnique(d.Purposes, requirement.Purpose)
+	}
+
+	for _, descriptor := range definition.InputDescriptors {
+		d.Purposes = addUnique(d.Purposes, descriptor.Purpose)
+
+		for _, field := range descriptor.Constraints.Fields {
+			d.Purposes = addUnique(d.Purposes, field.Purpose)
+			d.Fields = addUnique(d.Fields, field.Path...)
+			d.Fields = addUnique(d.Fields, field.Name)
+		}
+	}
+
+	return d
+}
+
+func matchRule(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if pattern == value || (strings.HasSuffix(pattern, "*") && strings.HasPrefix(value, strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateConsentRules applies the configured rules of the tenant. Denials win over approvals.
+func evaluateConsentRules(rules model.ConsentRules, d disclosure) *policy.Decision {
+	decision := &policy.Decision{Allow: true, RequireApproval: rules.RequireApproval}
+
+	if matchRule(rules.DeniedClients, d.ClientId) {
+		decision.Allow = false
+		decision.Reasons = append(decision.Reasons, fmt.Sprintf("client %s is denied", d.ClientId))
+	}
+
+	if len(rules.AllowedClients) > 0 && !matchRule(rules.AllowedClients, d.ClientId) {
+		decision.Allow = false
+		decision.Reasons = append(decision.Reasons, fmt.Sprintf("client %s is not allowed", d.ClientId))
+	}
+
+	for _, field := range d.Fields {
+		if matchRule(rules.DeniedFields, field) {
+			decision.Allow = false
+			decision.Reasons = append(decision.Reasons, fmt.Sprintf("field %s is denied", field))
+		} else if matchRule(rules.ApprovalFields, field) {
+			decision.RequireApproval = true
+			decision.Reasons = append(decision.Reasons, fmt.Sprintf("field %s requires approval", field))
+		}
+	}
+
+	return decision
+}
+
+// CheckDisclosureConsent decides before the transmission whether the verifier may receive the requested
+// fields. The tenant rules are checked first, then the disclosure consent policy. If one of them requires
+// an approval, the holder is asked over the approver and the disclosure waits for the answer.
+func CheckDisclosureConsent(ctx context.Context, config *model.Config, tenantId string, row *model.VerificationEntry, body model.ProofModel) error {
+	d := requestedDisclosure(row)
+	decision := evaluateConsentRules(config.Consent.Tenants[tenantId], d)
+
+	if err := decision.Err(); err != nil {
+		return err
+	}
+
+	policyDecision, err := EvaluatePolicy(ctx, policy.DisclosureConsent, map[string]interface{}{
+		"tenantId":               tenantId,
+		"presentationId":         row.Id,
+		"clientId":               d.ClientId,
+		"responseUri":            d.ResponseUri,
+		"purposes":               d.Purposes,
+		"fields":                 d.Fields,
+		"presentationDefinition": row.PresentationDefinition,
+		"payload":                body.Payload,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := policyDecision.Err(); err != nil {
+		return err
+	}
+
+	if !decision.RequireApproval && !policyDecision.RequireApproval {
+		return nil
+	}
+
+	if consentApprover == nil {
+		return fmt.Errorf("%w: approval required, but no approval topic configured", policy.ErrDenied)
+	}
+
+	request := messaging.ConsentApprovalRequest{
+		PresentationId: row.Id,
+		ClientId:       d.ClientId,
+		ResponseUri:    d.ResponseUri,
+		Purposes:       d.Purposes,
+		Fields:         d.Fields,
+		Reasons:        append(decision.Reasons, policyDecision.Reasons...),
+	}
+	request.TenantId = tenantId
+	request.RequestId = row.RequestId
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.Consent.ApprovalTimeoutSec)*time.Second)
+	defer cancel()
+
+	approved, reason, err := consentApprover(ctx, request)
+
+	if err != nil {
+		return fmt.Errorf("approval failed: %w", err)
+	}
+
+	if !approved {
+		return fmt.Errorf("%w: %s", ErrApprovalRejected, reason)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gitlab.eclipse.org/eclipse/xfsc/libraries/microservice/core/pkg/logr"
+	"gitlab.eclipse.org/eclipse/xfsc/libraries/ssi/oid4vip/model/presentation"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/policy"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/pkg/messaging"
+)
+
+func TestDisclosureConsent(t *testing.T) {
+	logger, _ := logr.New("info", true, nil)
+	common.GetEnvironment().SetLogger(*logger)
+	config := &model.Config{}
+	config.Consent.ApprovalTimeoutSec = 1
+	config.Consent.Tenants = map[string]model.ConsentRules{
+		"t1": {
+			AllowedClients: []string{"https://verifier.example.com/*"},
+			DeniedFields:   []string{"$.credentialSubject.iban"},
+			ApprovalFields: []string{"$.credentialSubject.birth*"},
+		},
+	}
+	common.GetEnvironment().SetConfig(config)
+	defer SetConsentApprover(nil)
+
+	row := func(clientId string, paths ...string) *model.VerificationEntry {
+		entry := &model.VerificationEntry{ClientId: clientId}
+		entry.PresentationDefinition.Purpose = "age check"
+		entry.PresentationDefinition.InputDescriptors = []presentation.InputDescriptor{{
+			Constraints: presentation.Constraints{Fields: []presentation.Field{{Path: paths}}},
+		}}
+		return entry
+	}
+
+	check := func(entry *model.VerificationEntry) error {
+		return CheckDisclosureConsent(context.Background(), config, "t1", entry, model.ProofModel{})
+	}
+
+	if err := check(row("https://verifier.example.com/client", "$.credentialSubject.name")); err != nil {
+		t.Error(err)
+	}
+
+	if err := check(row("https://other.example.com", "$.credentialSubject.name")); !errors.Is(err, policy.ErrDenied) {
+		t.Error("unknown client must be denied", err)
+	}
+
+	if err := check(row("https://verifier.example.com/client", "$.credentialSubject.iban")); !errors.Is(err, policy.ErrDenied) {
+		t.Error("denied field must be denied", err)
+	}
+
+	if err := check(row("https://verifier.example.com/client", "$.credentialSubject.birthDate")); !errors.Is(err, policy.ErrDenied) {
+		t.Error("approval without approver must be denied", err)
+	}
+
+	var asked messaging.ConsentApprovalRequest
+	SetConsentApprover(func(ctx context.Context, request messaging.ConsentApprovalRequest) (bool, string, error) {
+		asked = request
+		return request.ClientId == "https://verifier.example.com/client", "unknown verifier", nil
+	})
+
+	if err := check(row("https://verifier.example.com/client", "$.credentialSubject.birthDate")); err != nil {
+		t.Error(err)
+	}
+
+	if asked.TenantId != "t1" || len(asked.Purposes) != 1 || asked.Purposes[0] != "age check" || asked.Fields[0] != "$.credentialSubject.birthDate" {
+		t.Error("approval request incomplete", asked)
+	}
+
+	config.Consent.Tenants["t1"] = model.ConsentRules{RequireApproval: true}
+
+	if err := check(row("https://other.example.com", "$.credentialSubject.name")); !errors.Is(err, ErrApprovalRejected) {
+		t.Error("rejected approval must deny", err)
+	}
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	commonTypes "github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/httpclient"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/services/common"
+)
+
+// ErrDeliveryRejected marks responses of the verifier which are not retried.
+var ErrDeliveryRejected = errors.New("response uri rejected the presentation")
+
+var deadLetterListener func(tenantId string, row *model.VerificationEntry, delivery model.Delivery)
+
+// SetDeadLetterListener registers a function which is called for each presentation whose delivery was given up.
+func SetDeadLetterListener(listener func(tenantId string, row *model.VerificationEntry, delivery model.Delivery)) {
+	deadLetterListener = listener
+}
+
+// deliveryBackoff doubles the delay with each attempt up to max. Half of the delay is random, so that
+// retries of many presentations do not hit a recovering verifier at the same time.
+func deliveryBackoff(attempt int, initial time.Duration, max time.Duration) time.Duration {
+	delay := max
+
+	if attempt < 32 {
+		if d := initial << attempt; d > 0 && d < max {
+			delay = d
+		}
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func isPermanent(err error) bool {
+	return errors.Is(err, ErrDeliveryRejected) || errors.Is(err, httpclient.ErrEgressDenied)
+}
+
+// deliver posts the claimed outbox items of a presentation. Failed items are rescheduled, or the delivery is
+// dead lettered if the failure is permanent or the deadline is reached. The presentation is transmitted
+// when no item is left.
+func deliver(ctx context.Context, config *model.Config, tenantId string, row *model.VerificationEntry, items []common.OutboxItem) (model.Delivery, error) {
+	logger := commonTypes.GetEnvironment().GetLogger()
+	delivery := model.Delivery{Status: model.DeliveryPending}
+	var lastErr error
+
+	for i := range items {
+		item := &items[i]
+		delivery.Deadline = item.Deadline
+
+		err := postResponse(httpclient.WithTenant(ctx, tenantId), item.ResponseUri, item.Form, logger)
+		item.Attempts++
+
+		if item.Attempts > delivery.Attempts {
+			delivery.Attempts = item.Attempts
+		}
+
+		if err == nil {
+			if err = common.CompleteOutboxItem(ctx, item); err != nil {
+				return delivery, err
+			}
+			continue
+		}
+
+		lastErr = err
+		delivery.LastError = err.Error()
+
+		if isPermanent(err) || !time.Now().Before(item.Deadline) {
+			if dlErr := common.DeadLetterOutbox(ctx, tenantId, row, delivery); dlErr != nil {
+				return delivery, errors.Join(err, dlErr)
+			}
+
+			delivery.Status = model.DeliveryDeadLettered
+			logger.Error(err, "delivery dead-lettered", "id", row.Id, "responseUri", item.ResponseUri, "attempts", item.Attempts)
+
+			if deadLetterListener != nil {
+				deadLetterListener(tenantId, row, delivery)
+			}
+			return delivery, err
+		}
+
+		next := time.Now().Add(deliveryBackoff(item.Attempts-1, time.Duration(config.Delivery.InitialBackoffSec)*time.Second, time.Duration(config.Delivery.MaxBackoffSec)*time.Second))
+
+		if next.After(item.Deadline) {
+			next = item.Deadline
+		}
+
+		if err = common.RescheduleOutboxItem(ctx, item, next, delivery.LastError); err != nil {
+			return delivery, errors.Join(lastErr, err)
+		}
+
+		logger.Info("delivery rescheduled", "id", row.Id, "attempts", item.Attempts, "next", next)
+	}
+
+	if lastErr != nil {
+		return delivery, nil
+	}
+
+	remaining, err := common.GetOutboxItems(ctx, tenantId, row.Id)
+
+	if err != nil || len(remaining) > 0 {
+		return delivery, err
+	}
+
+	err = common.CompleteDelivery(ctx, tenantId, row.Id, delivery.Attempts)
+
+	if err != nil {
+		return delivery, err
+	}
+
+	delivery.Status = model.DeliveryDelivered
+	delivery.LastError = ""
+	return delivery, nil
+}
+
+// RunDeliveryWorker retries the due outbox items of all tenants until the context ends. Items are claimed
+// with a lease, so that several instances can run the worker.
+func RunDeliveryWorker(ctx context.Context, config *model.Config) {
+	ticker := time.NewTicker(time.Duration(config.Delivery.PollIntervalSec) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			processOutbox(common.ContextWithActor(ctx, common.Actor{Type: common.ActorSystem}), config)
+		}
+	}
+}
+
+func processOutbox(ctx context.Context, config *model.Config) {
+	logger := commonTypes.GetEnvironment().GetLogger()
+	lease := time.Duration(config.Delivery.LeaseSec) * time.Second
+
+	tenants, err := common.OutboxTenants(ctx)
+
+	if err != nil {
+		logger.Error(err, "Error during outbox tenant read.")
+		return
+	}
+
+	for _, tenantId := range tenants {
+		for bucket := 0; bucket < common.PartitionBuckets; bucket++ {
+			processOutboxBucket(ctx, config, tenantId, bucket, lease)
+		}
+	}
+}
+
+func processOutboxBucket(ctx context.Context, config *model.Config, tenantId string, bucket int, lease time.Duration) {
+	logger := commonTypes.GetEnvironment().GetLogger()
+
+	items, err := common.GetOutboxBucket(ctx, tenantId, bucket)
+
+	if err != nil {
+		logger.Error(err, "Error during outbox read.", "tenantId", tenantId, "bucket", bucket)
+		return
+	}
+
+	due := make(map[string][]common.OutboxItem)
+
+	for _, item := range items {
+		if item.NextAttempt.After(time.Now()) {
+			continue
+		}
+
+		claimed, err := common.ClaimOutboxItem(ctx, &item, lease)
+
+		if err != nil {
+			logger.Error(err, "Error during outbox claim.", "id", item.Id)
+			continue
+		}
+
+		if claimed {
+			due[item.Id] = append(due[item.Id], item)
+		}
+	}
+
+	for id, claimed := range due {
+		row, err := common.GetEntryFromDb(ctx, tenantId, id)
+
+		if err != nil {
+			logger.Error(err, "Error during outbox entry read.", "id", id)
+			continue
+		}
+
+		// cancelled and expired presentations are not sent anymore
+		if model.Status(row.State).IsFinal() {
+			err = common.DeadLetterOutbox(ctx, tenantId, row, model.Delivery{Attempts: claimed[0].Attempts, LastError: "presentation is " + row.State, Deadline: claimed[0].Deadline})
+
+			if err != nil {
+				logger.Error(err, "Error during dead lettering.", "id", id)
+			}
+			continue
+		}
+
+		if _, err = deliver(ctx, config, tenantId, row, claimed); err != nil {
+			logger.Error(err, "Error during delivery.", "id", id)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gitlab.eclipse.org/eclipse/xfsc/libraries/microservice/core/pkg/logr"
+)
+
+func TestDeliveryBackoff(t *testing.T) {
+	for attempt, max := range []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		delay := deliveryBackoff(attempt, 2*time.Second, 10*time.Second)
+
+		if delay < max/2 || delay > max {
+			t.Error(attempt, delay)
+		}
+	}
+
+	if delay := deliveryBackoff(100, time.Second, time.Minute); delay < 30*time.Second || delay > time.Minute {
+		t.Error("overflow must be capped", delay)
+	}
+}
+
+func TestPostResponseErrors(t *testing.T) {
+	logger, _ := logr.New("info", true, nil)
+
+	var status int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("vp_token") != "token" {
+			t.Error("form not posted")
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	for code, permanent := range map[int]bool{
+		http.StatusBadRequest:          true,
+		http.StatusNotFound:            true,
+		http.StatusTooManyRequests:     false,
+		http.StatusRequestTimeout:      false,
+		http.StatusServiceUnavailable:  false,
+		http.StatusInternalServerError: false,
+	} {
+		status = code
+		err := postResponse(context.Background(), server.URL, "vp_token=token", *logger)
+
+		if err == nil || isPermanent(err) != permanent {
+			t.Error(code, err)
+		}
+	}
+
+	status = http.StatusOK
+
+	if err := postResponse(context.Background(), server.URL, "vp_token=token", *logger); err != nil {
+		t.Error(err)
+	}
+}
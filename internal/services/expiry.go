@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	commonTypes "github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/services/common"
+)
+
+// RunExpiryWorker marks records as expired when their validity ends, so that the expired state and its events
+// do not depend on a read of the record. Concurrent workers are safe, the transition is a compare and set.
+func RunExpiryWorker(ctx context.Context, config *model.Config) {
+	ticker := time.NewTicker(time.Duration(config.ExpirySweepSec) * time.Second)
+	defer ticker.Stop()
+
+	// records which expired before the retention are already removed by their ttl
+	start := time.Now().Add(-time.Duration(config.ExpiredRetention) * time.Second)
+	swept := make(map[string]time.Time)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sweepExpired(common.ContextWithActor(ctx, common.Actor{Type: common.ActorSystem}), start, swept)
+		}
+	}
+}
+
+// sweepExpired expires the due records of all tenants since their last successful sweep.
+func sweepExpired(ctx context.Context, start time.Time, swept map[string]time.Time) {
+	logger := commonTypes.GetEnvironment().GetLogger()
+
+	tenants, err := common.ExpiryTenants(ctx)
+
+	if err != nil {
+		logger.Error(err, "Error during expiry tenant read.")
+		return
+	}
+
+	for _, tenantId := range tenants {
+		since, ok := swept[tenantId]
+
+		if !ok {
+			since = start
+		}
+
+		now := time.Now()
+
+		if err := common.ExpireDueEntries(ctx, tenantId, since); err != nil {
+			logger.Error(err, "Error during expiry sweep.", "tenantId", tenantId)
+			continue
+		}
+
+		swept[tenantId] = now
+	}
+}
@@ -2,7 +2,6 @@ package services
 
 import (
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,9 +10,10 @@ import (
 	"net/url"
 	"strings"
 
-	"gitlab.eclipse.org/eclipse/xfsc/libraries/crypto/jwt"
 	"gitlab.eclipse.org/eclipse/xfsc/libraries/ssi/oid4vip/model/presentation"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/httpclient"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/signer"
 )
 
 const HeaderContextKey = "headers"
@@ -25,10 +25,7 @@ func getRequestObject(request_uri string, ctx context.Context) (*presentation.Re
 		return nil, errors.Join(fmt.Errorf("failed to parse uri %s", request_uri), err)
 	}
 
-	/*if url.Scheme != "https" {
-		return nil, errors.New("Unsupported HTTP Scheme for presentation definition.")
-	}*/
-
+	// scheme, host and address of the request uri are checked by the egress policy of the client
 	presRequest, err := sendRequestWithRedirects(requestUrl, ctx)
 	if err != nil {
 		logger.Error(err, "error getting request object for url "+requestUrl.String())
@@ -55,44 +52,117 @@ func parsePercentEncodedUrl(request_uri string, setHttpSchema bool) (*url.URL, e
 	return requestUrl, err
 }
 
+// sendRequestWithRedirects fetches the request object and follows up to maxRedirects redirects. Redirects
+// must keep the scheme, and the headers of the caller are only forwarded to the origin of the request uri.
 func sendRequestWithRedirects(url *url.URL, ctx context.Context) (*presentation.RequestObject, error) {
-	client := GetHttpClient()
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
-	if err != nil {
-		return nil, errors.Join(errors.New("could not create request"), err)
+	logger := common.GetEnvironment().GetLogger()
+	maxRedirects := common.GetEnvironment().GetConfig().ExternalPresentation.MaxRedirects
+
+	// redirects are followed here instead of by the client, to apply the rules for each hop
+	client := *GetHttpClient(httpclient.RequestObject)
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
 	}
 
-	req.Header = ctx.Value(HeaderContextKey).(http.Header)
-	resp, err := client.Do(req)
+	headers := ctx.Value(HeaderContextKey).(http.Header)
+	hops := []string{url.String()}
+	current := url
 
-	if err != nil {
-		return nil, errors.Join(errors.New("could not send request"), err)
-	} else if resp.StatusCode >= http.StatusBadRequest {
-		var errBody = "<null>"
-		if body, er := io.ReadAll(resp.Body); er == nil && len(body) > 0 {
-			errBody = string(body)
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, current.String(), nil)
+		if err != nil {
+			return nil, errors.Join(errors.New("could not create request"), err)
 		}
-		err = fmt.Errorf("request url %s returned status %s with data %s", url.String(), resp.Status, errBody)
-		return nil, err
-	} else if resp.StatusCode < http.StatusMultipleChoices {
-		return handleSuccessfulResponse(resp)
-	} else {
-		return nil, fmt.Errorf("cannot support more than %v embedded redirects", 10)
+
+		if sameOrigin(url, current) {
+			req.Header = headers.Clone()
+		} else {
+			req.Header = crossOriginHeaders(headers)
+		}
+
+		resp, err := client.Do(req)
+
+		if err != nil {
+			return nil, errors.Join(errors.New("could not send request"), err)
+		} else if resp.StatusCode >= http.StatusBadRequest {
+			defer resp.Body.Close()
+			var errBody = "<null>"
+			if body, er := io.ReadAll(resp.Body); er == nil && len(body) > 0 {
+				errBody = string(body)
+			}
+			err = fmt.Errorf("request url %s returned status %s with data %s", current.String(), resp.Status, errBody)
+			return nil, err
+		} else if resp.StatusCode < http.StatusMultipleChoices {
+			if len(hops) > 1 {
+				logger.Info("request object fetched after redirects", "hops", strings.Join(hops, " -> "))
+			}
+			return handleSuccessfulResponse(ctx, resp)
+		}
+
+		resp.Body.Close()
+		location, err := resp.Location()
+
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("request url %s returned status %s without location", current.String(), resp.Status), err)
+		}
+
+		if len(hops) > maxRedirects {
+			return nil, fmt.Errorf("cannot support more than %v embedded redirects: %s", maxRedirects, strings.Join(hops, " -> "))
+		}
+
+		if location.Scheme != current.Scheme {
+			return nil, fmt.Errorf("redirect from %s to %s changes the scheme", current.String(), location.String())
+		}
+
+		hops = append(hops, location.String())
+		logger.Debug("following redirect", "from", current.String(), "to", location.String(), "status", resp.StatusCode)
+		current = location
 	}
 }
 
-func GetHttpClient() *http.Client {
-	// fixme this is a workaround for the self signed certificate
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+func sameOrigin(a *url.URL, b *url.URL) bool {
+	return a.Scheme == b.Scheme && strings.EqualFold(a.Host, b.Host)
+}
+
+// crossOriginHeaders keeps only the content negotiation headers. Tenant, key and authorization
+// headers must not leak to other origins.
+func crossOriginHeaders(headers http.Header) http.Header {
+	res := http.Header{}
+	for _, name := range []string{"Accept", "Accept-Language", "User-Agent"} {
+		if v := headers.Values(name); len(v) > 0 {
+			res[name] = v
+		}
+	}
+	return res
+}
+
+// GetHttpClient returns the outbound client for the destination, configured by httpClient.
+func GetHttpClient(destination httpclient.Destination) *http.Client {
+	factory := common.GetEnvironment().GetHttpClients()
+
+	if factory != nil {
+		if client, err := factory.Client(destination); err == nil {
+			return client
+		}
 	}
 
-	// Use the Transport in the client
-	client := &http.Client{Transport: transport}
-	return client
+	return http.DefaultClient
 }
 
-func handleSuccessfulResponse(resp *http.Response) (*presentation.RequestObject, error) {
+// GetSigner returns the configured signer, by default the http endpoints of the signer service.
+func GetSigner() signer.Signer {
+	env := common.GetEnvironment()
+
+	if s := env.GetSigner(); s != nil {
+		return s
+	}
+
+	config := env.GetConfig()
+	return signer.NewHttpSigner(config.SignerService.PresentationSignUrl, config.SignerService.PresentationVerifyUrl, GetHttpClient(httpclient.Signer))
+}
+
+// handleSuccessfulResponse verifies the request object against the key of its client_id.
+func handleSuccessfulResponse(ctx context.Context, resp *http.Response) (*presentation.RequestObject, error) {
 	var object = presentation.RequestObject{}
 	if cT := resp.Header.Get("Content-Type"); cT != "application/jwt" {
 		return nil, fmt.Errorf("unsupported response Content-Type `%s`, expected `application/jwt`", cT)
@@ -106,22 +176,19 @@ func handleSuccessfulResponse(resp *http.Response) (*presentation.RequestObject,
 
 	tokenString := strings.Replace(string(body), "\"", "", -1)
 
-	//Potentially here should be checked what client_id_scheme is used. Assumption here: DID is used, DID is in the kid referenced.
-	//In the future here must be check if something else than DID is used by opening the token before signature check, but spec is still too unstable for big evals
-
-	token, err := jwt.Parse(tokenString)
+	verifier := common.GetEnvironment().GetRequestObjectVerifier()
 
-	if err != nil {
-		return nil, errors.Join(fmt.Errorf("error verifying token %s", tokenString), err)
+	if verifier == nil {
+		return nil, errors.New("request object verification is not configured")
 	}
 
-	jsonTok, err := json.Marshal(token)
+	claims, err := verifier.Verify(ctx, tokenString)
 
 	if err != nil {
-		return nil, errors.Join(errors.New("error marshalling token json"), err)
+		return nil, err
 	}
 
-	err = json.Unmarshal(jsonTok, &object)
+	err = json.Unmarshal(claims, &object)
 
 	if err != nil {
 		return nil, errors.Join(errors.New("error unmarshalling token into presentation request"), err)
@@ -1,8 +1,17 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+
+	logr "gitlab.eclipse.org/eclipse/xfsc/libraries/microservice/core/pkg/logr"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
 )
 
 func TestParsePercentEncodedUrl(t *testing.T) {
@@ -20,3 +29,52 @@ func TestParsePercentEncodedUrl(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestRedirects(t *testing.T) {
+	logger, _ := logr.New("info", true, nil)
+	common.GetEnvironment().SetLogger(*logger)
+	common.GetEnvironment().SetConfig(&model.Config{})
+	common.GetEnvironment().GetConfig().ExternalPresentation.MaxRedirects = 2
+
+	var forwarded []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = append(forwarded, r.Header.Get("X-NAMESPACE"))
+		w.WriteHeader(404)
+	}))
+	defer other.Close()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = append(forwarded, r.Header.Get("X-NAMESPACE"))
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, other.URL+"/c", http.StatusTemporaryRedirect)
+		default:
+			http.Redirect(w, r, "/a", http.StatusFound)
+		}
+	}))
+	defer origin.Close()
+
+	headers := http.Header{}
+	headers.Set("X-NAMESPACE", "tenant")
+	ctx := context.WithValue(context.Background(), HeaderContextKey, headers)
+
+	u, _ := url.Parse(origin.URL + "/a")
+	_, err := sendRequestWithRedirects(u, ctx)
+
+	if err == nil || !strings.Contains(err.Error(), other.URL+"/c") {
+		t.Error(err)
+	}
+
+	if strings.Join(forwarded, ",") != "tenant,tenant," {
+		t.Error("headers must not be forwarded cross origin", forwarded)
+	}
+
+	u, _ = url.Parse(origin.URL + "/loop")
+	_, err = sendRequestWithRedirects(u, ctx)
+
+	if err == nil || !strings.Contains(err.Error(), "redirects") {
+		t.Error(err)
+	}
+}
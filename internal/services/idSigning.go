@@ -1,95 +1,145 @@
 package services
 
 import (
-	"crypto/ecdsa"
-	"crypto/rand"
-	"crypto/sha256"
-	"crypto/x509"
-	"encoding/asn1"
-	"encoding/pem"
+	"encoding/base64"
 	"errors"
 	"fmt"
-	"math/big"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/segmentio/asm/base64"
+	"github.com/google/uuid"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/keyring"
 )
 
-func decodeKey(key string) (*ecdsa.PrivateKey, error) {
-	var b []byte
-	var err error
-	if !strings.Contains(key, "BEGIN") {
-		b, err = base64.StdEncoding.DecodeString(key)
+type IdPurpose string
+
+const (
+	PurposeRequestObject IdPurpose = "request"
+	PurposeResponse      IdPurpose = "response"
+	PurposeInternal      IdPurpose = "internal"
+	// PurposeRequestId tokens carry the request id instead of the presentation id, for the routes which look
+	// up records by request id. The id is base64 url encoded in the token, because request ids can contain dots.
+	PurposeRequestId IdPurpose = "requestid"
+)
+
+var ErrInvalidIdToken = errors.New("invalid id token")
+
+// IdToken binds a presentation id to its tenant, the route it is used for and an expiry.
+// Encoded it looks like "<id>.<purpose>.<expiry>.<key id>.<signature>".
+type IdToken struct {
+	TenantId  string
+	Id        string
+	Purpose   IdPurpose
+	ExpiresAt time.Time
+}
+
+func NewPresentationId() string {
+	return uuid.NewString()
+}
+
+// IssueIdToken signs a token for the presentation id with the active key of the keyring. Records without
+// expiry get a token which is valid for the configured idTokenTtl.
+func IssueIdToken(tenantId string, id string, purpose IdPurpose, expiresAt time.Time) (string, error) {
+	config := common.GetEnvironment().GetConfig()
+
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(time.Duration(config.IdTokenTtl) * time.Second)
 	} else {
-		b = []byte(key)
+		expiresAt = expiresAt.Add(time.Duration(config.ExpiredRetention) * time.Second)
 	}
 
-	if err != nil {
-		return nil, err
-	}
+	exp := strconv.FormatInt(expiresAt.Unix(), 10)
 
-	block, _ := pem.Decode(b)
-	if block == nil || block.Type != "EC PRIVATE KEY" {
-		return nil, errors.New("Not a ECDSA Key")
+	if purpose == PurposeRequestId {
+		id = base64.RawURLEncoding.EncodeToString([]byte(id))
 	}
 
-	// Parse den ASN.1-Struktur des privaten Schlüssels
-	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	signature, err := common.GetEnvironment().GetKeyring().Sign(idTokenMessage(tenantId, id, string(purpose), exp))
+
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	return privateKey.(*ecdsa.PrivateKey), nil
+
+	return strings.Join([]string{id, string(purpose), exp, signature}, "."), nil
 }
 
-func SignId(message, key string) (string, error) {
+// VerifyIdToken checks signature, tenant, purpose and expiry of the token.
+func VerifyIdToken(tenantId string, token string, purpose IdPurpose) (*IdToken, error) {
+	parts := strings.SplitN(token, ".", 4)
+
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidIdToken)
+	}
 
-	privateKey, err := decodeKey(key)
+	id, tokenPurpose, exp, signature := parts[0], parts[1], parts[2], parts[3]
 
-	if err != nil {
-		return "", err
+	ok, err := common.GetEnvironment().GetKeyring().Verify(idTokenMessage(tenantId, id, tokenPurpose, exp), signature)
+
+	if err != nil || !ok {
+		return nil, errors.Join(fmt.Errorf("%w: signature", ErrInvalidIdToken), err)
 	}
 
-	hashed := sha256.Sum256([]byte(message))
+	if IdPurpose(tokenPurpose) != purpose {
+		return nil, fmt.Errorf("%w: purpose %s, expected %s", ErrInvalidIdToken, tokenPurpose, purpose)
+	}
+
+	unix, err := strconv.ParseInt(exp, 10, 64)
 
-	r, s, err := ecdsa.Sign(rand.Reader, privateKey, hashed[:])
 	if err != nil {
-		return "", err
+		return nil, errors.Join(fmt.Errorf("%w: expiry", ErrInvalidIdToken), err)
 	}
 
-	signatureDER, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
-	if err != nil {
-		return "", err
+	expiresAt := time.Unix(unix, 0)
+
+	if time.Now().After(expiresAt) {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidIdToken)
 	}
 
-	signatureBase64 := base64.RawURLEncoding.EncodeToString(signatureDER)
+	if purpose == PurposeRequestId {
+		b, err := base64.RawURLEncoding.DecodeString(id)
 
-	return signatureBase64, nil
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("%w: request id", ErrInvalidIdToken), err)
+		}
+
+		id = string(b)
+	}
+
+	return &IdToken{
+		TenantId:  tenantId,
+		Id:        id,
+		Purpose:   IdPurpose(tokenPurpose),
+		ExpiresAt: expiresAt,
+	}, nil
 }
 
-func VerifyId(message, signatureBase64, key string) (bool, error) {
+// the tenant is part of the signed message, but not of the token, because it is given by the route
+func idTokenMessage(tenantId string, id string, purpose string, exp string) string {
+	return strings.Join([]string{tenantId, id, purpose, exp}, ".")
+}
 
-	privateKey, err := decodeKey(key)
+// SignId signs the message with a single encoded key. Presentation ids are issued with IssueIdToken.
+func SignId(message, key string) (string, error) {
+
+	privateKey, err := keyring.DecodeKey(key)
 
 	if err != nil {
-		return false, err
+		return "", err
 	}
 
-	hashed := sha256.Sum256([]byte(message))
+	return keyring.SignMessage(message, privateKey)
+}
+
+// VerifyId verifies a signature created by SignId.
+func VerifyId(message, signatureBase64, key string) (bool, error) {
 
-	signatureDER, err := base64.RawURLEncoding.DecodeString(signatureBase64)
-	if err != nil {
-		fmt.Println("Error decoding signature:", err)
-		return false, err
-	}
+	privateKey, err := keyring.DecodeKey(key)
 
-	// Dekodieren der Signatur
-	var signature struct{ R, S *big.Int }
-	_, err = asn1.Unmarshal(signatureDER, &signature)
 	if err != nil {
-		fmt.Println("error unmarshalling asn1:", err)
 		return false, err
 	}
 
-	// Überprüfen der Signatur
-	return ecdsa.Verify(&privateKey.PublicKey, hashed[:], signature.R, signature.S), nil
+	return keyring.VerifyMessage(message, signatureBase64, &privateKey.PublicKey)
 }
@@ -2,37 +2,113 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/httpclient"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/policy"
 )
 
-func GetPolicyResult(input interface{}, policy string) (map[string]interface{}, error) {
+// GetPolicyResult posts the input to a policy url and returns the response object.
+func GetPolicyResult(ctx context.Context, input interface{}, policy string) (map[string]interface{}, error) {
 
 	body, err := json.Marshal(input)
 	if err != nil {
 		return nil, err
 	}
 
-	r, err := http.NewRequest("POST", policy, bytes.NewBuffer(body))
-	r.Header.Add("Content-Type", "application/json")
+	r, err := http.NewRequestWithContext(ctx, "POST", policy, bytes.NewBuffer(body))
 	if err != nil {
 		return nil, err
 	}
+	r.Header.Add("Content-Type", "application/json")
 
-	client := &http.Client{}
-	res, err := client.Do(r)
+	res, err := GetHttpClient(httpclient.Policy).Do(r)
 	if err != nil {
 		return nil, err
 	}
 
 	defer res.Body.Close()
 
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("policy %s responded %d", policy, res.StatusCode)
+	}
+
 	var post map[string]interface{}
 
-	derr := json.NewDecoder(res.Body).Decode(&post)
-	if derr != nil {
-		panic(derr)
+	err = json.NewDecoder(res.Body).Decode(&post)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("policy %s responded no json object", policy), err)
 	}
 
 	return post, nil
 }
+
+func policyPath(config *model.Config, hook policy.Hook) string {
+	switch hook {
+	case policy.ClientId:
+		if config.Policy.ClientId == "" {
+			return config.ExternalPresentation.ClientIdPolicy
+		}
+		return config.Policy.ClientId
+	case policy.RequestObject:
+		if config.Policy.RequestObject == "" {
+			return config.ExternalPresentation.RequestObjectPolicy
+		}
+		return config.Policy.RequestObject
+	case policy.Presentation:
+		return config.Policy.Presentation
+	case policy.DisclosureConsent:
+		return config.Policy.DisclosureConsent
+	}
+	return ""
+}
+
+// EvaluatePolicy evaluates the policy configured for the hook, hooks without policy allow everything.
+// Policies given as url are posted to directly, all others are paths of the policy engine.
+func EvaluatePolicy(ctx context.Context, hook policy.Hook, input interface{}) (*policy.Decision, error) {
+	env := common.GetEnvironment()
+	path := policyPath(env.GetConfig(), hook)
+
+	if path == "" {
+		return &policy.Decision{Allow: true}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(env.GetConfig().Policy.TimeoutSec)*time.Second)
+	defer cancel()
+
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		res, err := GetPolicyResult(ctx, input, path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return policy.ParseDecision(res), nil
+	}
+
+	engine := env.GetPolicyEngine()
+
+	if engine == nil {
+		return nil, fmt.Errorf("no policy engine configured for policy %s", path)
+	}
+
+	decision, err := engine.Evaluate(ctx, path, input)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !decision.Allow {
+		env.GetLogger().Info("policy denied", "hook", string(hook), "policy", path, "reasons", strings.Join(decision.Reasons, ", "))
+	}
+
+	return decision, nil
+}
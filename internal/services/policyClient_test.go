@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -44,7 +45,7 @@ func TestPolicyClientWithObject(t *testing.T) {
 		Test: "Bla",
 	}
 
-	res, err := GetPolicyResult(o, srv.URL)
+	res, err := GetPolicyResult(context.Background(), o, srv.URL)
 
 	if err != nil {
 		t.Error()
@@ -54,4 +55,12 @@ func TestPolicyClientWithObject(t *testing.T) {
 		t.Error()
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = GetPolicyResult(ctx, o, srv.URL)
+
+	if err == nil {
+		t.Error("the context of the caller must be used")
+	}
 }
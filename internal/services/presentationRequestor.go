@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 
@@ -15,7 +16,10 @@ import (
 	"github.com/google/uuid"
 	"gitlab.eclipse.org/eclipse/xfsc/libraries/messaging/cloudeventprovider"
 	logr "gitlab.eclipse.org/eclipse/xfsc/libraries/microservice/core/pkg/logr"
+	commonTypes "github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/kms"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/requestobject"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/services/common"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/pkg/messaging"
 	commonMessageTypes "gitlab.eclipse.org/eclipse/xfsc/organisational-credential-manager-w-stack/libraries/messaging/common"
@@ -27,12 +31,25 @@ type PresentationRequestor struct {
 	notifyClient             *cloudeventprovider.CloudEventProviderClient
 	storageClient            *cloudeventprovider.CloudEventProviderClient
 	signerClient             *cloudeventprovider.CloudEventProviderClient
+	auditClient              *cloudeventprovider.CloudEventProviderClient
+	approvalClient           *cloudeventprovider.CloudEventProviderClient
+	deadLetterClient         *cloudeventprovider.CloudEventProviderClient
 	logger                   logr.Logger
 	presentationRequestTopic string
 	storagePubTopic          string
 	config                   *model.Config
 }
 
+// ErrMissingClientDid rejects requests without the did of the verifier, which is their client id.
+var ErrMissingClientDid = errors.New("did of the verifier missing")
+
+// Writes of the authorization flow, replaced by tests of the flow.
+var (
+	addPresentationRequest = common.AddPresentationDefinitonToDb
+	updateStatus           = common.UpdateDbStatus
+	storeRequest           = common.StoreRequest
+)
+
 const CredentialApiGroup = "/presentation"
 const InternalApiGroup = "/internal"
 const DirectGroup = "/proof"
@@ -74,6 +91,14 @@ func (requestor *PresentationRequestor) Initialize(config *model.Config, logger
 
 	requestor.notifyClient = client2
 
+	if config.StatusEvents.Enabled {
+		common.AddAuditListener(requestor.publishStatusEvent)
+	}
+
+	if config.Webhooks.Enabled && len(config.Webhooks.Tenants) > 0 {
+		common.AddAuditListener(requestor.enqueueWebhook)
+	}
+
 	client3, err := cloudeventprovider.New(cloudeventprovider.Config{Protocol: config.Messaging.Protocol, Settings: cloudeventprovider.NatsConfig{
 		Url:          config.Messaging.Nats.Url,
 		QueueGroup:   config.Messaging.Nats.QueueGroup,
@@ -100,23 +125,99 @@ func (requestor *PresentationRequestor) Initialize(config *model.Config, logger
 
 	requestor.signerClient = client4
 
+	if config.Audit.Topic != "" {
+		client5, err := cloudeventprovider.New(cloudeventprovider.Config{Protocol: config.Messaging.Protocol, Settings: cloudeventprovider.NatsConfig{
+			Url:          config.Messaging.Nats.Url,
+			QueueGroup:   config.Messaging.Nats.QueueGroup,
+			TimeoutInSec: time.Minute,
+		}}, cloudeventprovider.Pub, config.Audit.Topic)
+
+		if err != nil {
+			logger.Error(err, "Error during message creation")
+			return err
+		}
+
+		requestor.auditClient = client5
+		common.AddAuditListener(requestor.publishAudit)
+	}
+
+	if config.Consent.ApprovalTopic != "" {
+		client6, err := cloudeventprovider.New(cloudeventprovider.Config{Protocol: config.Messaging.Protocol, Settings: cloudeventprovider.NatsConfig{
+			Url:          config.Messaging.Nats.Url,
+			QueueGroup:   config.Messaging.Nats.QueueGroup,
+			TimeoutInSec: time.Duration(config.Consent.ApprovalTimeoutSec) * time.Second,
+		}}, cloudeventprovider.Req, config.Consent.ApprovalTopic)
+
+		if err != nil {
+			logger.Error(err, "Error during message creation")
+			return err
+		}
+
+		requestor.approvalClient = client6
+		SetConsentApprover(requestor.requestApproval)
+	}
+
+	if config.Delivery.DeadLetterTopic != "" {
+		client7, err := cloudeventprovider.New(cloudeventprovider.Config{Protocol: config.Messaging.Protocol, Settings: cloudeventprovider.NatsConfig{
+			Url:          config.Messaging.Nats.Url,
+			QueueGroup:   config.Messaging.Nats.QueueGroup,
+			TimeoutInSec: time.Minute,
+		}}, cloudeventprovider.Pub, config.Delivery.DeadLetterTopic)
+
+		if err != nil {
+			logger.Error(err, "Error during message creation")
+			return err
+		}
+
+		requestor.deadLetterClient = client7
+		SetDeadLetterListener(requestor.publishDeadLetter)
+	}
+
 	return err
 }
 
 func (requestor *PresentationRequestor) GetRequestObjectAndSetObjectFetched(ctx context.Context, schema, host, path string, id string, tenantId, groupId, did, key string) ([]byte, error) {
 
-	row, err := common.GetEntryFromDb(ctx, tenantId, id)
+	row, err := LookupEntry(ctx, tenantId, id)
 
 	if err == nil {
+		// the client id of the authorization request, records created before it was stored use the header
+		clientId := row.ClientId
+
+		if clientId == "" {
+			clientId = did
+		}
+
+		if clientId == "" {
+			return nil, ErrMissingClientDid
+		}
+
+		if !model.Status(row.State).CanTransitionTo(model.PresentationRequestObjectFetched) {
+			return nil, fmt.Errorf("%w: %s to %s", common.ErrInvalidTransition, row.State, model.PresentationRequestObjectFetched)
+		}
+
+		if requestor.config.OneTimeUse.Enabled {
+			err = common.ClaimRequestObjectFetch(ctx, tenantId, id, requestor.config.OneTimeUse.MaxRequestObjectFetches)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		responseToken, err := IssueIdToken(tenantId, id, PurposeResponse, row.ExpiresAt)
+
+		if err != nil {
+			return nil, err
+		}
 
 		clientUrl := url.URL{
 			Scheme: schema,
 			Host:   host,
-			Path:   path + "/" + id,
+			Path:   path + "/" + responseToken,
 		}
 
 		tok := make(map[string]interface{})
-		tok["client_id"] = did
+		tok["client_id"] = clientId
 		tok["response_uri"] = clientUrl.String()
 		tok["response_type"] = "vp_token"
 		tok["nonce"] = row.Nonce
@@ -124,57 +225,82 @@ func (requestor *PresentationRequestor) GetRequestObjectAndSetObjectFetched(ctx
 		tok["response_mode"] = "direct_post"
 		tok["presentation_definition"] = row.PresentationDefinition
 		tok["client_id_scheme"] = "did"
+		tok["aud"] = "https://self-issued.me/v2"
+		tok["iat"] = time.Now().Unix()
+		tok["exp"] = time.Now().Add(time.Duration(requestor.config.RequestObjectSigning.TtlSec) * time.Second).Unix()
 
 		pb, err := json.Marshal(tok)
 		if err != nil {
 			return nil, err
 		}
 
-		var req = msg.CreateTokenRequest{
-			Request: commonMessageTypes.Request{
-				TenantId:  tenantId,
-				RequestId: uuid.NewString(),
-			},
-			Namespace: tenantId,
-			Key:       key,
-			Payload:   pb,
-		}
-
-		js, err := json.Marshal(req)
+		token, err := requestor.signRequestObject(ctx, tenantId, clientId, key, pb)
 
 		if err != nil {
 			return nil, err
 		}
 
-		ev, err := cloudeventprovider.NewEvent("request", "signer.signToken", js)
+		err = updateStatus(ctx, tenantId, string(model.PresentationRequestObjectFetched), id)
 
 		if err != nil {
 			return nil, err
 		}
 
-		res, err := requestor.signerClient.RequestCtx(ctx, ev)
+		return token, nil
+	}
+	return nil, err
+}
 
-		if err != nil {
-			return nil, err
+// signRequestObject signs with the backend of the tenant, or with the signer service if the tenant has none.
+// The kid is the key as fragment of the client did, unless the key is a did url itself.
+func (requestor *PresentationRequestor) signRequestObject(ctx context.Context, tenantId, did, key string, payload []byte) ([]byte, error) {
+	if backend := commonTypes.GetEnvironment().GetSigningBackends().ForTenant(tenantId); backend != nil {
+		kid := key
+
+		if did != "" && key != "" && !strings.HasPrefix(key, "did:") {
+			kid = did + "#" + key
 		}
 
-		var rep msg.CreateTokenReply
+		return kms.SignJwt(ctx, backend, key, kid, requestobject.Type, payload)
+	}
 
-		err = json.Unmarshal(res.DataEncoded, &rep)
+	var req = msg.CreateTokenRequest{
+		Request: commonMessageTypes.Request{
+			TenantId:  tenantId,
+			RequestId: uuid.NewString(),
+		},
+		Namespace: tenantId,
+		Key:       key,
+		Payload:   payload,
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	js, err := json.Marshal(req)
 
-		err = common.UpdateDbStatus(ctx, tenantId, string(model.PresentationRequestObjectFetched), id)
+	if err != nil {
+		return nil, err
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	ev, err := cloudeventprovider.NewEvent("request", "signer.signToken", js)
 
-		return rep.Token, nil
+	if err != nil {
+		return nil, err
 	}
-	return nil, err
+
+	res, err := requestor.signerClient.RequestCtx(ctx, ev)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rep msg.CreateTokenReply
+
+	err = json.Unmarshal(res.DataEncoded, &rep)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rep.Token, nil
 }
 
 func (requestor *PresentationRequestor) reply(ctx context.Context, event event.Event) (*event.Event, error) {
@@ -196,30 +322,73 @@ func (requestor *PresentationRequestor) reply(ctx context.Context, event event.E
 			return nil, errors.New("problem during marshaling")
 		}
 
+		ctx = common.ContextWithActor(ctx, common.Actor{Type: common.ActorNats, Id: authorizationRequest.RequestId})
+
+		if authorizationRequest.Template != nil {
+			definition, err := MaterializeTemplate(ctx, authorizationRequest.TenantId, *authorizationRequest.Template)
+
+			if err != nil {
+				return requestor.AuthorizationReplyError(reply, err, "error during template materialization")
+			}
+
+			authorizationRequest.PresentationDefinition = *definition
+		}
+
 		err = authorizationRequest.PresentationDefinition.CheckPresentationDefinition()
 
 		if err != nil {
 			return requestor.AuthorizationReplyError(reply, err, "error during check presentation")
 		}
 
-		id, err := SignId(authorizationRequest.TenantId, requestor.config.SigningKey)
+		err = CheckWebhookUrl(requestor.config, authorizationRequest.TenantId, authorizationRequest.WebhookUrl)
+
+		if err != nil {
+			return requestor.AuthorizationReplyError(reply, err, "error during check webhook url")
+		}
+
+		if authorizationRequest.Did == "" {
+			return requestor.AuthorizationReplyError(reply, ErrMissingClientDid, "error during check did")
+		}
+
+		id := NewPresentationId()
+		expiresAt := time.Time{}
+		if authorizationRequest.Ttl > 0 {
+			expiresAt = time.Now().Add(time.Duration(authorizationRequest.Ttl) * time.Second)
+		}
+
+		accessToken, err := IssueIdToken(authorizationRequest.TenantId, id, PurposeInternal, expiresAt)
 
 		if err != nil {
 			return requestor.AuthorizationReplyError(reply, err, "error during id creation")
 		}
 
 		reply.PresentationId = id
-		reply.RequestUri = requestor.buildUri(authorizationRequest, id)
+		reply.AccessToken = accessToken
+
+		if authorizationRequest.RequestId != "" {
+			reply.RequestAccessToken, err = IssueIdToken(authorizationRequest.TenantId, authorizationRequest.RequestId, PurposeRequestId, expiresAt)
+
+			if err != nil {
+				return requestor.AuthorizationReplyError(reply, err, "error during id creation")
+			}
+		}
+		reply.RequestUri, err = requestor.buildUri(authorizationRequest, id, expiresAt)
+
+		if err != nil {
+			return requestor.AuthorizationReplyError(reply, err, "error during id creation")
+		}
 
 		requestOptions := common.PresentationRequestOptions{
-			TenantId:  authorizationRequest.TenantId,
-			Id:        id,
-			RequestId: authorizationRequest.RequestId,
-			GroupId:   authorizationRequest.GroupId,
-			Ttl:       authorizationRequest.Ttl,
+			TenantId:   authorizationRequest.TenantId,
+			Id:         id,
+			RequestId:  authorizationRequest.RequestId,
+			GroupId:    authorizationRequest.GroupId,
+			Ttl:        authorizationRequest.Ttl,
+			WebhookUrl: authorizationRequest.WebhookUrl,
+			ClientId:   authorizationRequest.Did,
 		}
 
-		err = common.AddPresentationDefinitonToDb(authorizationRequest.PresentationDefinition, requestOptions, ctx)
+		err = addPresentationRequest(authorizationRequest.PresentationDefinition, requestOptions, ctx)
 
 		if err != nil {
 			return requestor.AuthorizationReplyError(reply, err, "error during db adding")
@@ -281,12 +450,18 @@ func (requestor *PresentationRequestor) Alive() bool {
 	return requestor.client.Alive()
 }
 
-func (requestor *PresentationRequestor) buildUri(request messaging.PresentationAuthorizationCreationRequest, id string) string {
+func (requestor *PresentationRequestor) buildUri(request messaging.PresentationAuthorizationCreationRequest, id string, expiresAt time.Time) (string, error) {
+
+	requestToken, err := IssueIdToken(request.TenantId, id, PurposeRequestObject, expiresAt)
+
+	if err != nil {
+		return "", err
+	}
 
 	requestObjectUrl := url.URL{
 		Scheme: requestor.config.ExternalPresentation.ClientUrlSchema,
 		Host:   request.RequestObjectUri,
-		Path:   "/" + id + "/request-object/request.jwt",
+		Path:   "/" + requestToken + "/request-object/request.jwt",
 	}
 
 	authUrl := url.URL{
@@ -295,20 +470,22 @@ func (requestor *PresentationRequestor) buildUri(request messaging.PresentationA
 		Path:   "/authorize",
 	}
 
-	clientUrl := url.URL{
-		Scheme: requestor.config.ExternalPresentation.ClientUrlSchema,
-		Host:   request.TenantUri,
-		Path:   CredentialApiGroup + DirectGroup + "/" + id,
-	}
-
+	// the client id is the did which signs the request object, the response uri is part of the request object
 	query := authUrl.Query()
-	query.Add("client_id", clientUrl.String())
+	query.Add("client_id", request.Did)
 	query.Add("request_uri", requestObjectUrl.String())
 	authUrl.RawQuery = query.Encode()
-	return requestor.config.ExternalPresentation.ClientUrlSchema + "://" + request.TargetUri + authUrl.RequestURI()
+	return requestor.config.ExternalPresentation.ClientUrlSchema + "://" + request.TargetUri + authUrl.RequestURI(), nil
 }
 
-func (requestor *PresentationRequestor) publishStatus(tenantId string, requestId string, presentationId string, status string) {
+func (requestor *PresentationRequestor) publishStatus(tenantId string, requestId string, presentationId string, expiresAt time.Time, status string, claims map[string]messaging.DescriptorClaims) {
+
+	accessToken, err := IssueIdToken(tenantId, presentationId, PurposeInternal, expiresAt)
+
+	if err != nil {
+		requestor.logger.Error(err, "error during id token creation", err)
+		return
+	}
 
 	msg := messaging.ProofNotifyEvent{
 		Reply: commonMessageTypes.Reply{
@@ -316,7 +493,9 @@ func (requestor *PresentationRequestor) publishStatus(tenantId string, requestId
 			RequestId: requestId,
 		},
 		PresentationId: presentationId,
+		AccessToken:    accessToken,
 		Status:         status,
+		Claims:         claims,
 	}
 	b, err := json.Marshal(msg)
 
@@ -339,3 +518,188 @@ func (requestor *PresentationRequestor) publishStatus(tenantId string, requestId
 		return
 	}
 }
+
+// publishStatusEvent publishes the status event of a state transition, enriched by the record of the transition.
+func (requestor *PresentationRequestor) publishStatusEvent(tenantId string, row *model.VerificationEntry, entry model.AuditEntry) {
+	eventType, ok := messaging.StatusEventTypes[entry.State]
+
+	if !ok {
+		return
+	}
+
+	b, err := json.Marshal(statusEvent(tenantId, row, entry))
+
+	if err != nil {
+		requestor.logger.Error(err, "error in json marshalling", err)
+		return
+	}
+
+	e, err := cloudeventprovider.NewEvent(requestor.presentationRequestTopic, eventType, b)
+
+	if err != nil {
+		requestor.logger.Error(err, "error in event creation", err)
+		return
+	}
+
+	if requestor.config.StatusEvents.SchemaBaseUrl != "" {
+		e.SetDataSchema(requestor.config.StatusEvents.SchemaBaseUrl + eventType)
+	}
+
+	err = requestor.notifyClient.Pub(e)
+
+	if err != nil {
+		requestor.logger.Error(err, "error in status event publication", err)
+		return
+	}
+}
+
+func statusEvent(tenantId string, row *model.VerificationEntry, entry model.AuditEntry) messaging.StatusEvent {
+	return messaging.StatusEvent{
+		Reply: commonMessageTypes.Reply{
+			TenantId:  tenantId,
+			RequestId: row.RequestId,
+			GroupId:   row.GroupId,
+		},
+		EventId:        entry.Id,
+		Version:        messaging.StatusEventVersion,
+		Timestamp:      entry.Timestamp,
+		PresentationId: row.Id,
+		ClientId:       row.ClientId,
+		Status:         entry.State,
+		ActorType:      entry.ActorType,
+		ExpiresAt:      row.ExpiresAt,
+		Verification:   verificationSummary(row, entry),
+	}
+}
+
+// verificationSummary is only given for the outcomes of a received presentation.
+func verificationSummary(row *model.VerificationEntry, entry model.AuditEntry) *messaging.VerificationSummary {
+	switch model.Status(entry.State) {
+	case model.PresentationReceived, model.PresentationRejected, model.PresentationVerificationFailed:
+	default:
+		return nil
+	}
+
+	summary := &messaging.VerificationSummary{
+		Valid:        model.Status(entry.State) == model.PresentationReceived,
+		Outcome:      entry.Outcome,
+		SchemaChecks: len(row.SchemaValidation),
+	}
+
+	for _, r := range row.SchemaValidation {
+		if !r.Valid {
+			summary.SchemaFailures++
+		}
+	}
+
+	for descriptor := range row.Claims {
+		summary.Descriptors = append(summary.Descriptors, descriptor)
+	}
+	sort.Strings(summary.Descriptors)
+
+	return summary
+}
+
+func (requestor *PresentationRequestor) publishAudit(tenantId string, row *model.VerificationEntry, entry model.AuditEntry) {
+
+	msg := messaging.AuditEvent{
+		Reply: commonMessageTypes.Reply{
+			TenantId: tenantId,
+		},
+		PresentationId: row.Id,
+		EventId:        entry.Id,
+		Timestamp:      entry.Timestamp,
+		State:          entry.State,
+		ActorType:      entry.ActorType,
+		ActorId:        entry.ActorId,
+		Outcome:        entry.Outcome,
+	}
+	b, err := json.Marshal(msg)
+
+	if err != nil {
+		requestor.logger.Error(err, "error in json marshalling", err)
+		return
+	}
+
+	e, err := cloudeventprovider.NewEvent(requestor.config.Audit.Topic, messaging.AuditType, b)
+
+	if err != nil {
+		requestor.logger.Error(err, "error in event creation", err)
+		return
+	}
+
+	err = requestor.auditClient.Pub(e)
+
+	if err != nil {
+		requestor.logger.Error(err, "error in audit publication", err)
+		return
+	}
+}
+
+func (requestor *PresentationRequestor) requestApproval(ctx context.Context, request messaging.ConsentApprovalRequest) (bool, string, error) {
+	b, err := json.Marshal(request)
+
+	if err != nil {
+		return false, "", err
+	}
+
+	e, err := cloudeventprovider.NewEvent(requestor.config.Consent.ApprovalTopic, messaging.ConsentApprovalType, b)
+
+	if err != nil {
+		return false, "", err
+	}
+
+	res, err := requestor.approvalClient.RequestCtx(ctx, e)
+
+	if err != nil {
+		return false, "", err
+	}
+
+	var reply messaging.ConsentApprovalReply
+
+	err = json.Unmarshal(res.DataEncoded, &reply)
+
+	if err != nil {
+		return false, "", err
+	}
+
+	if reply.Error != nil {
+		return false, "", errors.New(reply.Error.Msg)
+	}
+
+	return reply.Approved, reply.Reason, nil
+}
+
+func (requestor *PresentationRequestor) publishDeadLetter(tenantId string, row *model.VerificationEntry, delivery model.Delivery) {
+
+	msg := messaging.DeliveryDeadLetterEvent{
+		Reply: commonMessageTypes.Reply{
+			TenantId:  tenantId,
+			RequestId: row.RequestId,
+		},
+		PresentationId: row.Id,
+		ResponseUri:    row.ResponseUri,
+		Attempts:       delivery.Attempts,
+		LastError:      delivery.LastError,
+	}
+	b, err := json.Marshal(msg)
+
+	if err != nil {
+		requestor.logger.Error(err, "error in json marshalling", err)
+		return
+	}
+
+	e, err := cloudeventprovider.NewEvent(requestor.config.Delivery.DeadLetterTopic, messaging.DeliveryDeadLetterType, b)
+
+	if err != nil {
+		requestor.logger.Error(err, "error in event creation", err)
+		return
+	}
+
+	err = requestor.deadLetterClient.Pub(e)
+
+	if err != nil {
+		requestor.logger.Error(err, "error in dead letter publication", err)
+		return
+	}
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/pkg/messaging"
+)
+
+func TestStatusEvent(t *testing.T) {
+	row := &model.VerificationEntry{
+		Id:               "id",
+		RequestId:        "request",
+		ClientId:         "https://verifier.example.com",
+		State:            string(model.PresentationReceived),
+		ExpiresAt:        time.Now(),
+		SchemaValidation: []model.SchemaResult{{Valid: true}, {Valid: false}},
+		Claims:           map[string]messaging.DescriptorClaims{"b": {}, "a": {}},
+	}
+
+	event := statusEvent("tenant", row, model.AuditEntry{Id: "event", State: row.State, Outcome: "valid"})
+
+	if event.PresentationId != "id" || event.RequestId != "request" || event.ClientId != row.ClientId || event.Status != row.State {
+		t.Error("event must be built from the record of the transition", event)
+	}
+
+	summary := event.Verification
+
+	if summary == nil || !summary.Valid || summary.SchemaChecks != 2 || summary.SchemaFailures != 1 || len(summary.Descriptors) != 2 || summary.Descriptors[0] != "a" {
+		t.Error("summary expected", summary)
+	}
+
+	row.State = string(model.PresentationExpired)
+
+	if event = statusEvent("tenant", row, model.AuditEntry{State: row.State}); event.Verification != nil {
+		t.Error("expiry has no verification summary")
+	}
+}
@@ -1,20 +1,24 @@
 package services
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	logr "gitlab.eclipse.org/eclipse/xfsc/libraries/microservice/core/pkg/logr"
 	"gitlab.eclipse.org/eclipse/xfsc/libraries/ssi/oid4vip/model/presentation"
 	commonTypes "github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/httpclient"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/services/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/signer"
 )
 
 const (
@@ -25,6 +29,14 @@ const (
 	SignError           = "Error during Signing"
 	TransmitError       = "Transmit Error"
 	PostResponseError   = "Error posting data to response uri"
+	CancelError         = "Cancel Error"
+	ConsentError        = "Disclosure not allowed"
+)
+
+// Lookups of the records of the proof routes, replaced by tests of the routes.
+var (
+	LookupEntry            = common.GetEntryFromDb
+	LookupEntryByRequestId = common.GetEntryFromDbByRequestId
 )
 
 // HandleCreateProofById godoc
@@ -37,6 +49,7 @@ const (
 // @Param id path string true "Proof ID"
 // @Param body body model.ProofModel true "Proof Model"
 // @Success 200
+// @Success 202 {object} model.Delivery
 // @Failure 400 {object} ServerErrorResponse
 // @Failure 500 {object} ServerErrorResponse
 // @Router /internal/proofs/proof/{id} [post]
@@ -54,6 +67,7 @@ func HandleCreateProofById(ctx *gin.Context, config *model.Config) {
 // @Param id path string true "Proof RequestID"
 // @Param body body model.ProofModel true "Proof Model"
 // @Success 200
+// @Success 202 {object} model.Delivery
 // @Failure 400 {object} ServerErrorResponse
 // @Failure 500 {object} ServerErrorResponse
 // @Router /internal/proofs/proof/request/{id} [post]
@@ -85,40 +99,115 @@ func handleCreateProof(ctx *gin.Context, config *model.Config, byRequestId bool)
 		return
 	}
 
-	res, err := signerServiceSignLdpJson(body, logger, config)
+	var row *model.VerificationEntry
+	if byRequestId {
+		row, err = LookupEntryByRequestId(context, tenantId, id)
+	} else {
+		row, err = LookupEntry(context, tenantId, id)
+	}
+	if err != nil {
+		_ = ErrorResponse(ctx, RecordNotFoundError, err)
+		return
+	}
+	if !model.Status(row.State).CanTransitionTo(model.PresentationTransmitted) {
+		ErrorResponse(ctx, TransmitError, fmt.Errorf("%w: %s to %s", common.ErrInvalidTransition, row.State, model.PresentationTransmitted))
+		return
+	}
+	// a pending delivery is only taken over after its deadline, when it can not be in progress anymore
+	if row.Delivery != nil && row.Delivery.Status == model.DeliveryPending && row.Delivery.Deadline.After(time.Now()) {
+		ctx.JSON(http.StatusAccepted, row.Delivery)
+		return
+	}
+
+	// cassandra keeps milliseconds, the deadline is compared when the claim is released
+	deadline := time.Now().Add(time.Duration(config.Delivery.DeadlineSec) * time.Second).Truncate(time.Millisecond)
+	lease := time.Duration(config.Delivery.LeaseSec) * time.Second
+
+	// the delivery is claimed before consent and signing, so that concurrent calls sign and post only once
+	claimed, current, err := common.ClaimDelivery(context, tenantId, row.Id, row.Delivery, deadline)
 
 	if err != nil {
-		ErrorResponse(ctx, SignError, err)
+		ErrorResponse(ctx, TransmitError, err)
 		return
 	}
 
-	var row *model.VerificationEntry
-	if byRequestId {
-		row, err = common.GetEntryFromDbByRequestId(context, tenantId, id)
-	} else {
-		row, err = common.GetEntryFromDb(context, tenantId, id)
+	if !claimed {
+		ctx.JSON(http.StatusAccepted, current)
+		return
 	}
+
+	queued := false
+
+	defer func() {
+		if queued {
+			return
+		}
+		if err := common.ReleaseDelivery(context, tenantId, row.Id, row.Delivery, deadline); err != nil {
+			logger.Error(err, "error during delivery release", "id", row.Id)
+		}
+	}()
+
+	err = CheckDisclosureConsent(context, config, tenantId, row, body)
+
 	if err != nil {
-		_ = ErrorResponse(ctx, RecordNotFoundError, err)
+		ErrorResponse(ctx, ConsentError, err)
+		return
+	}
+
+	res, err := signerServiceSignLdpJson(context, tenantId, body, logger)
+
+	if err != nil {
+		ErrorResponse(ctx, SignError, err)
 		return
 	}
+
+	forms := make([]string, 0, len(res))
+
 	for _, pres := range res {
-		err = postResponse(pres, row, body, logger)
+		formdata, err := getFormData(pres, row, body, logger)
 
 		if err != nil {
-			_ = ErrorResponse(ctx, PostResponseError, err)
-			//TODO Retry?
+			ErrorResponse(ctx, MarshallingError, err)
 			return
 		}
+
+		forms = append(forms, formdata.Encode())
+	}
+
+	// the responses are persisted first, so that they are retried if the verifier is not reachable
+	err = common.AddToOutbox(context, tenantId, row, forms, deadline, lease)
+
+	if err != nil {
+		ErrorResponse(ctx, TransmitError, err)
+		return
+	}
+
+	queued = true
+
+	items, err := common.GetOutboxItems(context, tenantId, row.Id)
+
+	if err != nil {
+		ErrorResponse(ctx, TransmitError, err)
+		return
 	}
 
-	err = common.UpdateDbStatus(context, tenantId, string(model.PresentationTransmitted), id)
+	delivery, err := deliver(context, config, tenantId, row, items)
+
+	if delivery.Status == model.DeliveryDeadLettered {
+		_ = ErrorResponse(ctx, PostResponseError, err)
+		return
+	}
 
 	if err != nil {
 		ErrorResponse(ctx, TransmitError, err)
 		return
 	}
 
+	if delivery.Status == model.DeliveryPending {
+		ctx.JSON(http.StatusAccepted, delivery)
+		return
+	}
+
 	ctx.JSON(200, nil)
 	return
 }
@@ -161,9 +250,12 @@ func handleGetProofRequest(ctx *gin.Context, config *model.Config, byRequestId b
 	var row *model.VerificationEntry
 	var err error
 	if byRequestId {
-		row, err = common.GetEntryFromDbByRequestId(ctx.Request.Context(), tenantId, id)
+		row, err = LookupEntryByRequestId(ctx.Request.Context(), tenantId, id)
 	} else {
-		row, err = common.GetEntryFromDb(ctx.Request.Context(), tenantId, id)
+		row, err = LookupEntry(ctx.Request.Context(), tenantId, id)
+	}
+	if err == nil {
+		row.AccessToken, err = IssueIdToken(tenantId, row.Id, PurposeInternal, row.ExpiresAt)
 	}
 	if err == nil {
 		ctx.JSON(200, row)
@@ -173,6 +265,32 @@ func handleGetProofRequest(ctx *gin.Context, config *model.Config, byRequestId b
 	}
 }
 
+// HandleGetProofAudit godoc
+// @Summary Retrieves the audit trail of a proof request
+// @Description Retrieves all state transitions of a proof request with actor, timestamp and verification outcome
+// @Tags internal
+// @Accept json
+// @Produce json
+// @Param tenantId path string true "Tenant ID"
+// @Param id path string true "Proof ID"
+// @Success 200 {array} model.AuditEntry
+// @Failure 400 {object} ServerErrorResponse
+// @Failure 500 {object} ServerErrorResponse
+// @Router /internal/proofs/proof/{id}/audit [get]
+func HandleGetProofAudit(ctx *gin.Context, config *model.Config) {
+	id := ctx.Param("id")
+	tenantId := ctx.Param("tenantId")
+
+	entries, err := common.GetAuditTrail(ctx.Request.Context(), tenantId, id)
+
+	if err == nil {
+		ctx.JSON(200, entries)
+		return
+	} else {
+		ErrorResponse(ctx, RecordNotFoundError, err)
+	}
+}
+
 // HandleAssignProof godoc
 // @Summary Assigns record to account
 // @Description Assigns record to account
@@ -200,6 +318,32 @@ func HandleAssignProof(ctx *gin.Context, config *model.Config) {
 	}
 }
 
+// HandleCancelProof godoc
+// @Summary Cancels a proof request
+// @Description Cancels a proof request, which is not finished yet. Later fetches and submissions are rejected.
+// @Tags internal
+// @Accept json
+// @Produce json
+// @Param tenantId path string true "Tenant ID"
+// @Param id path string true "Proof ID"
+// @Success 200
+// @Failure 400 {object} ServerErrorResponse
+// @Failure 500 {object} ServerErrorResponse
+// @Router /internal/proofs/proof/{id}/cancel [put]
+func HandleCancelProof(ctx *gin.Context, config *model.Config) {
+	id := ctx.Param("id")
+	tenantId := ctx.Param("tenantId")
+
+	err := common.UpdateDbStatus(ctx.Request.Context(), tenantId, string(model.PresentationCancelled), id)
+
+	if err == nil {
+		ctx.AbortWithStatus(200)
+		return
+	} else {
+		ErrorResponse(ctx, CancelError, err)
+	}
+}
+
 // HandleListProof godoc
 // @Summary Lists proofs for a group
 // @Description Lists proofs for a group
@@ -218,6 +362,10 @@ func HandleListProof(ctx *gin.Context, config *model.Config) {
 
 	row, err := common.GetEntriesFromDb(ctx.Request.Context(), tenantId, groupId)
 
+	for i := 0; err == nil && i < len(row); i++ {
+		row[i].AccessToken, err = IssueIdToken(tenantId, row[i].Id, PurposeInternal, row[i].ExpiresAt)
+	}
+
 	if err == nil {
 		ctx.JSON(200, row)
 		return
@@ -226,22 +374,28 @@ func HandleListProof(ctx *gin.Context, config *model.Config) {
 	}
 }
 
-func postResponse(vpToken []byte, row *model.VerificationEntry, proofModel model.ProofModel, logger logr.Logger) error {
-
-	formdata, err := getFormData(vpToken, row, proofModel, logger)
+func postResponse(ctx context.Context, responseUri string, form string, logger logr.Logger) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, responseUri, strings.NewReader(form))
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %w", ErrDeliveryRejected, err)
 	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	rep, err := GetHttpClient().PostForm(row.ResponseUri, formdata)
+	rep, err := GetHttpClient(httpclient.ResponseUri).Do(req)
 
 	if err != nil {
-		logger.Error(err, "Error during posting response", "responseUri", row.ResponseUri)
+		logger.Error(err, "Error during posting response", "responseUri", responseUri)
 		return err
 	}
 
+	defer rep.Body.Close()
+
 	if rep.StatusCode != 200 {
-		err = fmt.Errorf("response uri %s responded an error", row.ResponseUri)
+		err = fmt.Errorf("response uri %s responded %d", responseUri, rep.StatusCode)
+		// client errors are not retried, except timeouts and rate limits
+		if rep.StatusCode >= 400 && rep.StatusCode < 500 && rep.StatusCode != http.StatusRequestTimeout && rep.StatusCode != http.StatusTooManyRequests {
+			err = fmt.Errorf("%w: %w", ErrDeliveryRejected, err)
+		}
 		b, er := io.ReadAll(rep.Body)
 		if er == nil {
 			err = errors.Join(err, errors.New(string(b)))
@@ -277,16 +431,19 @@ func getFormData(vpToken []byte, row *model.VerificationEntry, proofModel model.
 	return formdata, nil
 }
 
-func signerServiceSignLdpJson(payload model.ProofModel, logger logr.Logger, config *model.Config) ([][]byte, error) {
-	presentations, err := fromProofModelToPresentation(payload, logger)
+func signerServiceSignLdpJson(ctx context.Context, tenantId string, payload model.ProofModel, logger logr.Logger) ([][]byte, error) {
+	requests, err := fromProofModelToPresentation(payload, logger)
 	if err != nil {
 		return nil, err
 	}
 	var res = make([][]byte, 0)
 
-	for _, pres := range presentations {
-		b, err := processPresentationData(err, pres, logger, config)
+	for _, request := range requests {
+		logger.Debug("sending presentation to sign", "id", request.Presentation["id"])
+
+		b, err := GetSigner().SignPresentation(ctx, tenantId, request)
 		if err != nil {
+			logger.Error(err, "Error during signer service call")
 			return nil, err
 		}
 		res = append(res, b)
@@ -294,41 +451,8 @@ func signerServiceSignLdpJson(payload model.ProofModel, logger logr.Logger, conf
 	return res, nil
 }
 
-func processPresentationData(err error, presentation map[string]interface{}, logger logr.Logger, config *model.Config) ([]byte, error) {
-	p, err := json.Marshal(presentation)
-
-	if err != nil {
-		logger.Error(err, "Error marshalling presentations.")
-		return nil, err
-	}
-
-	logger.Debug("sending presentation to sign", "presentation\n", string(p))
-
-	rep, err := http.DefaultClient.Post(config.SignerService.PresentationSignUrl, "application/json", bytes.NewBuffer(p))
-
-	if err != nil {
-		logger.Error(err, "Error during signer service call")
-		return nil, err
-	}
-
-	respBody, err := io.ReadAll(rep.Body)
-
-	if err != nil {
-		logger.Error(err, "Error during response body read")
-		return nil, err
-	}
-
-	defer rep.Body.Close()
-
-	if rep.StatusCode != http.StatusOK {
-		return nil, errors.New("signer service call error. result was: " + string(respBody))
-	}
-
-	return respBody, nil
-}
-
-func fromProofModelToPresentation(payload model.ProofModel, logger logr.Logger) ([]map[string]interface{}, error) {
-	var res = make([]map[string]interface{}, 0)
+func fromProofModelToPresentation(payload model.ProofModel, logger logr.Logger) ([]signer.SignRequest, error) {
+	var res = make([]signer.SignRequest, 0)
 	for _, pres := range payload.Payload {
 		var verPres map[string]interface{}
 		filledTemplate := fmt.Sprintf(payloadtemplate, pres.Id, payload.HolderDid)
@@ -371,12 +495,12 @@ const signerServicePayloadTemplate = `{
 	"presentation": "Mollitia architecto rem beatae mollitia."
 }`
 
-func getSignerServiceProofPayload(group string, issuer string, key string, namespace string, presentation map[string]interface{}) map[string]interface{} {
-	res := make(map[string]interface{})
-	res["group"] = group
-	res["issuer"] = issuer
-	res["key"] = key
-	res["namespace"] = namespace
-	res["presentation"] = presentation
-	return res
+func getSignerServiceProofPayload(group string, issuer string, key string, namespace string, presentation map[string]interface{}) signer.SignRequest {
+	return signer.SignRequest{
+		Group:        group,
+		Issuer:       issuer,
+		Key:          key,
+		Namespace:    namespace,
+		Presentation: presentation,
+	}
 }
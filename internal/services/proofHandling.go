@@ -1,27 +1,34 @@
 package services
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
-	"io"
-	"net/http"
+	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gitlab.eclipse.org/eclipse/xfsc/libraries/messaging/cloudeventprovider"
 	"gitlab.eclipse.org/eclipse/xfsc/libraries/ssi/oid4vip/model/presentation"
 	"gitlab.eclipse.org/eclipse/xfsc/libraries/ssi/oid4vip/model/types"
-	oidtypes "gitlab.eclipse.org/eclipse/xfsc/libraries/ssi/oid4vip/model/types"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/claims"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/credential"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/policy"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/proof"
 	commonServices "github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/services/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/pkg/messaging"
 	commonMessageTypes "gitlab.eclipse.org/eclipse/xfsc/organisational-credential-manager-w-stack/libraries/messaging/common"
 	storageMessaging "gitlab.eclipse.org/eclipse/xfsc/organisational-credential-manager-w-stack/storage-service/pkg/messaging"
 )
 
+// Writes of the proof handling, replaced by tests of the handler.
+var updateStatusWithOutcome = commonServices.UpdateDbStatusWithOutcome
+
 // HandleProof godoc
 // @Summary Handles the proof request
 // @Description Handles the proof request by checking the content type and form data, and then processing the presentations
@@ -66,9 +73,8 @@ func HandleProof(c *gin.Context, requestor *PresentationRequestor, config *model
 		return
 	}
 
-	var element interface{}
-	err = json.Unmarshal([]byte(vp_token), &element)
-	var elements = []interface{}{element}
+	var vpToken interface{}
+	err = json.Unmarshal([]byte(vp_token), &vpToken)
 	if err != nil {
 		ErrorResponse(c, "Presentation cant be parsed", errors.New("presentation cant be parsed"))
 		return
@@ -91,11 +97,18 @@ func HandleProof(c *gin.Context, requestor *PresentationRequestor, config *model
 		return
 	}
 
+	err = checkDescriptorMap(vpToken, response.PresentationSubmission.DescriptorMap)
+
+	if err != nil {
+		ErrorResponse(c, "Presentation cant be parsed", err)
+		return
+	}
+
 	id := c.Param("id")
 	tenantId := c.Param("tenantId")
 	ctx := c.Request.Context()
 
-	err = requestor.CheckPresentations(ctx, id, tenantId, elements, response.PresentationSubmission.DescriptorMap, common.GetEnvironment())
+	err = requestor.CheckPresentations(ctx, id, tenantId, vpToken, response.PresentationSubmission.DescriptorMap, common.GetEnvironment())
 
 	if err != nil {
 		ErrorResponse(c, "error during receiving", errors.New("error during receiving"))
@@ -105,57 +118,180 @@ func HandleProof(c *gin.Context, requestor *PresentationRequestor, config *model
 	c.JSON(200, nil)
 }
 
-func (requestor *PresentationRequestor) CheckPresentations(ctx context.Context, id string, tenantId string, elements []interface{}, decriptorMap []presentation.Descriptor, env *common.Environment) error {
+// CheckPresentations verifies each presentation of the vp token once. The descriptor map is applied to the
+// vp token by the paths of its descriptors, only ldp_vp presentations are accepted by HandleProof.
+func (requestor *PresentationRequestor) CheckPresentations(ctx context.Context, id string, tenantId string, vpToken interface{}, decriptorMap []presentation.Descriptor, env *common.Environment) error {
+
+	presentations, err := vpPresentations(vpToken)
+
+	if err != nil {
+		requestor.logger.Error(err, "presentation not accepted", "id", id)
+		return err
+	}
+
+	row, err := LookupEntry(ctx, tenantId, id)
+
+	if err != nil {
+		requestor.logger.Error(err, "did not find process presentation definition")
+		return err
+	}
+
+	//Replays and submissions for finished or expired requests are rejected before any verification
+	if !model.Status(row.State).CanTransitionTo(model.PresentationReceived) {
+		err = fmt.Errorf("%w: %s to %s", commonServices.ErrInvalidTransition, row.State, model.PresentationReceived)
+		requestor.logger.Error(err, "presentation not accepted", "id", id)
+		return err
+	}
+
+	if requestor.config.OneTimeUse.Enabled {
+		err = commonServices.ClaimSubmission(ctx, tenantId, id)
+
+		if err != nil {
+			requestor.logger.Error(err, "presentation not accepted", "id", id)
+			return err
+		}
+	}
 
 	//Check Presentations really
 	var validPresentations = true
-	for i, x := range decriptorMap {
-		if strings.Compare(x.Format, string(oidtypes.LDPVP)) == 0 {
-			err, b := requestor.signerServiceCheckUpLdpJson(elements[i].(map[string]interface{}), id, tenantId)
+	var failures []string
+	var schemaResults []model.SchemaResult
+	for i, p := range presentations {
+		err, b := requestor.verifyLdpPresentation(ctx, p, id, tenantId, row.Nonce)
+		if err != nil {
+			requestor.logger.Error(err, "signer service check failed")
+			uerr := updateStatusWithOutcome(ctx, tenantId, string(model.PresentationVerificationFailed), id, err.Error())
+			if uerr != nil {
+				requestor.logger.Error(uerr, "failed to update status")
+			}
+			return err
+		}
+
+		validPresentations = validPresentations && b
+
+		if b {
+			for _, f := range credential.CheckPresentation(p, credentialCheckOptions(requestor.config, tenantId)) {
+				failures = append(failures, fmt.Sprintf("presentation %d %s", i, f))
+			}
+
+			results, err := validateSchemas(ctx, tenantId, i, p, requestor.config.SchemaValidation.Enforce)
 			if err != nil {
-				requestor.logger.Error(err, "signer service check failed")
+				requestor.logger.Error(err, "schema validation failed")
+				uerr := updateStatusWithOutcome(ctx, tenantId, string(model.PresentationVerificationFailed), id, err.Error())
+				if uerr != nil {
+					requestor.logger.Error(uerr, "failed to update status")
+				}
 				return err
 			}
+			schemaResults = append(schemaResults, results...)
+		}
+	}
 
-			validPresentations = validPresentations && b
+	if len(schemaResults) > 0 {
+		err = commonServices.StoreSchemaResults(ctx, tenantId, id, schemaResults)
+		if err != nil {
+			requestor.logger.Error(err, "failed to store schema validation")
+			return err
 		}
 
-		if strings.Compare(x.Format, string(oidtypes.JWTVC)) == 0 {
-			//TODO Other formats
+		if requestor.config.SchemaValidation.Enforce {
+			for _, r := range schemaResults {
+				if !r.Valid {
+					failures = append(failures, fmt.Sprintf("presentation %d credential %d schema %s: %s", r.Presentation, r.Credential, r.Schema, strings.Join(r.Errors, ", ")))
+				}
+			}
 		}
 	}
 
+	outcome := commonServices.OutcomeInvalid
+
+	if validPresentations && len(failures) > 0 {
+		requestor.logger.Info("credential checks failed", "id", id, "failures", failures)
+		validPresentations = false
+		outcome = commonServices.OutcomeInvalid + ": " + strings.Join(failures, "; ")
+	}
+
 	if validPresentations {
-		for i, x := range decriptorMap {
-			if strings.Compare(x.Format, string(oidtypes.LDPVP)) == 0 {
-				row, err := commonServices.GetEntryFromDb(ctx, tenantId, id)
+		decision, err := EvaluatePolicy(ctx, policy.Presentation, map[string]interface{}{
+			"tenantId":               tenantId,
+			"presentationId":         id,
+			"clientId":               row.ClientId,
+			"presentationDefinition": row.PresentationDefinition,
+			"presentation":           presentations,
+		})
 
-				if err != nil && row.RequestId == "" {
-					requestor.logger.Error(err, "did not find process presentation definition")
-					return err
-				}
-				b, err := json.Marshal(elements[i])
-				if err != nil {
-					requestor.logger.Error(err, "cannot unmarshal presentation")
-					return errors.New("cannot unmarshal presentation")
-				}
-				err = commonServices.StorePresentation(ctx, id, tenantId, b)
+		if err != nil {
+			requestor.logger.Error(err, "presentation policy failed")
+			uerr := updateStatusWithOutcome(ctx, tenantId, string(model.PresentationVerificationFailed), id, err.Error())
+			if uerr != nil {
+				requestor.logger.Error(uerr, "failed to update status")
+			}
+			return err
+		}
 
-				if err != nil {
-					requestor.logger.Error(err, "store presentation failed")
-					return err
+		if !decision.Allow {
+			validPresentations = false
+			outcome = decision.Err().Error()
+		}
+	}
+
+	if validPresentations {
+		var descriptorClaims map[string]messaging.DescriptorClaims
+		var bClaims []byte
+
+		if requestor.config.ClaimExtraction.Enabled {
+			descriptorClaims, err = claims.Extract(row.PresentationDefinition, vpToken, decriptorMap)
+			if err != nil {
+				requestor.logger.Error(err, "claim extraction failed")
+				uerr := updateStatusWithOutcome(ctx, tenantId, string(model.PresentationVerificationFailed), id, err.Error())
+				if uerr != nil {
+					requestor.logger.Error(uerr, "failed to update status")
 				}
+				return err
+			}
 
-				requestor.forwardPresentation(tenantId, row.RequestId, row.GroupId, b)
-				requestor.publishStatus(tenantId, row.RequestId, id, string(model.PresentationReceived))
+			bClaims, err = json.Marshal(descriptorClaims)
+			if err != nil {
+				requestor.logger.Error(err, "cannot marshal claims")
+				return errors.New("cannot marshal claims")
 			}
+		}
 
-			if strings.Compare(x.Format, string(oidtypes.JWTVC)) == 0 {
-				//TODO Other formats
+		minimize := requestor.config.ClaimExtraction.Enabled && requestor.config.ClaimExtraction.Minimize
+
+		var b []byte
+		if !minimize {
+			b, err = json.Marshal(presentations)
+			if err != nil {
+				requestor.logger.Error(err, "cannot unmarshal presentation")
+				return errors.New("cannot unmarshal presentation")
 			}
 		}
+
+		//Stored exactly once, a second submission fails on the state transition
+		err = commonServices.StorePresentation(ctx, id, tenantId, b, bClaims)
+
+		if err != nil {
+			requestor.logger.Error(err, "store presentation failed")
+			return err
+		}
+
+		if minimize {
+			//Only the disclosed claims leave the service
+			requestor.forwardPresentation(tenantId, row.RequestId, row.GroupId, bClaims, nil)
+		} else {
+			for _, vp := range presentations {
+				p, err := json.Marshal(vp)
+				if err != nil {
+					requestor.logger.Error(err, "cannot unmarshal presentation")
+					continue
+				}
+				requestor.forwardPresentation(tenantId, row.RequestId, row.GroupId, p, descriptorClaims)
+			}
+		}
+		requestor.publishStatus(tenantId, row.RequestId, id, row.ExpiresAt, string(model.PresentationReceived), descriptorClaims)
 	} else {
-		err := commonServices.UpdateDbStatus(ctx, tenantId, string(model.PresentationRejected), id)
+		err := updateStatusWithOutcome(ctx, tenantId, string(model.PresentationRejected), id, outcome)
 
 		if err != nil {
 			requestor.logger.Error(err, "failed to update status")
@@ -167,78 +303,170 @@ func (requestor *PresentationRequestor) CheckPresentations(ctx context.Context,
 	return nil
 }
 
-func (requestor *PresentationRequestor) signerServiceCheckUpLdpJson(j map[string]interface{}, id string, tenantId string) (error, bool) {
-	presBytes, err := json.Marshal(j)
-	if err != nil {
-		requestor.logger.Error(err, "Error marshalling presentation")
-		return err, false
+// credentialCheckOptions applies the toggles of the tenant to the global credential checks.
+func credentialCheckOptions(config *model.Config, tenantId string) credential.Options {
+	checks := config.CredentialChecks
+	options := credential.Options{
+		Validity:      checks.Validity,
+		HolderBinding: checks.HolderBinding,
+		AllowBearer:   checks.AllowBearer,
+		ClockSkew:     time.Duration(checks.ClockSkewSec) * time.Second,
+		Now:           time.Now(),
 	}
-	verPres := map[string][]byte{"presentation": presBytes}
-	body, err := json.Marshal(verPres)
-	if err != nil {
-		requestor.logger.Error(err, "Error marshalling presentation")
-		return err, false
 
+	if toggles, ok := checks.Tenants[tenantId]; ok {
+		if toggles.Validity != nil {
+			options.Validity = *toggles.Validity
+		}
+		if toggles.HolderBinding != nil {
+			options.HolderBinding = *toggles.HolderBinding
+		}
+		if toggles.AllowBearer != nil {
+			options.AllowBearer = *toggles.AllowBearer
+		}
 	}
-	requestor.logger.Info("Checking presentation", "body", string(body))
-	if err != nil {
-		requestor.logger.Error(err, "Error marshalling signer service request")
-		return err, false
+
+	return options
+}
+
+// vpPresentations returns the presentations of the vp token, which is a single presentation or an array of them.
+func vpPresentations(vpToken interface{}) ([]map[string]interface{}, error) {
+	items, ok := vpToken.([]interface{})
+
+	if !ok {
+		items = []interface{}{vpToken}
 	}
-	requestor.logger.Debug("Sending to signer service PresentationVerifyUrl", "body", string(body))
-	rep, err := http.DefaultClient.Post(requestor.config.SignerService.PresentationVerifyUrl, "application/json", bytes.NewBuffer(body))
 
-	if err != nil {
-		requestor.logger.Error(err, "Error during signer service call")
-		return err, false
+	ret := make([]map[string]interface{}, 0, len(items))
+
+	for i, item := range items {
+		p, ok := item.(map[string]interface{})
+
+		if !ok {
+			return nil, fmt.Errorf("presentation %d is no json-ld presentation", i)
+		}
+
+		ret = append(ret, p)
+	}
+
+	return ret, nil
+}
+
+// checkDescriptorMap requires that the path of each descriptor addresses one presentation of the vp token.
+func checkDescriptorMap(vpToken interface{}, decriptorMap []presentation.Descriptor) error {
+	for _, d := range decriptorMap {
+		values, err := claims.Query(vpToken, d.Path)
+
+		if err != nil {
+			return fmt.Errorf("descriptor %s: %w", d.Id, err)
+		}
+
+		if len(values) != 1 {
+			return fmt.Errorf("descriptor %s: path %s does not address one presentation", d.Id, d.Path)
+		}
+
+		p, ok := values[0].(map[string]interface{})
+
+		if !ok || !slices.Contains(credential.Types(p), "VerifiablePresentation") {
+			return fmt.Errorf("descriptor %s: path %s does not address a presentation", d.Id, d.Path)
+		}
 	}
 
-	respBody, err := io.ReadAll(rep.Body)
+	return nil
+}
+
+// validateSchemas validates the credentials of a presentation against their json schemas, if enabled. Schemas
+// which can not be fetched fail the verification only if the validation is enforced.
+func validateSchemas(ctx context.Context, tenantId string, presentation int, j map[string]interface{}, enforce bool) ([]model.SchemaResult, error) {
+	validator := common.GetEnvironment().GetSchemaValidator()
 
-	if err != nil {
-		requestor.logger.Error(err, "Error during response body read")
-		return err, false
+	if validator == nil {
+		return nil, nil
 	}
 
-	rep.Body.Close()
+	results, err := validator.ValidatePresentation(ctx, tenantId, j, enforce)
 
-	if rep.StatusCode != http.StatusOK {
-		return errors.New("signer service call error. result was: " + string(respBody)), false
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]model.SchemaResult, 0, len(results))
+	for _, r := range results {
+		ret = append(ret, model.SchemaResult{
+			Presentation: presentation,
+			Credential:   r.Credential,
+			Schema:       r.Schema,
+			Valid:        r.Valid(),
+			Errors:       r.Errors,
+		})
 	}
 
-	var resultBody map[string]interface{}
+	return ret, nil
+}
+
+// verifyLdpPresentation verifies the proofs in process. The signer is used for proofs which are not supported
+// in process, if the fallback is enabled.
+func (requestor *PresentationRequestor) verifyLdpPresentation(ctx context.Context, j map[string]interface{}, id string, tenantId string, nonce string) (error, bool) {
+	verifier := common.GetEnvironment().GetProofVerifier()
+
+	if verifier != nil {
+		err := verifier.VerifyPresentation(ctx, j, nonce)
+
+		switch {
+		case err == nil:
+			return nil, true
+		case errors.Is(err, proof.ErrInvalidProof):
+			requestor.logger.Info("presentation proof invalid", "id", id, "reason", err.Error())
+			return nil, false
+		case !requestor.config.ProofVerification.SignerFallback:
+			return err, false
+		}
+
+		requestor.logger.Debug("proof not verifiable in process, using signer", "id", id, "reason", err.Error())
+	}
 
-	err = json.Unmarshal(respBody, &resultBody)
+	return requestor.signerServiceCheckUpLdpJson(ctx, j, id, tenantId)
+}
 
+func (requestor *PresentationRequestor) signerServiceCheckUpLdpJson(ctx context.Context, j map[string]interface{}, id string, tenantId string) (error, bool) {
+	presBytes, err := json.Marshal(j)
 	if err != nil {
-		requestor.logger.Error(err, "Error during response body read")
+		requestor.logger.Error(err, "Error marshalling presentation")
 		return err, false
 	}
+	requestor.logger.Debug("Checking presentation", "id", id)
 
-	valid, ok := resultBody["valid"]
+	valid, err := GetSigner().VerifyPresentation(ctx, tenantId, presBytes)
 
-	if ok {
-		b, ok := valid.(bool)
-		if ok {
-			return nil, b
-		}
+	if err != nil {
+		requestor.logger.Error(err, "Error during signer service call")
+		return err, false
 	}
 
-	return nil, false
+	return nil, valid
 }
 
-func (requestor *PresentationRequestor) forwardPresentation(tenantId string, requestId string, groupId string, presentation []byte) {
+// storeMessage is the storage message with the extracted claims of the presentation.
+type storeMessage struct {
+	storageMessaging.StorageServiceStoreMessage
+	Claims map[string]messaging.DescriptorClaims `json:"claims,omitempty"`
+}
 
-	msg := storageMessaging.StorageServiceStoreMessage{
-		Request: commonMessageTypes.Request{
-			TenantId:  tenantId,
-			RequestId: requestId,
-			GroupId:   groupId,
+func (requestor *PresentationRequestor) forwardPresentation(tenantId string, requestId string, groupId string, presentation []byte, claims map[string]messaging.DescriptorClaims) {
+
+	msg := storeMessage{
+		StorageServiceStoreMessage: storageMessaging.StorageServiceStoreMessage{
+			Request: commonMessageTypes.Request{
+				TenantId:  tenantId,
+				RequestId: requestId,
+				GroupId:   groupId,
+			},
+			AccountId: groupId,
+			Type:      storageMessaging.StorePresentationType,
+			Payload:   presentation,
+			Id:        uuid.NewString(),
 		},
-		AccountId: groupId,
-		Type:      storageMessaging.StorePresentationType,
-		Payload:   presentation,
-		Id:        uuid.NewString(),
+		Claims: claims,
 	}
 	b, err := json.Marshal(msg)
 
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.eclipse.org/eclipse/xfsc/libraries/microservice/core/pkg/logr"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/signer"
+)
+
+// countingSigner accepts all presentations and counts the verifications per holder.
+type countingSigner struct {
+	calls map[string]int
+}
+
+func (s *countingSigner) SignPresentation(ctx context.Context, tenantId string, request signer.SignRequest) ([]byte, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s *countingSigner) VerifyPresentation(ctx context.Context, tenantId string, presentation []byte) (bool, error) {
+	var p map[string]interface{}
+	json.Unmarshal(presentation, &p)
+	holder, _ := p["holder"].(string)
+	s.calls[holder]++
+	return true, nil
+}
+
+func TestHandleProofWithTwoDescriptors(t *testing.T) {
+	logger, _ := logr.New("info", true, nil)
+	config := &model.Config{}
+	config.CredentialChecks.Validity = true
+
+	env := common.GetEnvironment()
+	env.SetLogger(*logger)
+	env.SetConfig(config)
+	s := &countingSigner{calls: map[string]int{}}
+	env.SetSigner(s)
+	defer env.SetSigner(nil)
+
+	lookup, update := LookupEntry, updateStatusWithOutcome
+	defer func() { LookupEntry, updateStatusWithOutcome = lookup, update }()
+
+	LookupEntry = func(ctx context.Context, tenantId string, id string) (*model.VerificationEntry, error) {
+		return &model.VerificationEntry{Id: id, State: string(model.PresentationRequestObjectFetched), Nonce: "nonce"}, nil
+	}
+
+	var status, outcome string
+	updateStatusWithOutcome = func(ctx context.Context, tenantId string, s string, id string, o string) error {
+		status, outcome = s, o
+		return nil
+	}
+
+	presentation := func(holder string, expiresAt time.Time) map[string]interface{} {
+		return map[string]interface{}{
+			"type":   "VerifiablePresentation",
+			"holder": holder,
+			"verifiableCredential": map[string]interface{}{
+				"expirationDate":    expiresAt.Format(time.RFC3339),
+				"credentialSubject": map[string]interface{}{"id": holder},
+			},
+		}
+	}
+
+	requestor := &PresentationRequestor{config: config, logger: *logger}
+	gin.SetMode(gin.TestMode)
+
+	post := func(vpToken interface{}, paths ...string) int {
+		descriptors := make([]map[string]interface{}, 0, len(paths))
+		for i, path := range paths {
+			descriptors = append(descriptors, map[string]interface{}{"id": "d" + string(rune('1'+i)), "format": "ldp_vp", "path": path})
+		}
+
+		token, _ := json.Marshal(vpToken)
+		submission, _ := json.Marshal(map[string]interface{}{"id": "s", "definition_id": "pd", "descriptor_map": descriptors})
+		form := url.Values{"vp_token": {string(token)}, "presentation_submission": {string(submission)}}
+
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodPost, "/tenant/presentation/proof/p1", strings.NewReader(form.Encode()))
+		c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		c.Params = gin.Params{{Key: "tenantId", Value: "tenant"}, {Key: "id", Value: "p1"}}
+
+		HandleProof(c, requestor, config)
+		return recorder.Code
+	}
+
+	vpToken := []interface{}{presentation("did:example:a", time.Now().Add(time.Hour)), presentation("did:example:b", time.Now().Add(-time.Hour))}
+
+	if code := post(vpToken, "$[0]", "$[1]"); code != http.StatusOK {
+		t.Fatal("array vp token expected to be accepted", code)
+	}
+
+	if s.calls["did:example:a"] != 1 || s.calls["did:example:b"] != 1 {
+		t.Error("each presentation must be verified once", s.calls)
+	}
+
+	if status != string(model.PresentationRejected) || !strings.Contains(outcome, "presentation 1 ") {
+		t.Error("expired credential of the second presentation must reject", status, outcome)
+	}
+
+	s.calls = map[string]int{}
+
+	if code := post(presentation("did:example:c", time.Now().Add(-time.Hour)), "$", "$"); code != http.StatusOK || s.calls["did:example:c"] != 1 {
+		t.Error("presentation of two descriptors must be verified once", code, s.calls)
+	}
+
+	s.calls = map[string]int{}
+
+	if code := post(vpToken, "$[0]", "$[2]"); code != http.StatusBadRequest || len(s.calls) != 0 {
+		t.Error("descriptors must address a presentation of the vp token", code, s.calls)
+	}
+
+	if code := post(vpToken, "$[0].verifiableCredential"); code != http.StatusBadRequest || len(s.calls) != 0 {
+		t.Error("descriptors must not address credentials", code, s.calls)
+	}
+}
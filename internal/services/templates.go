@@ -0,0 +1,265 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gitlab.eclipse.org/eclipse/xfsc/libraries/ssi/oid4vip/model/presentation"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/services/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/template"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/pkg/messaging"
+)
+
+const (
+	TemplateError         = "Template Error"
+	TemplateNotFoundError = "Template not found"
+)
+
+// MaterializeTemplate returns the checked presentation definition of a template of the tenant.
+func MaterializeTemplate(ctx context.Context, tenantId string, ref messaging.TemplateReference) (*presentation.PresentationDefinition, error) {
+	t, err := common.GetTemplate(ctx, tenantId, ref.Id, ref.Version)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return template.Materialize(t.Definition, t.Defaults, ref.Parameters)
+}
+
+// checkTemplate materializes the template with its defaults, parameters without default are null.
+func checkTemplate(t *model.PresentationTemplate) error {
+	names, err := template.Parameters(t.Definition)
+
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		values[name] = t.Defaults[name]
+	}
+
+	_, err = template.Materialize(t.Definition, nil, values)
+	return err
+}
+
+func templateErrorResponse(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, common.ErrTemplateNotFound):
+		ctx.JSON(404, ServerErrorResponse{Message: TemplateNotFoundError})
+	case errors.Is(err, common.ErrTemplateConflict):
+		ctx.JSON(409, ServerErrorResponse{Message: err.Error()})
+	case errors.Is(err, template.ErrInvalidTemplate):
+		ErrorResponse(ctx, err.Error(), err)
+	default:
+		InternalErrorResponse(ctx, TemplateError, err)
+	}
+}
+
+func bindTemplate(ctx *gin.Context) (*model.PresentationTemplate, bool) {
+	var t model.PresentationTemplate
+
+	if err := ctx.ShouldBindJSON(&t); err != nil {
+		ErrorResponse(ctx, BodyError, err)
+		return nil, false
+	}
+
+	if len(t.Definition) == 0 {
+		ErrorResponse(ctx, "Template definition missing", nil)
+		return nil, false
+	}
+
+	if err := checkTemplate(&t); err != nil {
+		templateErrorResponse(ctx, err)
+		return nil, false
+	}
+
+	return &t, true
+}
+
+// HandleCreateTemplate godoc
+// @Summary Creates a presentation definition template
+// @Description Creates version 1 of a template. The definition can contain {{name}} placeholders, which are filled by the parameters of a request or by the defaults.
+// @Tags internal
+// @Accept json
+// @Produce json
+// @Param tenantId path string true "Tenant ID"
+// @Param body body model.PresentationTemplate true "Template, the id is generated if empty"
+// @Success 201 {object} model.PresentationTemplate
+// @Failure 400 {object} ServerErrorResponse
+// @Failure 409 {object} ServerErrorResponse
+// @Failure 500 {object} ServerErrorResponse
+// @Router /internal/templates [post]
+func HandleCreateTemplate(ctx *gin.Context, config *model.Config) {
+	tenantId := ctx.Param("tenantId")
+	t, ok := bindTemplate(ctx)
+
+	if !ok {
+		return
+	}
+
+	if t.Id == "" {
+		t.Id = uuid.NewString()
+	}
+
+	_, err := common.GetTemplate(ctx.Request.Context(), tenantId, t.Id, 0)
+
+	if err == nil {
+		ctx.JSON(409, ServerErrorResponse{Message: "Template " + t.Id + " exists"})
+		return
+	}
+
+	if !errors.Is(err, common.ErrTemplateNotFound) {
+		templateErrorResponse(ctx, err)
+		return
+	}
+
+	if err = common.AddTemplateVersion(ctx.Request.Context(), tenantId, t); err != nil {
+		templateErrorResponse(ctx, err)
+		return
+	}
+
+	t.Parameters, _ = template.Parameters(t.Definition)
+	ctx.JSON(201, t)
+}
+
+// HandleUpdateTemplate godoc
+// @Summary Creates a new version of a presentation definition template
+// @Description Stores the body as next version of the template. Former versions stay available.
+// @Tags internal
+// @Accept json
+// @Produce json
+// @Param tenantId path string true "Tenant ID"
+// @Param templateId path string true "Template ID"
+// @Param body body model.PresentationTemplate true "Template"
+// @Success 200 {object} model.PresentationTemplate
+// @Failure 400 {object} ServerErrorResponse
+// @Failure 404 {object} ServerErrorResponse
+// @Failure 409 {object} ServerErrorResponse
+// @Failure 500 {object} ServerErrorResponse
+// @Router /internal/templates/{templateId} [put]
+func HandleUpdateTemplate(ctx *gin.Context, config *model.Config) {
+	tenantId := ctx.Param("tenantId")
+	t, ok := bindTemplate(ctx)
+
+	if !ok {
+		return
+	}
+
+	t.Id = ctx.Param("templateId")
+
+	if _, err := common.GetTemplate(ctx.Request.Context(), tenantId, t.Id, 0); err != nil {
+		templateErrorResponse(ctx, err)
+		return
+	}
+
+	if err := common.AddTemplateVersion(ctx.Request.Context(), tenantId, t); err != nil {
+		templateErrorResponse(ctx, err)
+		return
+	}
+
+	t.Parameters, _ = template.Parameters(t.Definition)
+	ctx.JSON(200, t)
+}
+
+// HandleGetTemplate godoc
+// @Summary Retrieves a presentation definition template
+// @Description Retrieves the latest or the given version of a template
+// @Tags internal
+// @Produce json
+// @Param tenantId path string true "Tenant ID"
+// @Param templateId path string true "Template ID"
+// @Param version query int false "Version, latest if empty"
+// @Success 200 {object} model.PresentationTemplate
+// @Failure 404 {object} ServerErrorResponse
+// @Failure 500 {object} ServerErrorResponse
+// @Router /internal/templates/{templateId} [get]
+func HandleGetTemplate(ctx *gin.Context, config *model.Config) {
+	version := 0
+
+	if v := ctx.Query("version"); v != "" {
+		var err error
+
+		if version, err = strconv.Atoi(v); err != nil || version < 1 {
+			ErrorResponse(ctx, "Invalid version", err)
+			return
+		}
+	}
+
+	t, err := common.GetTemplate(ctx.Request.Context(), ctx.Param("tenantId"), ctx.Param("templateId"), version)
+
+	if err != nil {
+		templateErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(200, t)
+}
+
+// HandleListTemplateVersions godoc
+// @Summary Lists the versions of a presentation definition template
+// @Description Lists all versions of a template, the latest first
+// @Tags internal
+// @Produce json
+// @Param tenantId path string true "Tenant ID"
+// @Param templateId path string true "Template ID"
+// @Success 200 {array} model.PresentationTemplate
+// @Failure 404 {object} ServerErrorResponse
+// @Failure 500 {object} ServerErrorResponse
+// @Router /internal/templates/{templateId}/versions [get]
+func HandleListTemplateVersions(ctx *gin.Context, config *model.Config) {
+	templates, err := common.GetTemplateVersions(ctx.Request.Context(), ctx.Param("tenantId"), ctx.Param("templateId"))
+
+	if err == nil && len(templates) == 0 {
+		err = common.ErrTemplateNotFound
+	}
+
+	if err != nil {
+		templateErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(200, templates)
+}
+
+// HandleListTemplates godoc
+// @Summary Lists the presentation definition templates
+// @Description Lists the latest version of all templates of the tenant
+// @Tags internal
+// @Produce json
+// @Param tenantId path string true "Tenant ID"
+// @Success 200 {array} model.PresentationTemplate
+// @Failure 500 {object} ServerErrorResponse
+// @Router /internal/templates [get]
+func HandleListTemplates(ctx *gin.Context, config *model.Config) {
+	templates, err := common.ListTemplates(ctx.Request.Context(), ctx.Param("tenantId"))
+
+	if err != nil {
+		templateErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(200, templates)
+}
+
+// HandleDeleteTemplate godoc
+// @Summary Deletes a presentation definition template
+// @Description Deletes all versions of a template. Presentation requests created from it are not affected.
+// @Tags internal
+// @Param tenantId path string true "Tenant ID"
+// @Param templateId path string true "Template ID"
+// @Success 200
+// @Failure 500 {object} ServerErrorResponse
+// @Router /internal/templates/{templateId} [delete]
+func HandleDeleteTemplate(ctx *gin.Context, config *model.Config) {
+	if err := common.DeleteTemplate(ctx.Request.Context(), ctx.Param("tenantId"), ctx.Param("templateId")); err != nil {
+		templateErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.AbortWithStatus(200)
+}
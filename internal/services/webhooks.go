@@ -0,0 +1,391 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	commonTypes "github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/httpclient"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/kms"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/services/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/pkg/messaging"
+)
+
+const (
+	WebhookSignatureHmac = "hmac"
+	WebhookSignatureJws  = "jws"
+
+	WebhookIdHeader        = "X-Webhook-Id"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+
+	WebhookDeliveryNotFoundError = "Webhook delivery not found"
+)
+
+// ErrWebhookRejected marks callbacks which the receiver rejected, they are not retried.
+var ErrWebhookRejected = errors.New("webhook rejected the callback")
+
+// updateWebhookDelivery logs the result of an attempt, replaced by tests of the delivery.
+var updateWebhookDelivery = common.UpdateWebhookDelivery
+
+// CheckWebhookUrl accepts the webhook url of a request only if the tenant allows urls of requests.
+func CheckWebhookUrl(config *model.Config, tenantId string, webhookUrl string) error {
+	if webhookUrl == "" {
+		return nil
+	}
+
+	if hook, ok := config.Webhooks.Tenants[tenantId]; !config.Webhooks.Enabled || !ok || !hook.AllowRequestUrls {
+		return errors.New("webhook urls of requests are not allowed for the tenant")
+	}
+
+	u, err := url.Parse(webhookUrl)
+
+	if err != nil {
+		return err
+	}
+
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("invalid webhook url %s", webhookUrl)
+	}
+
+	return nil
+}
+
+// webhookTarget returns the webhook of the tenant, with the url of the request if one was accepted.
+func webhookTarget(config *model.Config, tenantId string, requestUrl string) (model.Webhook, bool) {
+	hook, ok := config.Webhooks.Tenants[tenantId]
+
+	if !ok {
+		return hook, false
+	}
+
+	if requestUrl != "" && hook.AllowRequestUrls {
+		hook.Url = requestUrl
+	}
+
+	return hook, hook.Url != ""
+}
+
+func webhookEvents(config *model.Config, hook model.Webhook) []string {
+	if len(hook.Events) > 0 {
+		return hook.Events
+	}
+	return config.Webhooks.Events
+}
+
+// signWebhook returns the signature header of the body. Hmac signs the timestamp and the body as
+// "t=<timestamp>,v1=<hex hmac-sha256 of timestamp.body>", jws is a compact JWS of the body with detached payload.
+func signWebhook(ctx context.Context, tenantId string, hook model.Webhook, body []byte, timestamp int64) (string, error) {
+	switch hook.Signature {
+	case WebhookSignatureHmac, "":
+		if hook.Secret == "" {
+			return "", errors.New("webhook secret missing")
+		}
+
+		mac := hmac.New(sha256.New, []byte(hook.Secret))
+		mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+		mac.Write(body)
+
+		return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil))), nil
+	case WebhookSignatureJws:
+		backend := commonTypes.GetEnvironment().GetSigningBackends().ForTenant(tenantId)
+
+		if backend == nil {
+			return "", errors.New("no signing backend for the webhook of the tenant")
+		}
+
+		token, err := kms.SignJwt(ctx, backend, hook.Key, hook.Key, "JOSE", body)
+
+		if err != nil {
+			return "", err
+		}
+
+		parts := strings.Split(string(token), ".")
+		return parts[0] + ".." + parts[2], nil
+	}
+
+	return "", fmt.Errorf("unsupported webhook signature %s", hook.Signature)
+}
+
+// postWebhook posts the payload of the delivery, signed at the time of the attempt.
+func postWebhook(ctx context.Context, tenantId string, hook model.Webhook, d *model.WebhookDelivery) (int, error) {
+	signature, err := signWebhook(ctx, tenantId, hook, d.Payload, time.Now().Unix())
+
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(httpclient.WithTenant(ctx, tenantId), http.MethodPost, d.Url, bytes.NewReader(d.Payload))
+
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrWebhookRejected, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIdHeader, d.Id)
+	req.Header.Set(WebhookEventHeader, d.EventType)
+	req.Header.Set(WebhookSignatureHeader, signature)
+
+	rep, err := GetHttpClient(httpclient.Webhook).Do(req)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer rep.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(rep.Body, 4096))
+
+	if rep.StatusCode < 200 || rep.StatusCode >= 300 {
+		err = fmt.Errorf("webhook %s responded %d", d.Url, rep.StatusCode)
+		// client errors are not retried, except timeouts and rate limits
+		if rep.StatusCode >= 400 && rep.StatusCode < 500 && rep.StatusCode != http.StatusRequestTimeout && rep.StatusCode != http.StatusTooManyRequests {
+			err = fmt.Errorf("%w: %w", ErrWebhookRejected, err)
+		}
+	}
+
+	return rep.StatusCode, err
+}
+
+// deliverWebhook tries a delivery and logs the result. It is posted to the url stored with the delivery and
+// signed with the settings of the tenant. Failed deliveries are rescheduled with backoff until the failure is
+// permanent or the attempts are exhausted.
+func deliverWebhook(ctx context.Context, config *model.Config, tenantId string, d *model.WebhookDelivery) error {
+	var code int
+	hook, ok := config.Webhooks.Tenants[tenantId]
+	ok = ok && d.Url != ""
+	err := errors.New("webhook of the tenant not configured")
+
+	if ok {
+		code, err = postWebhook(ctx, tenantId, hook, d)
+	}
+
+	d.Attempts++
+	d.LastStatusCode = code
+
+	if err == nil {
+		d.Status = model.WebhookDelivered
+		d.DeliveredAt = time.Now()
+		d.LastError = ""
+	} else {
+		d.LastError = err.Error()
+
+		if !ok || errors.Is(err, ErrWebhookRejected) || errors.Is(err, httpclient.ErrEgressDenied) || d.Attempts >= config.Webhooks.MaxAttempts {
+			d.Status = model.WebhookFailed
+		} else {
+			d.NextAttempt = time.Now().Add(deliveryBackoff(d.Attempts-1, time.Duration(config.Webhooks.InitialBackoffSec)*time.Second, time.Duration(config.Webhooks.MaxBackoffSec)*time.Second))
+		}
+	}
+
+	if uerr := updateWebhookDelivery(ctx, tenantId, d); uerr != nil {
+		return errors.Join(err, uerr)
+	}
+
+	return err
+}
+
+// addWebhookDelivery logs the delivery and tries it in the background. The returned copy is not changed by the attempt.
+func addWebhookDelivery(ctx context.Context, config *model.Config, tenantId string, d *model.WebhookDelivery) (model.WebhookDelivery, error) {
+	err := common.AddWebhookDelivery(ctx, tenantId, d, time.Duration(config.Webhooks.LeaseSec)*time.Second)
+
+	if err != nil {
+		return *d, err
+	}
+
+	logged := *d
+
+	go func() {
+		if err := deliverWebhook(context.Background(), config, tenantId, d); err != nil {
+			commonTypes.GetEnvironment().GetLogger().Error(err, "webhook delivery failed", "id", d.PresentationId, "delivery", d.Id, "attempts", d.Attempts)
+		}
+	}()
+
+	return logged, nil
+}
+
+// enqueueWebhook creates the webhook callback of a state transition, if the tenant subscribed to it.
+func (requestor *PresentationRequestor) enqueueWebhook(tenantId string, row *model.VerificationEntry, entry model.AuditEntry) {
+	hook, ok := requestor.config.Webhooks.Tenants[tenantId]
+
+	if !ok || !slices.Contains(webhookEvents(requestor.config, hook), entry.State) {
+		return
+	}
+
+	eventType, ok := messaging.StatusEventTypes[entry.State]
+
+	if !ok {
+		return
+	}
+
+	if hook, ok = webhookTarget(requestor.config, tenantId, row.WebhookUrl); !ok {
+		return
+	}
+
+	b, err := json.Marshal(messaging.WebhookEvent{
+		Type:        eventType,
+		StatusEvent: statusEvent(tenantId, row, entry),
+		Claims:      row.Claims,
+	})
+
+	if err != nil {
+		requestor.logger.Error(err, "error in json marshalling", err)
+		return
+	}
+
+	_, err = addWebhookDelivery(context.Background(), requestor.config, tenantId, &model.WebhookDelivery{
+		PresentationId: row.Id,
+		EventType:      eventType,
+		Url:            hook.Url,
+		Payload:        b,
+	})
+
+	if err != nil {
+		requestor.logger.Error(err, "error during webhook creation", "id", row.Id)
+	}
+}
+
+// ReplayWebhook logs a new delivery with the payload and url of a logged one and tries it.
+func ReplayWebhook(ctx context.Context, config *model.Config, tenantId string, id string, deliveryId string) (model.WebhookDelivery, error) {
+	original, err := common.GetWebhookDelivery(ctx, tenantId, id, deliveryId)
+
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+
+	return addWebhookDelivery(ctx, config, tenantId, &model.WebhookDelivery{
+		PresentationId: id,
+		EventType:      original.EventType,
+		Url:            original.Url,
+		Payload:        original.Payload,
+		ReplayOf:       original.Id,
+	})
+}
+
+// RunWebhookWorker retries the due webhook deliveries of all tenants until the context ends. Deliveries are
+// claimed with a lease, so that several instances can run the worker.
+func RunWebhookWorker(ctx context.Context, config *model.Config) {
+	ticker := time.NewTicker(time.Duration(config.Webhooks.PollIntervalSec) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			processWebhooks(ctx, config)
+		}
+	}
+}
+
+func processWebhooks(ctx context.Context, config *model.Config) {
+	logger := commonTypes.GetEnvironment().GetLogger()
+	lease := time.Duration(config.Webhooks.LeaseSec) * time.Second
+
+	tenants, err := common.WebhookTenants(ctx)
+
+	if err != nil {
+		logger.Error(err, "Error during webhook tenant read.")
+		return
+	}
+
+	for _, tenantId := range tenants {
+		for bucket := 0; bucket < common.PartitionBuckets; bucket++ {
+			processWebhookBucket(ctx, config, tenantId, bucket, lease)
+		}
+	}
+}
+
+func processWebhookBucket(ctx context.Context, config *model.Config, tenantId string, bucket int, lease time.Duration) {
+	logger := commonTypes.GetEnvironment().GetLogger()
+
+	deliveries, err := common.GetWebhookBucket(ctx, tenantId, bucket)
+
+	if err != nil {
+		logger.Error(err, "Error during webhook delivery read.", "tenantId", tenantId, "bucket", bucket)
+		return
+	}
+
+	for i := range deliveries {
+		d := &deliveries[i]
+
+		if d.Status != model.WebhookPending || d.NextAttempt.After(time.Now()) {
+			continue
+		}
+
+		claimed, err := common.ClaimWebhookDelivery(ctx, tenantId, d, lease)
+
+		if err != nil {
+			logger.Error(err, "Error during webhook claim.", "delivery", d.Id)
+			continue
+		}
+
+		if claimed {
+			if err = deliverWebhook(ctx, config, tenantId, d); err != nil {
+				logger.Error(err, "Error during webhook delivery.", "id", d.PresentationId, "delivery", d.Id)
+			}
+		}
+	}
+}
+
+// HandleListWebhookDeliveries godoc
+// @Summary Lists the webhook deliveries of a proof request
+// @Description Lists the delivery log of the webhook callbacks of a proof request with attempts and last error
+// @Tags internal
+// @Produce json
+// @Param tenantId path string true "Tenant ID"
+// @Param id path string true "Proof ID"
+// @Success 200 {array} model.WebhookDelivery
+// @Failure 400 {object} ServerErrorResponse
+// @Router /internal/proofs/proof/{id}/webhooks [get]
+func HandleListWebhookDeliveries(ctx *gin.Context, config *model.Config) {
+	deliveries, err := common.GetWebhookDeliveries(ctx.Request.Context(), ctx.Param("tenantId"), ctx.Param("id"))
+
+	if err != nil {
+		ErrorResponse(ctx, RecordNotFoundError, err)
+		return
+	}
+
+	ctx.JSON(200, deliveries)
+}
+
+// HandleReplayWebhook godoc
+// @Summary Replays a webhook delivery
+// @Description Sends the callback of a logged delivery again as new delivery, which is retried like the original
+// @Tags internal
+// @Produce json
+// @Param tenantId path string true "Tenant ID"
+// @Param id path string true "Proof ID"
+// @Param deliveryId path string true "Delivery ID"
+// @Success 202 {object} model.WebhookDelivery
+// @Failure 404 {object} ServerErrorResponse
+// @Failure 500 {object} ServerErrorResponse
+// @Router /internal/proofs/proof/{id}/webhooks/{deliveryId}/replay [post]
+func HandleReplayWebhook(ctx *gin.Context, config *model.Config) {
+	d, err := ReplayWebhook(ctx.Request.Context(), config, ctx.Param("tenantId"), ctx.Param("id"), ctx.Param("deliveryId"))
+
+	if errors.Is(err, common.ErrWebhookDeliveryNotFound) {
+		ctx.JSON(404, ServerErrorResponse{Message: WebhookDeliveryNotFoundError})
+		return
+	}
+
+	if err != nil {
+		InternalErrorResponse(ctx, "Error during webhook replay", err)
+		return
+	}
+
+	ctx.JSON(202, d)
+}
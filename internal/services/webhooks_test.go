@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/kms"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+)
+
+func webhookConfig() *model.Config {
+	config := &model.Config{}
+	config.Webhooks.Enabled = true
+	config.Webhooks.Events = []string{"presentation-received"}
+	config.Webhooks.Tenants = map[string]model.Webhook{
+		"open":   {Url: "https://rp.example.com/hook", Secret: "secret", AllowRequestUrls: true, Events: []string{"expired"}},
+		"closed": {Url: "https://rp.example.com/hook", Secret: "secret"},
+	}
+	return config
+}
+
+func TestWebhookTarget(t *testing.T) {
+	config := webhookConfig()
+
+	if err := CheckWebhookUrl(config, "open", "https://other.example.com/hook"); err != nil {
+		t.Error(err)
+	}
+
+	for tenantId, webhookUrl := range map[string]string{"closed": "https://other.example.com/hook", "unknown": "https://other.example.com/hook", "open": "ftp://other.example.com"} {
+		if err := CheckWebhookUrl(config, tenantId, webhookUrl); err == nil {
+			t.Error("url must be rejected", tenantId, webhookUrl)
+		}
+	}
+
+	if hook, ok := webhookTarget(config, "open", "https://other.example.com/hook"); !ok || hook.Url != "https://other.example.com/hook" {
+		t.Error("url of the request must be used", hook)
+	}
+
+	if hook, ok := webhookTarget(config, "closed", "https://other.example.com/hook"); !ok || hook.Url != "https://rp.example.com/hook" {
+		t.Error("url of the tenant must be kept", hook)
+	}
+
+	if _, ok := webhookTarget(config, "unknown", ""); ok {
+		t.Error("tenants without webhook have no target")
+	}
+
+	if events := webhookEvents(config, config.Webhooks.Tenants["closed"]); len(events) != 1 || events[0] != "presentation-received" {
+		t.Error("global events expected", events)
+	}
+
+	if events := webhookEvents(config, config.Webhooks.Tenants["open"]); len(events) != 1 || events[0] != "expired" {
+		t.Error("events of the tenant expected", events)
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"type":"verifier.presentation.received.v1"}`)
+
+	signature, err := signWebhook(context.Background(), "tenant", model.Webhook{Secret: "secret"}, body, 1700000000)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1700000000."))
+	mac.Write(body)
+
+	if err != nil || signature != "t=1700000000,v1="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Error(signature, err)
+	}
+
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	common.GetEnvironment().SetSigningBackends(kms.NewBackends(nil, map[string]kms.Backend{
+		"tenant": kms.NewLocalBackend(map[string]crypto.Signer{"hook": private}, "hook"),
+	}))
+	defer common.GetEnvironment().SetSigningBackends(nil)
+
+	signature, err = signWebhook(context.Background(), "tenant", model.Webhook{Signature: WebhookSignatureJws, Key: "hook"}, body, 1700000000)
+	parts := strings.Split(signature, ".")
+
+	if err != nil || len(parts) != 3 || parts[1] != "" {
+		t.Fatal("detached jws expected", signature, err)
+	}
+
+	s, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	if !ed25519.Verify(public, []byte(parts[0]+"."+base64.RawURLEncoding.EncodeToString(body)), s) {
+		t.Error("signature must cover the body")
+	}
+
+	if _, err = signWebhook(context.Background(), "other", model.Webhook{Signature: WebhookSignatureJws}, body, 0); err == nil {
+		t.Error("tenants without backend can not sign")
+	}
+
+	if _, err = signWebhook(context.Background(), "tenant", model.Webhook{}, body, 0); err == nil {
+		t.Error("hmac needs a secret")
+	}
+}
+
+func TestPostWebhookErrors(t *testing.T) {
+	var status int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(WebhookSignatureHeader) == "" || r.Header.Get(WebhookIdHeader) != "1" {
+			t.Error("headers not set")
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	d := &model.WebhookDelivery{Id: "1", EventType: "verifier.presentation.received.v1", Url: server.URL, Payload: []byte("{}")}
+
+	for code, permanent := range map[int]bool{
+		http.StatusBadRequest:          true,
+		http.StatusGone:                true,
+		http.StatusTooManyRequests:     false,
+		http.StatusServiceUnavailable:  false,
+		http.StatusInternalServerError: false,
+	} {
+		status = code
+		got, err := postWebhook(context.Background(), "tenant", model.Webhook{Secret: "secret"}, d)
+
+		if err == nil || got != code || errors.Is(err, ErrWebhookRejected) != permanent {
+			t.Error(code, err)
+		}
+	}
+
+	status = http.StatusNoContent
+	if _, err := postWebhook(context.Background(), "tenant", model.Webhook{Secret: "secret"}, d); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeliverWebhookToRequestUrl(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/request" || !strings.HasPrefix(r.Header.Get(WebhookSignatureHeader), "t=") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	update := updateWebhookDelivery
+	defer func() { updateWebhookDelivery = update }()
+
+	var logged model.WebhookDelivery
+	updateWebhookDelivery = func(ctx context.Context, tenantId string, d *model.WebhookDelivery) error {
+		logged = *d
+		return nil
+	}
+
+	// the tenant has no url of its own, only urls of requests are called
+	config := webhookConfig()
+	config.Webhooks.MaxAttempts = 3
+	config.Webhooks.Tenants["requests"] = model.Webhook{Secret: "secret", AllowRequestUrls: true}
+
+	d := &model.WebhookDelivery{Id: "1", EventType: "verifier.presentation.received.v1", Url: server.URL + "/request", Payload: []byte("{}")}
+
+	if err := deliverWebhook(context.Background(), config, "requests", d); err != nil || logged.Status != model.WebhookDelivered || logged.Attempts != 1 {
+		t.Error("delivery to the url of the request expected", logged, err)
+	}
+
+	d = &model.WebhookDelivery{Id: "2", EventType: "verifier.presentation.received.v1", Url: server.URL + "/request", Payload: []byte("{}")}
+
+	if err := deliverWebhook(context.Background(), config, "unknown", d); err == nil || logged.Status != model.WebhookFailed {
+		t.Error("deliveries of tenants without webhook must fail", logged)
+	}
+}
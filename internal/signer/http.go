@@ -0,0 +1,96 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// HttpSigner calls the presentation endpoints of the signer service.
+type HttpSigner struct {
+	signUrl   string
+	verifyUrl string
+	client    *http.Client
+}
+
+func NewHttpSigner(signUrl string, verifyUrl string, client *http.Client) *HttpSigner {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &HttpSigner{signUrl: signUrl, verifyUrl: verifyUrl, client: client}
+}
+
+func (signer *HttpSigner) SignPresentation(ctx context.Context, tenantId string, request SignRequest) ([]byte, error) {
+	body, err := json.Marshal(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return signer.post(ctx, signer.signUrl, body)
+}
+
+func (signer *HttpSigner) VerifyPresentation(ctx context.Context, tenantId string, presentation []byte) (bool, error) {
+	body, err := json.Marshal(map[string][]byte{"presentation": presentation})
+
+	if err != nil {
+		return false, err
+	}
+
+	res, err := signer.post(ctx, signer.verifyUrl, body)
+
+	if err != nil {
+		return false, err
+	}
+
+	var result struct {
+		Valid bool `json:"valid"`
+	}
+
+	err = json.Unmarshal(res, &result)
+
+	if err != nil {
+		return false, err
+	}
+
+	return result.Valid, nil
+}
+
+func (signer *HttpSigner) post(ctx context.Context, url string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rep, err := signer.client.Do(req)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	defer rep.Body.Close()
+
+	respBody, err := io.ReadAll(rep.Body)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	if rep.StatusCode != http.StatusOK {
+		err = errors.New("signer service call error. result was: " + string(respBody))
+		if rep.StatusCode >= 500 || rep.StatusCode == http.StatusTooManyRequests {
+			err = fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		return nil, err
+	}
+
+	return respBody, nil
+}
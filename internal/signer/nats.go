@@ -0,0 +1,103 @@
+package signer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/google/uuid"
+	"gitlab.eclipse.org/eclipse/xfsc/libraries/messaging/cloudeventprovider"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/pkg/messaging"
+	commonMessageTypes "gitlab.eclipse.org/eclipse/xfsc/organisational-credential-manager-w-stack/libraries/messaging/common"
+)
+
+// Requester sends a request event and waits for the reply, like a cloud event client of type Req.
+type Requester interface {
+	RequestCtx(ctx context.Context, e event.Event) (*event.Event, error)
+}
+
+// NatsSigner calls the signer with request/reply events, so that the signer needs no http endpoint.
+type NatsSigner struct {
+	requester Requester
+	source    string
+}
+
+func NewNatsSigner(requester Requester, source string) *NatsSigner {
+	return &NatsSigner{requester: requester, source: source}
+}
+
+func (signer *NatsSigner) SignPresentation(ctx context.Context, tenantId string, request SignRequest) ([]byte, error) {
+	var reply messaging.SignPresentationReply
+
+	err := signer.request(ctx, messaging.SignPresentationType, messaging.SignPresentationRequest{
+		Request:      commonMessageTypes.Request{TenantId: tenantId, RequestId: uuid.NewString()},
+		Namespace:    request.Namespace,
+		Group:        request.Group,
+		Key:          request.Key,
+		Issuer:       request.Issuer,
+		Presentation: request.Presentation,
+	}, &reply, &reply.Reply)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return reply.Presentation, nil
+}
+
+func (signer *NatsSigner) VerifyPresentation(ctx context.Context, tenantId string, presentation []byte) (bool, error) {
+	var reply messaging.VerifyPresentationReply
+
+	err := signer.request(ctx, messaging.VerifyPresentationType, messaging.VerifyPresentationRequest{
+		Request:      commonMessageTypes.Request{TenantId: tenantId, RequestId: uuid.NewString()},
+		Presentation: presentation,
+	}, &reply, &reply.Reply)
+
+	if err != nil {
+		return false, err
+	}
+
+	return reply.Valid, nil
+}
+
+func (signer *NatsSigner) request(ctx context.Context, eventType string, request interface{}, reply interface{}, base *commonMessageTypes.Reply) error {
+	b, err := json.Marshal(request)
+
+	if err != nil {
+		return err
+	}
+
+	e, err := cloudeventprovider.NewEvent(signer.source, eventType, b)
+
+	if err != nil {
+		return err
+	}
+
+	res, err := signer.requester.RequestCtx(ctx, e)
+
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	if res == nil {
+		return fmt.Errorf("%w: no reply", ErrUnavailable)
+	}
+
+	err = json.Unmarshal(res.DataEncoded, reply)
+
+	if err != nil {
+		return err
+	}
+
+	if base.Error != nil {
+		err = errors.New("signer service call error. result was: " + base.Error.Msg)
+		if base.Error.Status >= 500 {
+			err = fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		return err
+	}
+
+	return nil
+}
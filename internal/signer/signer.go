@@ -0,0 +1,94 @@
+package signer
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrUnavailable marks failures which can be retried, like timeouts, connection errors and server errors.
+var ErrUnavailable = errors.New("signer unavailable")
+
+// SignRequest is a presentation which is signed with the key of the holder. The json form is the body of the
+// signer's presentation proof endpoint.
+type SignRequest struct {
+	Namespace    string                 `json:"namespace"`
+	Group        string                 `json:"group"`
+	Key          string                 `json:"key"`
+	Issuer       string                 `json:"issuer"`
+	Presentation map[string]interface{} `json:"presentation"`
+}
+
+// Signer signs and verifies presentations at the signer service.
+type Signer interface {
+	SignPresentation(ctx context.Context, tenantId string, request SignRequest) ([]byte, error)
+	VerifyPresentation(ctx context.Context, tenantId string, presentation []byte) (bool, error)
+}
+
+type retrying struct {
+	signer  Signer
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+}
+
+// WithRetry limits each call of the signer to the timeout and retries unavailable signers up to retries times.
+// The wait between the attempts doubles, starting with backoff.
+func WithRetry(signer Signer, timeout time.Duration, retries int, backoff time.Duration) Signer {
+	return &retrying{signer: signer, timeout: timeout, retries: retries, backoff: backoff}
+}
+
+func (r *retrying) do(ctx context.Context, call func(ctx context.Context) error) error {
+	wait := r.backoff
+	var err error
+
+	for attempt := 0; ; attempt++ {
+		err = r.attempt(ctx, call)
+
+		if err == nil || !errors.Is(err, ErrUnavailable) || attempt >= r.retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(wait):
+		}
+
+		wait *= 2
+	}
+}
+
+func (r *retrying) attempt(ctx context.Context, call func(ctx context.Context) error) error {
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	return call(ctx)
+}
+
+func (r *retrying) SignPresentation(ctx context.Context, tenantId string, request SignRequest) ([]byte, error) {
+	var res []byte
+
+	err := r.do(ctx, func(ctx context.Context) error {
+		var err error
+		res, err = r.signer.SignPresentation(ctx, tenantId, request)
+		return err
+	})
+
+	return res, err
+}
+
+func (r *retrying) VerifyPresentation(ctx context.Context, tenantId string, presentation []byte) (bool, error) {
+	var valid bool
+
+	err := r.do(ctx, func(ctx context.Context) error {
+		var err error
+		valid, err = r.signer.VerifyPresentation(ctx, tenantId, presentation)
+		return err
+	})
+
+	return valid, err
+}
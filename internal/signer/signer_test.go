@@ -0,0 +1,107 @@
+package signer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/pkg/messaging"
+	commonMessageTypes "gitlab.eclipse.org/eclipse/xfsc/organisational-credential-manager-w-stack/libraries/messaging/common"
+)
+
+func Test_HttpSigner(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/sign":
+			var request SignRequest
+			json.NewDecoder(r.Body).Decode(&request)
+			if calls == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"signed":"` + request.Key + `"}`))
+		case "/verify":
+			var request map[string][]byte
+			json.NewDecoder(r.Body).Decode(&request)
+			w.Write([]byte(`{"valid":` + string(request["presentation"]) + `}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	signer := WithRetry(NewHttpSigner(server.URL+"/sign", server.URL+"/verify", nil), time.Second, 2, time.Millisecond)
+
+	res, err := signer.SignPresentation(context.Background(), "t1", SignRequest{Key: "key1"})
+
+	if err != nil || string(res) != `{"signed":"key1"}` || calls != 2 {
+		t.Error("unavailable signer must be retried", err, calls)
+	}
+
+	valid, err := signer.VerifyPresentation(context.Background(), "t1", []byte("true"))
+
+	if err != nil || !valid {
+		t.Error(err)
+	}
+
+	calls = 0
+	_, err = WithRetry(NewHttpSigner(server.URL+"/other", "", nil), time.Second, 2, time.Millisecond).SignPresentation(context.Background(), "t1", SignRequest{})
+
+	if err == nil || errors.Is(err, ErrUnavailable) || calls != 1 {
+		t.Error("client errors must not be retried", err, calls)
+	}
+}
+
+type requester func(ctx context.Context, e event.Event) (*event.Event, error)
+
+func (r requester) RequestCtx(ctx context.Context, e event.Event) (*event.Event, error) {
+	return r(ctx, e)
+}
+
+func reply(v interface{}) *event.Event {
+	e := event.New()
+	b, _ := json.Marshal(v)
+	e.SetData(event.ApplicationJSON, b)
+	return &e
+}
+
+func Test_NatsSigner(t *testing.T) {
+	attempts := 0
+	signer := WithRetry(NewNatsSigner(requester(func(ctx context.Context, e event.Event) (*event.Event, error) {
+		attempts++
+		switch e.Type() {
+		case messaging.SignPresentationType:
+			var request messaging.SignPresentationRequest
+			json.Unmarshal(e.Data(), &request)
+			if request.TenantId != "t1" || request.Key != "key1" {
+				t.Error("request incomplete", request)
+			}
+			return reply(messaging.SignPresentationReply{Presentation: json.RawMessage(`{"proof":{}}`)}), nil
+		case messaging.VerifyPresentationType:
+			if attempts == 2 {
+				return nil, context.DeadlineExceeded
+			}
+			return reply(messaging.VerifyPresentationReply{Valid: true}), nil
+		}
+		return reply(messaging.VerifyPresentationReply{Reply: commonMessageTypes.Reply{Error: &commonMessageTypes.Error{Status: 400, Msg: "unknown"}}}), nil
+	}), "test"), time.Second, 1, time.Millisecond)
+
+	res, err := signer.SignPresentation(context.Background(), "t1", SignRequest{Key: "key1"})
+
+	if err != nil || string(res) != `{"proof":{}}` {
+		t.Error(err)
+	}
+
+	valid, err := signer.VerifyPresentation(context.Background(), "t1", []byte(`{}`))
+
+	if err != nil || !valid || attempts != 3 {
+		t.Error("timeouts must be retried", err, attempts)
+	}
+}
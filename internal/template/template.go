@@ -0,0 +1,144 @@
+package template
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"gitlab.eclipse.org/eclipse/xfsc/libraries/ssi/oid4vip/model/presentation"
+)
+
+// ErrInvalidTemplate is returned for templates which are no json, and for missing or unknown parameters.
+var ErrInvalidTemplate = errors.New("invalid presentation template")
+
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+func invalid(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: "+format, append([]interface{}{ErrInvalidTemplate}, a...)...)
+}
+
+// Parameters returns the sorted names of the {{name}} placeholders of a definition.
+func Parameters(definition json.RawMessage) ([]string, error) {
+	var document interface{}
+
+	if err := json.Unmarshal(definition, &document); err != nil {
+		return nil, invalid("%s", err)
+	}
+
+	names := make(map[string]bool)
+	collect(document, names)
+
+	ret := make([]string, 0, len(names))
+	for name := range names {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+
+	return ret, nil
+}
+
+func collect(value interface{}, names map[string]bool) {
+	switch v := value.(type) {
+	case string:
+		for _, match := range placeholder.FindAllStringSubmatch(v, -1) {
+			names[match[1]] = true
+		}
+	case []interface{}:
+		for _, e := range v {
+			collect(e, names)
+		}
+	case map[string]interface{}:
+		for _, e := range v {
+			collect(e, names)
+		}
+	}
+}
+
+// Materialize replaces the placeholders of the definition by the parameters, or by the defaults of the template,
+// and checks the resulting presentation definition. A string which is only a placeholder is replaced by the
+// value with its json type, placeholders within strings are replaced by the text of the value.
+func Materialize(definition json.RawMessage, defaults map[string]interface{}, parameters map[string]interface{}) (*presentation.PresentationDefinition, error) {
+	names, err := Parameters(definition)
+
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{}, len(names))
+
+	for _, name := range names {
+		value, ok := parameters[name]
+
+		if !ok {
+			value, ok = defaults[name]
+		}
+
+		if !ok {
+			return nil, invalid("parameter %s missing", name)
+		}
+
+		values[name] = value
+	}
+
+	for name := range parameters {
+		if _, ok := values[name]; !ok {
+			return nil, invalid("parameter %s is not part of the template", name)
+		}
+	}
+
+	var document interface{}
+	json.Unmarshal(definition, &document)
+
+	b, err := json.Marshal(substitute(document, values))
+
+	if err != nil {
+		return nil, invalid("%s", err)
+	}
+
+	var materialized presentation.PresentationDefinition
+
+	if err = json.Unmarshal(b, &materialized); err != nil {
+		return nil, invalid("%s", err)
+	}
+
+	if err = materialized.CheckPresentationDefinition(); err != nil {
+		return nil, invalid("%s", err)
+	}
+
+	return &materialized, nil
+}
+
+func substitute(value interface{}, values map[string]interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if match := placeholder.FindStringSubmatch(v); match != nil && match[0] == v {
+			return values[match[1]]
+		}
+
+		return placeholder.ReplaceAllStringFunc(v, func(s string) string {
+			value := values[placeholder.FindStringSubmatch(s)[1]]
+
+			if text, ok := value.(string); ok {
+				return text
+			}
+
+			b, _ := json.Marshal(value)
+			return string(b)
+		})
+	case []interface{}:
+		ret := make([]interface{}, len(v))
+		for i, e := range v {
+			ret[i] = substitute(e, values)
+		}
+		return ret
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			ret[k] = substitute(e, values)
+		}
+		return ret
+	}
+	return value
+}
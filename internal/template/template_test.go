@@ -0,0 +1,68 @@
+package template
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+const definition = `{
+	"id": "{{ id }}",
+	"purpose": "Proof of {{type}} for {{purpose}}",
+	"input_descriptors": [{
+		"id": "license",
+		"constraints": {
+			"limit_disclosure": "{{disclosure}}",
+			"fields": [{"path": ["$.type"], "filter": {"type": "string", "const": "{{type}}"}}]
+		}
+	}]
+}`
+
+func Test_Parameters(t *testing.T) {
+	names, err := Parameters(json.RawMessage(definition))
+
+	if err != nil || len(names) != 4 || names[0] != "disclosure" || names[1] != "id" || names[2] != "purpose" || names[3] != "type" {
+		t.Error(names, err)
+	}
+
+	if _, err = Parameters(json.RawMessage(`{"id": `)); !errors.Is(err, ErrInvalidTemplate) {
+		t.Error(err)
+	}
+}
+
+func Test_Materialize(t *testing.T) {
+	defaults := map[string]interface{}{"purpose": "onboarding", "disclosure": "required"}
+
+	materialized, err := Materialize(json.RawMessage(definition), defaults, map[string]interface{}{"id": "pd-1", "type": "DriverLicense"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := json.Marshal(materialized)
+	var document map[string]interface{}
+	json.Unmarshal(b, &document)
+
+	if document["id"] != "pd-1" || document["purpose"] != "Proof of DriverLicense for onboarding" {
+		t.Error("placeholders must be replaced", string(b))
+	}
+
+	if _, err = Materialize(json.RawMessage(definition), defaults, map[string]interface{}{"id": "pd-1"}); !errors.Is(err, ErrInvalidTemplate) {
+		t.Error("missing parameters must fail", err)
+	}
+
+	if _, err = Materialize(json.RawMessage(definition), defaults, map[string]interface{}{"id": "pd-1", "type": "A", "tpye": "B"}); !errors.Is(err, ErrInvalidTemplate) {
+		t.Error("unknown parameters must fail", err)
+	}
+}
+
+func Test_Substitute(t *testing.T) {
+	values := map[string]interface{}{"n": float64(2), "list": []interface{}{"a", "b"}, "s": "x"}
+	document := map[string]interface{}{"n": "{{n}}", "list": "{{list}}", "text": "{{s}}-{{n}}", "keep": "{{", "nested": []interface{}{"{{s}}"}}
+
+	result := substitute(document, values).(map[string]interface{})
+
+	if result["n"] != float64(2) || len(result["list"].([]interface{})) != 2 || result["text"] != "x-2" || result["keep"] != "{{" || result["nested"].([]interface{})[0] != "x" {
+		t.Error("unexpected substitution", result)
+	}
+}
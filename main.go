@@ -1,19 +1,38 @@
 package main
 
 import (
+	"context"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"log"
+	"net/http"
+	"os"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
+	"gitlab.eclipse.org/eclipse/xfsc/libraries/messaging/cloudeventprovider"
 	conf "gitlab.eclipse.org/eclipse/xfsc/libraries/microservice/core/pkg/config"
 	logr "gitlab.eclipse.org/eclipse/xfsc/libraries/microservice/core/pkg/logr"
 	server "gitlab.eclipse.org/eclipse/xfsc/libraries/microservice/core/pkg/server"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/api"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/auth"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/common"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/connection"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/did"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/encryption"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/httpclient"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/keyring"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/kms"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/messaging"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/model"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/policy"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/proof"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/requestobject"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/schema"
 	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/services"
+	svcCommon "github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/services/common"
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/signer"
 )
 
 var env *common.Environment
@@ -31,6 +50,343 @@ func connectDb() error {
 	return nil
 }
 
+func initEncryption(config *model.Config) error {
+	if !config.Encryption.Enabled {
+		return nil
+	}
+
+	var kek encryption.KeyEncryptionKey
+	var err error
+
+	switch config.Encryption.Provider {
+	case "vault":
+		kek, err = encryption.NewVaultTransitKeyEncryptionKey(config.Encryption.Vault.Address, config.Encryption.Vault.Token, config.Encryption.Vault.TransitPath, config.Encryption.Vault.KeyName, nil)
+	case "local":
+		kek, err = encryption.NewLocalKeyEncryptionKey(config.Encryption.Local.KeyFile, config.Encryption.Local.PreviousKeyFiles...)
+	default:
+		err = errors.New("unknown encryption provider " + config.Encryption.Provider)
+	}
+
+	if err != nil {
+		env.GetLogger().Error(err, "Encryption could not be initialized")
+		return err
+	}
+
+	rotation := time.Duration(config.Encryption.DataKeyRotationDays) * 24 * time.Hour
+	env.SetEnvelope(encryption.New(kek, svcCommon.NewDataKeyStore(), rotation))
+	env.GetLogger().Info("Encryption at rest enabled", "kek", kek.Id())
+	return nil
+}
+
+func initKeyring(config *model.Config) error {
+	// the configured keys are static, only the key directory is picked up again on reload
+	sources := []keyring.Source{
+		keyring.StaticSource(config.SigningKeys.ActiveKeyId, append([]string{config.SigningKey}, config.SigningKeys.VerifyOnly...)...),
+	}
+
+	if config.SigningKeys.Directory != "" {
+		sources = append(sources, keyring.DirectorySource(config.SigningKeys.ActiveKeyId, config.SigningKeys.Directory))
+	}
+
+	kr, err := keyring.New(keyring.Combine(sources...))
+
+	if err != nil {
+		env.GetLogger().Error(err, "Keyring could not be initialized")
+		return err
+	}
+
+	env.SetKeyring(kr)
+	env.GetLogger().Info("Keyring loaded", "activeKeyId", kr.ActiveKeyId())
+
+	go kr.Watch(time.Duration(config.SigningKeys.ReloadIntervalSec)*time.Second, func(err error) {
+		env.GetLogger().Error(err, "Keyring reload failed, keeping the current keys")
+	})
+	return nil
+}
+
+func httpDestination(destination model.HttpDestination) httpclient.Options {
+	return httpclient.Options{
+		Timeout:    time.Duration(destination.TimeoutSec) * time.Second,
+		CaBundle:   destination.CaBundle,
+		ClientCert: destination.ClientCert,
+		ClientKey:  destination.ClientKey,
+		Proxy:      destination.Proxy,
+		Insecure:   destination.Insecure,
+	}
+}
+
+func initHttpClients(config *model.Config) error {
+	defaults := httpclient.Options{
+		Timeout:  time.Duration(config.HttpClient.TimeoutSec) * time.Second,
+		CaBundle: config.HttpClient.CaBundle,
+		Proxy:    config.HttpClient.Proxy,
+		Insecure: config.HttpClient.Insecure,
+	}
+
+	// request and response uris are chosen by externals, only they are restricted by the egress policy
+	egress := &httpclient.EgressPolicy{
+		AllowHttp:            config.Egress.AllowHttp,
+		AllowPrivateNetworks: config.Egress.AllowPrivateNetworks,
+		MaxResponseBytes:     config.Egress.MaxResponseBytes,
+		Hosts:                httpclient.Hosts{Allow: config.Egress.Allow, Deny: config.Egress.Deny},
+		Tenants:              make(map[string]httpclient.Hosts),
+	}
+
+	for tenantId, hosts := range config.Egress.Tenants {
+		egress.Tenants[tenantId] = httpclient.Hosts{Allow: hosts.Allow, Deny: hosts.Deny}
+	}
+
+	requestObject := httpDestination(config.HttpClient.RequestObject)
+	requestObject.Egress = egress
+	responseUri := httpDestination(config.HttpClient.ResponseUri)
+	responseUri.Egress = egress
+	contexts := httpDestination(config.HttpClient.Context)
+	contexts.Egress = egress
+	dids := httpDestination(config.HttpClient.Did)
+	dids.Egress = egress
+	schemas := httpDestination(config.HttpClient.Schema)
+	schemas.Egress = egress
+	webhooks := httpDestination(config.HttpClient.Webhook)
+	webhooks.Egress = egress
+
+	factory, err := httpclient.NewFactory(defaults, map[httpclient.Destination]httpclient.Options{
+		httpclient.RequestObject: requestObject,
+		httpclient.ResponseUri:   responseUri,
+		httpclient.Signer:        httpDestination(config.HttpClient.Signer),
+		httpclient.Policy:        httpDestination(config.HttpClient.Policy),
+		httpclient.Context:       contexts,
+		httpclient.Did:           dids,
+		httpclient.Schema:        schemas,
+		httpclient.Vault:         httpDestination(config.HttpClient.Vault),
+		httpclient.Webhook:       webhooks,
+		httpclient.Auth:          httpDestination(config.HttpClient.Auth),
+		httpclient.Resolver:      httpDestination(config.HttpClient.Resolver),
+	})
+
+	if err != nil {
+		env.GetLogger().Error(err, "Http clients could not be initialized")
+		return err
+	}
+
+	if factory.Insecure() {
+		env.GetLogger().Info("WARNING: tls certificate verification is disabled for outbound requests, use this only for development")
+	}
+
+	env.SetHttpClients(factory)
+	return nil
+}
+
+func initPolicy(config *model.Config) error {
+	switch config.Policy.Engine {
+	case "opa":
+		if config.Policy.OpaUrl != "" {
+			client, _ := env.GetHttpClients().Client(httpclient.Policy)
+			env.SetPolicyEngine(policy.NewOpaEngine(config.Policy.OpaUrl, client))
+		}
+	case "rego":
+		engine, err := policy.NewRegoEngine(config.Policy.RegoDirectory)
+
+		if err != nil {
+			env.GetLogger().Error(err, "Rego policies could not be loaded")
+			return err
+		}
+
+		env.SetPolicyEngine(engine)
+	default:
+		return errors.New("unknown policy engine " + config.Policy.Engine)
+	}
+	return nil
+}
+
+func initSigner(config *model.Config) error {
+	var transport signer.Signer
+
+	switch config.SignerService.Transport {
+	case "http":
+		client, _ := env.GetHttpClients().Client(httpclient.Signer)
+		transport = signer.NewHttpSigner(config.SignerService.PresentationSignUrl, config.SignerService.PresentationVerifyUrl, client)
+	case "nats":
+		client, err := cloudeventprovider.New(cloudeventprovider.Config{Protocol: config.Messaging.Protocol, Settings: cloudeventprovider.NatsConfig{
+			Url:          config.Messaging.Nats.Url,
+			QueueGroup:   config.Messaging.Nats.QueueGroup,
+			TimeoutInSec: time.Duration(config.SignerService.TimeoutSec) * time.Second,
+		}}, cloudeventprovider.Req, config.SignerService.SignerTopic)
+
+		if err != nil {
+			env.GetLogger().Error(err, "Signer could not be connected")
+			return err
+		}
+
+		transport = signer.NewNatsSigner(client, config.SignerService.SignerTopic)
+	default:
+		return errors.New("unknown signer transport " + config.SignerService.Transport)
+	}
+
+	env.SetSigner(signer.WithRetry(transport,
+		time.Duration(config.SignerService.TimeoutSec)*time.Second,
+		config.SignerService.Retries,
+		time.Duration(config.SignerService.RetryBackoffMs)*time.Millisecond))
+	return nil
+}
+
+func newSigningBackend(backend model.SigningBackend) (kms.Backend, error) {
+	switch backend.Type {
+	case "", "signer":
+		return nil, nil
+	case "local":
+		return kms.LoadLocalBackend(backend.Directory, backend.DefaultKey)
+	case "pkcs11":
+		return kms.NewPkcs11Backend(backend.Pkcs11.Module, backend.Pkcs11.TokenLabel, backend.Pkcs11.Pin, backend.DefaultKey)
+	case "vault":
+		client, _ := env.GetHttpClients().Client(httpclient.Vault)
+		return kms.NewVaultBackend(backend.Vault.Address, backend.Vault.Token, backend.Vault.Namespace, backend.Vault.TransitPath, backend.DefaultKey, client), nil
+	}
+	return nil, errors.New("unknown signing backend " + backend.Type)
+}
+
+func initSigningBackends(config *model.Config) error {
+	defaultBackend, err := newSigningBackend(config.RequestObjectSigning.Default)
+
+	if err != nil {
+		env.GetLogger().Error(err, "Request object signing backend could not be initialized")
+		return err
+	}
+
+	tenants := make(map[string]kms.Backend)
+
+	for tenantId, backend := range config.RequestObjectSigning.Tenants {
+		tenants[tenantId], err = newSigningBackend(backend)
+
+		if err != nil {
+			env.GetLogger().Error(err, "Request object signing backend could not be initialized", "tenant", tenantId)
+			return err
+		}
+	}
+
+	env.SetSigningBackends(kms.NewBackends(defaultBackend, tenants))
+	return nil
+}
+
+func initDidResolver(config *model.Config) {
+	// did:web documents are fetched with the egress policy, the universal resolver of the operator without
+	client, _ := env.GetHttpClients().Client(httpclient.Did)
+	universal, _ := env.GetHttpClients().Client(httpclient.Resolver)
+	env.SetDidResolver(did.NewResolver(client, universal, config.DidResolver.UniversalResolverUrl,
+		time.Duration(config.DidResolver.CacheTtlSec)*time.Second))
+}
+
+func initRequestObjectVerifier(config *model.Config) error {
+	verification := config.RequestObjectVerification
+	var roots *x509.CertPool
+
+	if verification.CaBundle != "" {
+		pem, err := os.ReadFile(verification.CaBundle)
+
+		if err != nil {
+			env.GetLogger().Error(err, "Request object ca bundle could not be read")
+			return err
+		}
+
+		roots = x509.NewCertPool()
+
+		if !roots.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in " + verification.CaBundle)
+		}
+	}
+
+	env.SetRequestObjectVerifier(requestobject.NewVerifier(env.GetDidResolver(), requestobject.Options{
+		Algorithms:    verification.Algorithms,
+		Audiences:     verification.Audiences,
+		RequireType:   verification.RequireType,
+		RequireExpiry: verification.RequireExpiry,
+		MaxAge:        time.Duration(verification.MaxAgeSec) * time.Second,
+		Leeway:        time.Duration(verification.LeewaySec) * time.Second,
+		Roots:         roots,
+	}))
+	return nil
+}
+
+func initProofVerifier(config *model.Config) error {
+	if !config.ProofVerification.Native {
+		return nil
+	}
+
+	var client *http.Client
+
+	if config.ProofVerification.AllowRemoteContexts {
+		client, _ = env.GetHttpClients().Client(httpclient.Context)
+	}
+
+	loader, err := proof.NewContextLoader(config.ProofVerification.Contexts, client,
+		time.Duration(config.ProofVerification.ContextCacheTtlSec)*time.Second)
+
+	if err != nil {
+		env.GetLogger().Error(err, "Json-ld contexts could not be loaded")
+		return err
+	}
+
+	canonicalizer, err := proof.NewCanonicalizer(loader)
+
+	if err != nil {
+		if !config.ProofVerification.SignerFallback {
+			env.GetLogger().Error(err, "Native proof verification could not be initialized")
+			return err
+		}
+
+		env.GetLogger().Info("native proof verification is not available, proofs are verified by the signer", "reason", err.Error())
+		return nil
+	}
+
+	env.SetProofVerifier(proof.NewVerifier(canonicalizer, env.GetDidResolver().ResolveKey))
+	return nil
+}
+
+func initSchemaValidator(config *model.Config) {
+	if !config.SchemaValidation.Enabled {
+		return
+	}
+
+	client, _ := env.GetHttpClients().Client(httpclient.Schema)
+	env.SetSchemaValidator(schema.NewValidator(client, time.Duration(config.SchemaValidation.CacheTtlSec)*time.Second,
+		config.SchemaValidation.Registries))
+}
+
+func initInternalAuth(config *model.Config) (auth.Authenticator, error) {
+	if !config.InternalAuth.Enabled {
+		if !config.InternalAuth.Insecure {
+			err := errors.New("internal auth is not configured, enable internalAuth or set internalAuth.insecure for development")
+			env.GetLogger().Error(err, "Internal auth could not be initialized")
+			return nil, err
+		}
+		env.GetLogger().Info("WARNING: internal API is not authenticated, use internalAuth.insecure only for development")
+		return nil, nil
+	}
+
+	var authenticator auth.Authenticator
+	client, err := env.GetHttpClients().Client(httpclient.Auth)
+
+	if err != nil {
+		env.GetLogger().Error(err, "Internal auth could not be initialized")
+		return nil, err
+	}
+
+	switch config.InternalAuth.Mode {
+	case "jwks":
+		authenticator, err = auth.NewJwksAuthenticator(config.InternalAuth.JwksUrl, config.InternalAuth.Issuer, config.InternalAuth.Audience, client)
+	case "introspection":
+		authenticator, err = auth.NewIntrospectionAuthenticator(config.InternalAuth.IntrospectionUrl, config.InternalAuth.ClientId, config.InternalAuth.ClientSecret, config.InternalAuth.Issuer, config.InternalAuth.Audience, client)
+	default:
+		err = errors.New("unknown internal auth mode " + config.InternalAuth.Mode)
+	}
+
+	if err != nil {
+		env.GetLogger().Error(err, "Internal auth could not be initialized")
+		return nil, err
+	}
+
+	return authenticator, nil
+}
+
 // @title			Credential verification service API
 // @version		1.0
 // @description	Service for handling credentials proofs (presentations)
@@ -64,6 +420,32 @@ func main() {
 		env.SetLogger(logger)
 		env.SetConfig(&config)
 		err = connectDb()
+		if err == nil {
+			err = initEncryption(&config)
+		}
+		if err == nil {
+			err = initKeyring(&config)
+		}
+		if err == nil {
+			err = initHttpClients(&config)
+		}
+		if err == nil {
+			err = initPolicy(&config)
+		}
+		if err == nil {
+			err = initSigner(&config)
+		}
+		if err == nil {
+			err = initSigningBackends(&config)
+		}
+		if err == nil {
+			initDidResolver(&config)
+			err = initRequestObjectVerifier(&config)
+		}
+		if err == nil {
+			err = initProofVerifier(&config)
+			initSchemaValidator(&config)
+		}
 		if err == nil {
 			server := server.New(env, config.BaseConfig.ServerMode)
 
@@ -80,7 +462,20 @@ func main() {
 			}
 
 			api.AddExternalRoutes(server, authHandler, requestor)
-			api.AddInternalRoutes(server, requestor)
+			authenticator, err := initInternalAuth(&config)
+
+			if err != nil {
+				return
+			}
+
+			api.AddInternalRoutes(server, requestor, authenticator)
+
+			go services.RunDeliveryWorker(context.Background(), &config)
+			go services.RunExpiryWorker(context.Background(), &config)
+
+			if config.Webhooks.Enabled {
+				go services.RunWebhookWorker(context.Background(), &config)
+			}
 
 			err = server.Run(config.BaseConfig.ListenPort)
 			if err != nil {
@@ -0,0 +1,56 @@
+package messaging
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+//go:embed schemas/status-event.schema.json
+var statusEventSchema []byte
+
+// EventTypes returns the sorted types of the status events.
+func EventTypes() []string {
+	ret := make([]string, 0, len(StatusEventTypes))
+	for _, t := range StatusEventTypes {
+		ret = append(ret, t)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// EventSchema returns the JSON schema of a status event type. It fixes the status of the type and requires the
+// verification summary for the outcomes of a received presentation.
+func EventSchema(eventType string) ([]byte, error) {
+	status := ""
+	for s, t := range StatusEventTypes {
+		if t == eventType {
+			status = s
+		}
+	}
+
+	if status == "" {
+		return nil, fmt.Errorf("unknown event type %s", eventType)
+	}
+
+	var schema map[string]interface{}
+
+	if err := json.Unmarshal(statusEventSchema, &schema); err != nil {
+		return nil, err
+	}
+
+	schema["$id"] = eventType
+	schema["title"] = eventType
+
+	properties := schema["properties"].(map[string]interface{})
+	properties["status"] = map[string]interface{}{"const": status}
+	properties["version"] = map[string]interface{}{"const": StatusEventVersion}
+
+	switch eventType {
+	case PresentationReceivedType, PresentationRejectedType, VerificationFailedType:
+		schema["required"] = append(schema["required"].([]interface{}), "verification")
+	}
+
+	return json.MarshalIndent(schema, "", "  ")
+}
@@ -0,0 +1,67 @@
+package messaging
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/eclipse-xfsc/oid4-vci-credential-verification-service/internal/schema"
+	"gitlab.eclipse.org/eclipse/xfsc/organisational-credential-manager-w-stack/libraries/messaging/common"
+)
+
+func validate(t *testing.T, eventType string, event StatusEvent) []string {
+	s, err := EventSchema(eventType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var document, instance interface{}
+	json.Unmarshal(s, &document)
+	b, _ := json.Marshal(event)
+	json.Unmarshal(b, &instance)
+
+	errs, err := schema.Validate(document, instance)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return errs
+}
+
+func Test_EventSchema(t *testing.T) {
+	if len(EventTypes()) != len(StatusEventTypes) {
+		t.Error("each state needs an event type")
+	}
+
+	event := StatusEvent{
+		Reply:          common.Reply{TenantId: "tenant_space", GroupId: "group"},
+		EventId:        "1",
+		Version:        StatusEventVersion,
+		Timestamp:      time.Now(),
+		PresentationId: "id",
+		Status:         "presentation-received",
+		ActorType:      "wallet",
+		ExpiresAt:      time.Now(),
+		Verification:   &VerificationSummary{Valid: true, Descriptors: []string{"license"}},
+	}
+
+	if errs := validate(t, PresentationReceivedType, event); len(errs) > 0 {
+		t.Error(errs)
+	}
+
+	if errs := validate(t, PresentationRejectedType, event); len(errs) == 0 {
+		t.Error("status must match the type")
+	}
+
+	event.Verification = nil
+
+	if errs := validate(t, PresentationReceivedType, event); len(errs) == 0 {
+		t.Error("received events need the verification summary")
+	}
+
+	if _, err := EventSchema("verifier.presentation.unknown.v1"); err == nil {
+		t.Error("unknown types must fail")
+	}
+}
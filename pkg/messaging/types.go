@@ -1,6 +1,9 @@
 package messaging
 
 import (
+	"encoding/json"
+	"time"
+
 	"gitlab.eclipse.org/eclipse/xfsc/libraries/ssi/oid4vip/model/presentation"
 	"gitlab.eclipse.org/eclipse/xfsc/organisational-credential-manager-w-stack/libraries/messaging/common"
 )
@@ -11,20 +14,35 @@ const (
 	PresentationAuthorizationRemoteType = "verifier.presentation.authorization.remote"
 )
 
+// TemplateReference selects a presentation definition template of the tenant, version 0 is the latest.
+type TemplateReference struct {
+	Id         string                 `json:"id"`
+	Version    int                    `json:"version,omitempty"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// PresentationAuthorizationCreationRequest carries either the presentation definition or a template reference.
 type PresentationAuthorizationCreationRequest struct {
 	common.Request
 	PresentationDefinition presentation.PresentationDefinition `json:"presentationDefinition"`
+	Template               *TemplateReference                  `json:"template,omitempty"`
 	Ttl                    int                                 `json:"ttl"`
 	TenantUri              string                              `json:"tenant_uri"`
 	TargetUri              string                              `json:"target_uri"`
 	RequestObjectUri       string                              `json:"requestobject_uri"`
 	Nonce                  []byte                              `json:"nonce"`
+	WebhookUrl             string                              `json:"webhook_url,omitempty"`
+	// Did is the client id of the verifier, the request object is signed with a key of it
+	Did string `json:"did"`
 }
 
 type PresentationAuthorizationCreationReply struct {
 	BaseReply      common.Reply
 	PresentationId string `json:"presentation_id"`
-	RequestUri     string `json:"request_uri"`
+	AccessToken    string `json:"access_token"`
+	// RequestAccessToken addresses the internal routes by request id, it is only given for requests with an id
+	RequestAccessToken string `json:"request_access_token,omitempty"`
+	RequestUri         string `json:"request_uri"`
 }
 
 type PresentationAuthorizationRemoteRequest struct {
@@ -42,10 +60,152 @@ type PresentationAuthorizationRemoteReply struct {
 
 const (
 	ProofNotifyType = "verifier.proof.notification"
+	AuditType       = "verifier.presentation.audit"
 )
 
 type ProofNotifyEvent struct {
 	common.Reply
 	PresentationId string `json:"presentation_id"`
+	AccessToken    string `json:"access_token"`
 	Status         string `json:"status"`
+	// Claims of received presentations by input descriptor
+	Claims map[string]DescriptorClaims `json:"claims,omitempty"`
+}
+
+// DescriptorClaims are the claims which the fields of an input descriptor address.
+type DescriptorClaims struct {
+	Format string                 `json:"format"`
+	Issuer string                 `json:"issuer,omitempty"`
+	Types  []string               `json:"types,omitempty"`
+	Claims map[string]interface{} `json:"claims"`
+}
+
+// Versioned types of the status events, one per lifecycle state. Incompatible changes of an event get a new version.
+const (
+	StatusEventVersion = "v1"
+
+	PresentationRequestedType   = "verifier.presentation.requested." + StatusEventVersion
+	RequestObjectFetchedType    = "verifier.presentation.request-object-fetched." + StatusEventVersion
+	PresentationReceivedType    = "verifier.presentation.received." + StatusEventVersion
+	PresentationRejectedType    = "verifier.presentation.rejected." + StatusEventVersion
+	VerificationFailedType      = "verifier.presentation.verification-failed." + StatusEventVersion
+	PresentationTransmittedType = "verifier.presentation.transmitted." + StatusEventVersion
+	PresentationExpiredType     = "verifier.presentation.expired." + StatusEventVersion
+	PresentationCancelledType   = "verifier.presentation.cancelled." + StatusEventVersion
+)
+
+// StatusEventTypes maps the states of a presentation to the types of their status events.
+var StatusEventTypes = map[string]string{
+	"presentation-requested":   PresentationRequestedType,
+	"request-object-fetched":   RequestObjectFetchedType,
+	"presentation-received":    PresentationReceivedType,
+	"presentation-rejected":    PresentationRejectedType,
+	"verification-failed":      VerificationFailedType,
+	"presentation-transmitted": PresentationTransmittedType,
+	"expired":                  PresentationExpiredType,
+	"cancelled":                PresentationCancelledType,
+}
+
+// StatusEvent is published for each state transition of a presentation.
+type StatusEvent struct {
+	common.Reply
+	EventId        string               `json:"event_id"`
+	Version        string               `json:"version"`
+	Timestamp      time.Time            `json:"timestamp"`
+	PresentationId string               `json:"presentation_id"`
+	ClientId       string               `json:"client_id,omitempty"`
+	Status         string               `json:"status"`
+	ActorType      string               `json:"actor_type"`
+	ExpiresAt      time.Time            `json:"expires_at"`
+	Verification   *VerificationSummary `json:"verification,omitempty"`
+}
+
+// VerificationSummary is the result of the verification of a received presentation.
+type VerificationSummary struct {
+	Valid          bool     `json:"valid"`
+	Outcome        string   `json:"outcome,omitempty"`
+	Descriptors    []string `json:"descriptors,omitempty"`
+	SchemaChecks   int      `json:"schema_checks"`
+	SchemaFailures int      `json:"schema_failures"`
+}
+
+// WebhookEvent is the body of a webhook callback, the claims are given once a presentation was received.
+type WebhookEvent struct {
+	Type string `json:"type"`
+	StatusEvent
+	Claims map[string]DescriptorClaims `json:"claims,omitempty"`
+}
+
+type AuditEvent struct {
+	common.Reply
+	PresentationId string    `json:"presentation_id"`
+	EventId        string    `json:"event_id"`
+	Timestamp      time.Time `json:"timestamp"`
+	State          string    `json:"state"`
+	ActorType      string    `json:"actor_type"`
+	ActorId        string    `json:"actor_id"`
+	Outcome        string    `json:"outcome,omitempty"`
+}
+
+const (
+	ConsentApprovalType = "verifier.presentation.consent.approval"
+)
+
+// ConsentApprovalRequest asks the holder to approve the disclosure of the requested fields to the verifier.
+type ConsentApprovalRequest struct {
+	common.Request
+	PresentationId string   `json:"presentation_id"`
+	ClientId       string   `json:"client_id"`
+	ResponseUri    string   `json:"response_uri"`
+	Purposes       []string `json:"purposes"`
+	Fields         []string `json:"fields"`
+	Reasons        []string `json:"reasons,omitempty"`
+}
+
+type ConsentApprovalReply struct {
+	common.Reply
+	Approved bool   `json:"approved"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+const (
+	DeliveryDeadLetterType = "verifier.presentation.delivery.deadletter"
+)
+
+// DeliveryDeadLetterEvent reports a presentation which could not be delivered to the response uri.
+type DeliveryDeadLetterEvent struct {
+	common.Reply
+	PresentationId string `json:"presentation_id"`
+	ResponseUri    string `json:"response_uri"`
+	Attempts       int    `json:"attempts"`
+	LastError      string `json:"last_error"`
+}
+
+const (
+	SignPresentationType   = "signer.signPresentation"
+	VerifyPresentationType = "signer.verifyPresentation"
+)
+
+type SignPresentationRequest struct {
+	common.Request
+	Namespace    string                 `json:"namespace"`
+	Group        string                 `json:"group"`
+	Key          string                 `json:"key"`
+	Issuer       string                 `json:"issuer"`
+	Presentation map[string]interface{} `json:"presentation"`
+}
+
+type SignPresentationReply struct {
+	common.Reply
+	Presentation json.RawMessage `json:"presentation"`
+}
+
+type VerifyPresentationRequest struct {
+	common.Request
+	Presentation json.RawMessage `json:"presentation"`
+}
+
+type VerifyPresentationReply struct {
+	common.Reply
+	Valid bool `json:"valid"`
 }